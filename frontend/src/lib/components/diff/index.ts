@@ -7,5 +7,6 @@ export { default as InlineCommentWithContext } from './InlineCommentWithContext.
 export { default as InlineEditor } from './InlineEditor.svelte';
 export { default as ContextExpander } from './ContextExpander.svelte';
 export { default as ReactionPicker } from './ReactionPicker.svelte';
+export { default as BinaryDiff } from './BinaryDiff.svelte';
 
 export type { APIChangeset, APIDiffRow, APIReviewComment, APIReaction } from './DiffTable.svelte';
@@ -0,0 +1,31 @@
+// Git file mode changes, described for changeset headers and the file tree.
+
+import { S } from '$lib/strings';
+
+const MODE_FILE = '100644';
+const MODE_EXECUTABLE = '100755';
+const MODE_SYMLINK = '120000';
+const MODE_SUBMODULE = '160000';
+
+function modeName(mode: string): string {
+  switch (mode) {
+    case MODE_EXECUTABLE: return S.diff.modeExecutable;
+    case MODE_SYMLINK: return S.diff.modeSymlink;
+    case MODE_SUBMODULE: return S.diff.modeSubmodule;
+    default: return S.diff.modeFile;
+  }
+}
+
+// modeChange returns a short label for a changed file mode ('+x', '-x',
+// 'file → symlink'), or '' if the mode didn't change.
+export function modeChange(oldMode?: string, newMode?: string): string {
+  if (!oldMode || !newMode || oldMode === newMode) return '';
+  if (oldMode === MODE_FILE && newMode === MODE_EXECUTABLE) return S.diff.modeExecutable;
+  if (oldMode === MODE_EXECUTABLE && newMode === MODE_FILE) return S.diff.modeNotExecutable;
+  return `${modeName(oldMode)} → ${modeName(newMode)}`;
+}
+
+// isSymlink reports whether a changeset's file is a symlink on its newest side.
+export function isSymlink(oldMode?: string, newMode?: string): boolean {
+  return (newMode || oldMode) === MODE_SYMLINK;
+}
@@ -1,11 +1,23 @@
 import { writable, derived } from 'svelte/store';
+import { apiFetch, apiPost } from '$lib/api';
 
+// Drafts are kept server-side once saved, survive reloads (see loadDrafts),
+// and are published together with the next review (see ReviewForm), so the
+// author gets one notification.
 export interface DraftComment {
   path: string;
   line: number;
   side: string;
   body: string;
+  startLine?: number; // first line of a multi-line comment, on the same side
   inReplyTo?: number;
+  id?: number; // server-side draft ID, set on first save
+}
+
+export interface DraftPR {
+  owner: string;
+  repo: string;
+  number: number;
 }
 
 export const drafts = writable<DraftComment[]>([]);
@@ -14,8 +26,8 @@ export const pendingCount = derived(drafts, ($drafts) =>
   $drafts.filter((d) => d.body.trim().length > 0).length
 );
 
-export function addDraft(path: string, line: number, side: string) {
-  drafts.update((d) => [...d, { path, line, side, body: '' }]);
+export function addDraft(path: string, line: number, side: string, startLine?: number) {
+  drafts.update((d) => [...d, { path, line, side, body: '', startLine }]);
 }
 
 export function addReplyDraft(path: string, line: number, side: string, inReplyTo: number) {
@@ -28,6 +40,16 @@ export function removeDraft(path: string, line: number, side: string) {
   );
 }
 
+// removeEmptyDraft drops a draft that was opened but never typed in or
+// saved, as when a shift-click widens it into a range.
+export function removeEmptyDraft(path: string, line: number, side: string) {
+  drafts.update((d) =>
+    d.filter(
+      (x) => !(x.path === path && x.line === line && x.side === side && !x.body && x.id === undefined)
+    )
+  );
+}
+
 export function updateDraft(path: string, line: number, side: string, body: string) {
   drafts.update((d) =>
     d.map((x) =>
@@ -36,6 +58,62 @@ export function updateDraft(path: string, line: number, side: string, body: stri
   );
 }
 
+// saveDraft stores the draft's body on the server, creating the server-side
+// draft on first save.
+export async function saveDraft(pr: DraftPR, draft: DraftComment, body: string) {
+  let id = draft.id;
+  if (id === undefined) {
+    const created = await apiPost<{ comment: { id: number } }>('/api/v2/inline', {
+      ...pr,
+      operation: 'new',
+      path: draft.path,
+      line: draft.line,
+      side: draft.side,
+      startLine: draft.startLine,
+      startSide: draft.startLine ? draft.side : undefined,
+      inReplyTo: draft.inReplyTo
+    });
+    id = created.comment.id;
+  }
+  await apiPost('/api/v2/inline', { ...pr, operation: 'save', commentID: id, body });
+  drafts.update((d) =>
+    d.map((x) =>
+      x.path === draft.path && x.line === draft.line && x.side === draft.side ? { ...x, id, body } : x
+    )
+  );
+}
+
+// discardDraft removes a draft locally and, if it was saved, on the server.
+export async function discardDraft(pr: DraftPR, draft: DraftComment) {
+  removeDraft(draft.path, draft.line, draft.side);
+  if (draft.id !== undefined) {
+    await apiPost('/api/v2/inline', { ...pr, operation: 'cancel', commentID: draft.id });
+  }
+}
+
+// loadDrafts replaces the local drafts with the user's saved drafts on pr.
+export async function loadDrafts(pr: DraftPR) {
+  const resp = await apiFetch<{ drafts: (DraftComment & { id: number })[] }>(
+    `/api/pr/${pr.owner}/${pr.repo}/${pr.number}/drafts`
+  );
+  drafts.set(
+    resp.drafts.map((d) => ({
+      id: d.id,
+      path: d.path,
+      line: d.line,
+      side: d.side,
+      body: d.body,
+      startLine: d.startLine,
+      inReplyTo: d.inReplyTo
+    }))
+  );
+}
+
+// removePublished drops the drafts a review published.
+export function removePublished(ids: number[]) {
+  drafts.update((d) => d.filter((x) => x.id === undefined || !ids.includes(x.id)));
+}
+
 export function clearDrafts() {
   drafts.set([]);
 }
@@ -59,6 +59,8 @@ export const S = {
     mergeRebase: 'Rebase',
     mergeFailed: 'Merge failed',
     actionFailed: 'Failed',
+    reviewFailed: 'Review failed',
+    draftsFailed: 'The review was submitted, but some drafts were not published:',
     // Status badges
     statusOpen: 'Open',
     statusClosed: 'Closed',
@@ -88,6 +90,50 @@ export const S = {
     colDate: 'Date',
     justNow: 'just now',
     yesterday: 'yesterday',
+    deferredTooLarge: 'This file is too large to show by default.',
+    deferredBudget: 'This diff is large; this file was not loaded.',
+    deferredGenerated: 'This file is generated and is hidden by default.',
+    deferredVendored: 'This file is vendored and is hidden by default.',
+    deferredLockfile: 'This lock file is hidden by default.',
+    deferredBinary: 'This binary file was not loaded.',
+    binaryBefore: 'Before',
+    binaryAfter: 'After',
+    binaryAbsent: 'No file',
+    binaryUnchanged: 'Contents are identical.',
+    binarySize: 'Size',
+    binaryDimensions: 'Dimensions',
+    binaryHash: 'SHA-256',
+    loadFile: 'Load file',
+    renamedFrom: 'renamed from',
+    copiedFrom: 'copied from',
+    similarity: 'similar',
+    modeExecutable: '+x',
+    modeNotExecutable: '-x',
+    modeSymlink: 'symlink',
+    modeSubmodule: 'submodule',
+    modeFile: 'file',
+    symbolAdded: 'added',
+    symbolRemoved: 'removed',
+    symbolModified: 'modified',
+    symbolsMore: 'more',
+    lines: 'Lines',
+    suggestChange: 'Suggest change',
+    suggestedChange: 'Suggested change',
+    applySuggestion: 'Apply suggestion',
+    applyingSuggestion: 'Applying...',
+    suggestionApplied: 'Applied',
+    suggestionFailed: 'Could not apply the suggestion.',
+    rangeHint: 'Shift-click another line number to comment on a range',
+    resolve: 'Resolve',
+    unresolve: 'Unresolve',
+    resolved: 'Resolved',
+    outdated: 'Outdated',
+    showThread: 'Show',
+    hideThread: 'Hide',
+    ported: 'Ported',
+    ghost: 'Ghost',
+    ghostHint: 'The lines this comment was made on are gone from the diff.',
+    originalLine: 'Was line',
   },
 
   // Actions
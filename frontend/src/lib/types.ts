@@ -65,6 +65,15 @@ export interface APIDiffRow {
   oldContent: string;
   newContent: string;
   isContext: boolean;
+  oldMove?: APIMove;
+  newMove?: APIMove;
+}
+
+export interface APIMove {
+  dir: 'to' | 'from';
+  changeset: number;
+  path: string;
+  line: number;
 }
 
 export interface APIChangeset {
@@ -77,8 +86,63 @@ export interface APIChangeset {
   isNew: boolean;
   isDeleted: boolean;
   isRenamed: boolean;
+  isCopied: boolean; // oldName is the copy source
   isBinary: boolean;
-  rows: APIDiffRow[];
+  similarity?: number; // percent, for renames and copies
+  oldMode?: string; // git file mode, e.g. '100755'
+  newMode?: string;
+  kind?: 'generated' | 'vendored' | 'lockfile' | 'binary';
+  rows?: APIDiffRow[]; // layout=sidebyside
+  unifiedRows?: APIUnifiedRow[]; // layout=unified
+  hunks: APIHunk[];
+  changedSymbols?: APISymbol[]; // declarations touched by the diff
+  binary?: APIBinaryDiff; // binary files and images
+  deferred?: 'too_large' | 'budget' | 'generated' | 'vendored' | 'lockfile' | 'binary'; // rows left out; load from renderURI
+  renderURI?: string;
+}
+
+export interface APIHunk {
+  oldStart: number;
+  oldCount: number;
+  newStart: number;
+  newCount: number;
+  section?: string; // enclosing function or type, shown in the hunk header
+}
+
+export interface APISymbol {
+  kind: string; // 'func', 'method', 'type', 'class', ...
+  name: string;
+  label: string; // e.g. 'func (s *Server) handleAPIPR'
+  change: 'added' | 'removed' | 'modified';
+  oldLine: number;
+  newLine: number;
+}
+
+export interface APIBinaryDiff {
+  image: boolean;
+  old?: APIBlob; // absent for added files
+  new?: APIBlob; // absent for deleted files
+  error?: string;
+}
+
+export interface APIBlob {
+  path: string;
+  commit: string;
+  url: string;
+  size: number;
+  blobSha: string;
+  sha256?: string;
+  width?: number;
+  height?: number;
+}
+
+export interface APIUnifiedRow {
+  type: 'context' | 'added' | 'removed';
+  oldNum: number;
+  newNum: number;
+  class: string;
+  content: string;
+  move?: APIMove;
 }
 
 export interface APIReaction {
@@ -93,9 +157,41 @@ export interface APIReviewComment {
   path: string;
   line: number;
   side: string;
+  startLine?: number; // first line of a multi-line comment
+  startSide?: string;
   createdAt: string;
   inReplyTo?: number;
   reactions?: APIReaction[];
+  suggestion?: APISuggestion; // body then holds the rest of the comment
+  // Outdated comments are ported to line/startLine of the current diff or,
+  // if they can't be placed, are ghosts shown with the code they were on.
+  ported?: boolean;
+  ghost?: boolean;
+  originalLine?: number;
+  ghostContext?: APIUnifiedRow[];
+}
+
+// A resolvable thread of the comments in commentsByPath. line and
+// startLine are 0 once the thread is outdated.
+export interface APIReviewThread {
+  id: string;
+  path: string;
+  side: string;
+  line: number;
+  startLine?: number;
+  originalLine: number;
+  originalStartLine?: number;
+  isResolved: boolean;
+  isOutdated: boolean;
+  resolvedBy?: string;
+  commentIds: number[]; // oldest first
+}
+
+// A ```suggestion block, shown as a diff of the commented lines.
+export interface APISuggestion {
+  text: string;
+  rows?: APIUnifiedRow[]; // empty if the original lines are unknown
+  applicable: boolean; // on the new side and not outdated
 }
 
 export interface APIReview {
@@ -106,6 +202,13 @@ export interface APIReview {
   createdAt: string;
 }
 
+// The saved drafts a review published; failed ones stay saved.
+export interface APIReviewResponse {
+  ok: boolean;
+  published: number[]; // draft IDs
+  failed: { draftID: number; error: string }[];
+}
+
 export interface APIIssueComment {
   id: number;
   author: APIUser;
@@ -144,9 +247,63 @@ export interface APIHeraldAction {
 export interface APIHeraldMatch {
   ruleId: string;
   ruleName: string;
+  source?: 'repo_file'; // rule from .ghabricator/herald.yml on the base branch
   actions: APIHeraldAction[];
 }
 
+export interface APIHeraldLogEntry {
+  ruleId: string;
+  ruleName: string;
+  action: APIHeraldAction;
+  status: 'pending' | 'applied' | 'skipped' | 'failed';
+  error?: string;
+  at: string;
+}
+
+export interface APIHeraldBlocker {
+  reviewer: string;
+  ruleId: string;
+  ruleName: string;
+  approved: boolean;
+  statusContext: string;
+}
+
+export interface APIHeraldConditionResult {
+  type: string;
+  operator: string;
+  value: string;
+  matched: boolean;
+  reason: string;
+}
+
+export interface APIHeraldRuleChange {
+  kind: 'create' | 'update' | 'delete' | 'unchanged';
+  ruleId: string;
+  name: string;
+  fields?: string[];
+}
+
+export interface APIHeraldImportResponse {
+  mode: 'merge' | 'replace';
+  dryRun: boolean;
+  changes: APIHeraldRuleChange[];
+  errors?: string[];
+}
+
+export interface APIHeraldTranscript {
+  id: string;
+  ruleId: string;
+  ruleName: string;
+  repetition: 'first' | 'every';
+  repo: string;
+  number: number;
+  headSha: string;
+  conditions: APIHeraldConditionResult[];
+  actions: APIHeraldLogEntry[];
+  errors?: string[];
+  at: string;
+}
+
 export interface APICommit {
   sha: string;
   message: string;
@@ -157,12 +314,16 @@ export interface APICommit {
 export interface APIPRDetailResponse {
   pr: APIPRDetail;
   changesets: APIChangeset[];
+  layout: 'sidebyside' | 'unified';
   commentsByPath: Record<string, APIReviewComment[]>;
+  threads: APIReviewThread[];
   reviews: APIReview[];
   issueComments: APIIssueComment[];
   checkRuns: APICheckRun[];
   timeline: APITimelineEvent[];
   heraldMatches?: APIHeraldMatch[];
+  heraldLog?: APIHeraldLogEntry[];
+  heraldBlockers?: APIHeraldBlocker[];
   commits: APICommit[];
   viewerPermission: string; // ADMIN, MAINTAIN, WRITE, TRIAGE, READ, or ""
 }
@@ -274,6 +435,7 @@ export interface APIPasteCreateResponse {
 
 export interface HeraldCondition {
   type: string;
+  operator?: string; // is, is-not, contains, does-not-contain, matches-regex, glob, greater-than, less-than
   value: string;
 }
 
@@ -286,9 +448,14 @@ export interface HeraldRule {
   id: string;
   name: string;
   author_login: string;
+  scope?: 'personal' | 'repository' | 'global'; // empty means global
+  repository?: string; // owner/repo, for repository scope
+  repositories?: string[]; // optional filter: owner/repo or owner/*
+  source?: 'repo_file';
   conditions: HeraldCondition[];
   actions: HeraldAction[];
   must_match_all: boolean;
+  repetition?: 'first' | 'every'; // empty means first
   disabled: boolean;
   created_at: string;
   updated_at: string;
@@ -1,8 +1,11 @@
 import type { PageLoad } from './$types';
 import { apiFetch } from '$lib/api';
-import type { HeraldRule } from '$lib/types';
+import type { HeraldRule, APIHeraldTranscript } from '$lib/types';
 
 export const load: PageLoad = async ({ params }) => {
-  const rule = await apiFetch<HeraldRule>(`/api/herald/${params.id}`);
-  return { rule };
+  const [rule, transcripts] = await Promise.all([
+    apiFetch<HeraldRule>(`/api/herald/${params.id}`),
+    apiFetch<APIHeraldTranscript[]>(`/api/herald/transcripts?rule=${encodeURIComponent(params.id)}`),
+  ]);
+  return { rule, transcripts };
 };
@@ -2,8 +2,16 @@ import type { PageLoad } from './$types';
 import { apiFetch } from '$lib/api';
 import type { APIPRDetailResponse } from '$lib/types';
 
-export const load: PageLoad = async ({ params }) => {
+export const load: PageLoad = async ({ params, url }) => {
   const { owner, repo, number } = params;
-  const data = await apiFetch<APIPRDetailResponse>(`/api/pr/${owner}/${repo}/${number}`);
+  // Pass diff options (?whitespace=ignore, ?moves=true, ?layout=unified)
+  // through to the API.
+  const query = new URLSearchParams();
+  for (const key of ['whitespace', 'moves', 'layout']) {
+    const v = url.searchParams.get(key);
+    if (v) query.set(key, v);
+  }
+  const qs = query.size ? `?${query}` : '';
+  const data = await apiFetch<APIPRDetailResponse>(`/api/pr/${owner}/${repo}/${number}${qs}`);
   return { owner, repo, number: Number(number), data };
 };
@@ -65,11 +65,19 @@ func NewAuthHandler(store *SessionStore) (*AuthHandler, error) {
 	}, nil
 }
 
+// TokenClient returns the static GitHub client in token mode (nil in OAuth mode).
+func (h *AuthHandler) TokenClient() *gh.Client { return h.tokenClient }
+
+// StaticClient builds a GitHub client authenticated with a fixed token.
+func StaticClient(token string) *gh.Client {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return gh.NewClient(oauth2.NewClient(context.Background(), ts))
+}
+
 func newTokenHandler(pat string) (*AuthHandler, error) {
 	// Build a static client from the PAT.
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: pat})
-	client := gh.NewClient(oauth2.NewClient(ctx, ts))
+	client := StaticClient(pat)
 
 	// Fetch the authenticated user to populate session info.
 	user, _, err := client.Users.Get(ctx, "")
@@ -227,12 +235,17 @@ func (h *AuthHandler) RequireAuth(next http.Handler) http.Handler {
 			client = gh.NewClient(h.config.Client(r.Context(), sess.Token))
 		}
 
-		ctx := context.WithValue(r.Context(), ctxSession, sess)
-		ctx = context.WithValue(ctx, ctxGHClient, client)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), sess, client)))
 	})
 }
 
+// NewContext returns a copy of ctx carrying sess and client, as RequireAuth
+// passes them to handlers.
+func NewContext(ctx context.Context, sess *Session, client *gh.Client) context.Context {
+	ctx = context.WithValue(ctx, ctxSession, sess)
+	return context.WithValue(ctx, ctxGHClient, client)
+}
+
 // SessionFromContext retrieves the session from the request context.
 func SessionFromContext(ctx context.Context) *Session {
 	sess, _ := ctx.Value(ctxSession).(*Session)
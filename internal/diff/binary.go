@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	"path"
+	"strconv"
+	"strings"
+
+	// Decoders for image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// imageExts are the image types shown as before/after images in diffs.
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".svg":  true,
+	".webp": true,
+}
+
+// IsImage reports whether the path names an image type the diff view shows.
+func IsImage(p string) bool {
+	return imageExts[strings.ToLower(path.Ext(p))]
+}
+
+// ImageSize returns the pixel dimensions of PNG, JPEG, GIF, WebP or SVG
+// data. ok is false if the format isn't recognized. SVG sizes come from the
+// width and height attributes, or the viewBox, of the root element.
+func ImageSize(name string, data []byte) (width, height int, ok bool) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".svg":
+		return svgSize(data)
+	case ".webp":
+		return webpSize(data)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// webpSize reads the dimensions from a WebP file's first chunk.
+func webpSize(b []byte) (int, int, bool) {
+	if len(b) < 30 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(b[12:16]) {
+	case "VP8X": // extended: 24-bit width-1 and height-1
+		w := int(b[24]) | int(b[25])<<8 | int(b[26])<<16
+		h := int(b[27]) | int(b[28])<<8 | int(b[29])<<16
+		return w + 1, h + 1, true
+	case "VP8L": // lossless: 14-bit width-1 and height-1 after the signature
+		if b[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(b[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8 ": // lossy: 14-bit width and height after the start code
+		if b[23] != 0x9d || b[24] != 0x01 || b[25] != 0x2a {
+			return 0, 0, false
+		}
+		w := binary.LittleEndian.Uint16(b[26:28]) & 0x3fff
+		h := binary.LittleEndian.Uint16(b[28:30]) & 0x3fff
+		return int(w), int(h), true
+	}
+	return 0, 0, false
+}
+
+// svgSize reads width and height (or the viewBox) of the root <svg>.
+func svgSize(data []byte) (int, int, bool) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+		el, isStart := tok.(xml.StartElement)
+		if !isStart {
+			continue
+		}
+		if el.Name.Local != "svg" {
+			return 0, 0, false
+		}
+		var w, h float64
+		var viewBox string
+		for _, a := range el.Attr {
+			switch a.Name.Local {
+			case "width":
+				w = svgLength(a.Value)
+			case "height":
+				h = svgLength(a.Value)
+			case "viewBox":
+				viewBox = a.Value
+			}
+		}
+		if w <= 0 || h <= 0 {
+			f := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+			if len(f) != 4 {
+				return 0, 0, false
+			}
+			w, _ = strconv.ParseFloat(f[2], 64)
+			h, _ = strconv.ParseFloat(f[3], 64)
+		}
+		if w <= 0 || h <= 0 {
+			return 0, 0, false
+		}
+		return int(w + 0.5), int(h + 0.5), true
+	}
+}
+
+// svgLength parses a width or height in user units or px. Other units
+// (%, em, ...) return 0, falling back to the viewBox.
+func svgLength(v string) float64 {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestIsImage(t *testing.T) {
+	for p, want := range map[string]bool{
+		"logo.png":       true,
+		"a/b/Photo.JPEG": true,
+		"icon.svg":       true,
+		"anim.webp":      true,
+		"main.go":        false,
+		"archive.tar.gz": false,
+		"png":            false,
+	} {
+		if got := IsImage(p); got != want {
+			t.Errorf("IsImage(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestImageSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 12, 7))); err != nil {
+		t.Fatal(err)
+	}
+	// RIFF header, VP8X chunk with flags and 24-bit width-1/height-1.
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x1f\x00\x00\x0f\x00\x00")
+
+	tests := []struct {
+		name string
+		data []byte
+		w, h int
+		ok   bool
+	}{
+		{"a.png", buf.Bytes(), 12, 7, true},
+		{"a.webp", webp, 32, 16, true},
+		{"a.svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="24px" height="10"/>`), 24, 10, true},
+		{"a.svg", []byte(`<svg viewBox="0 0 100.4 50" width="100%"></svg>`), 100, 50, true},
+		{"a.svg", []byte(`<html></html>`), 0, 0, false},
+		{"a.png", []byte("not a png"), 0, 0, false},
+	}
+	for _, tt := range tests {
+		w, h, ok := ImageSize(tt.name, tt.data)
+		if w != tt.w || h != tt.h || ok != tt.ok {
+			t.Errorf("ImageSize(%s, %.20q) = %d, %d, %v; want %d, %d, %v", tt.name, tt.data, w, h, ok, tt.w, tt.h, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package diff
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Kind classifies a changeset. Files of any kind other than KindSource are
+// not highlighted by default.
+type Kind string
+
+const (
+	KindSource    Kind = ""
+	KindGenerated Kind = "generated"
+	KindVendored  Kind = "vendored"
+	KindLockfile  Kind = "lockfile"
+	KindBinary    Kind = "binary"
+)
+
+// lockfiles are dependency lock files, by base name.
+var lockfiles = map[string]bool{
+	"go.sum":              true,
+	"go.work.sum":         true,
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"bun.lockb":           true,
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"composer.lock":       true,
+	"poetry.lock":         true,
+	"Pipfile.lock":        true,
+	"uv.lock":             true,
+	"flake.lock":          true,
+	"mix.lock":            true,
+	"Podfile.lock":        true,
+	"pubspec.lock":        true,
+	"packages.lock.json":  true,
+	"gradle.lockfile":     true,
+}
+
+// vendorDirs are directory names whose contents are third-party code.
+var vendorDirs = map[string]bool{
+	"vendor":           true,
+	"node_modules":     true,
+	"third_party":      true,
+	"bower_components": true,
+}
+
+// generatedSuffixes are file name endings of common generator output.
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", ".pb.cc", ".pb.h", "_pb2.py", "_pb2_grpc.py", ".pb.swift",
+	".min.js", ".min.css", ".js.map", ".css.map",
+	".g.dart", ".freezed.dart",
+	"_gen.go", ".gen.go",
+}
+
+// generatedHeader matches the Go convention ("// Code generated ... DO NOT
+// EDIT.", https://go.dev/s/generatedcode) in any comment style, and the
+// "@generated" marker used by other tools.
+var generatedHeader = regexp.MustCompile(`^\s*(?://|#|/?\*|--|;)\s*(?:Code generated .* DO NOT EDIT\.?|.*@generated\b)`)
+
+// generatedHeaderLines is how far into a file the header is looked for.
+const generatedHeaderLines = 20
+
+// Classify sets Kind on each changeset. Explicit linguist-generated and
+// linguist-vendored attributes in attrs (which may be nil) win over the
+// built-in heuristics: binary diffs, lock file names, vendor directories,
+// generator file suffixes and a generated-code header in the diff.
+func Classify(changesets []Changeset, attrs *GitAttributes) {
+	for i := range changesets {
+		changesets[i].Kind = classify(&changesets[i], attrs)
+	}
+}
+
+func classify(cs *Changeset, attrs *GitAttributes) Kind {
+	p := cs.DisplayPath()
+	generated, genSet := attrs.Lookup(p, "linguist-generated")
+	vendored, vendSet := attrs.Lookup(p, "linguist-vendored")
+	binary, binSet := attrs.Lookup(p, "binary")
+	switch {
+	case genSet && generated:
+		return KindGenerated
+	case vendSet && vendored:
+		return KindVendored
+	case cs.IsBinary || (binSet && binary):
+		return KindBinary
+	case lockfiles[path.Base(p)]:
+		return KindLockfile
+	case !vendSet && inVendorDir(p):
+		return KindVendored
+	case !genSet && (hasGeneratedSuffix(p) || hasGeneratedHeader(cs)):
+		return KindGenerated
+	}
+	return KindSource
+}
+
+func inVendorDir(p string) bool {
+	dirs := strings.Split(path.Dir(p), "/")
+	for _, d := range dirs {
+		if vendorDirs[d] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGeneratedSuffix(p string) bool {
+	base := path.Base(p)
+	for _, s := range generatedSuffixes {
+		if strings.HasSuffix(base, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGeneratedHeader looks for a generated-code comment among the first
+// lines of the file that appear in the diff (the old side for deletions).
+func hasGeneratedHeader(cs *Changeset) bool {
+	for _, h := range cs.Hunks {
+		for _, l := range h.Lines {
+			n := l.NewNum
+			if cs.IsDeleted {
+				n = l.OldNum
+			}
+			if n == 0 {
+				continue
+			}
+			if n > generatedHeaderLines {
+				break
+			}
+			if generatedHeader.MatchString(l.Content) {
+				return true
+			}
+		}
+	}
+	return false
+}
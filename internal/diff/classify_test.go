@@ -0,0 +1,78 @@
+package diff
+
+import "testing"
+
+func TestGitAttributesLookup(t *testing.T) {
+	attrs := ParseGitAttributes(`# comment
+*.pb.go linguist-generated
+/api/gen/** linguist-generated=true
+docs/*.md -linguist-generated
+third_party/** linguist-vendored=false
+assets/*.bin binary
+`)
+	tests := []struct {
+		path, attr   string
+		value, found bool
+	}{
+		{"foo.pb.go", "linguist-generated", true, true},
+		{"a/b/foo.pb.go", "linguist-generated", true, true},
+		{"api/gen/x/y.go", "linguist-generated", true, true},
+		{"other/api/gen/y.go", "linguist-generated", false, false},
+		{"docs/readme.md", "linguist-generated", false, true},
+		{"docs/sub/readme.md", "linguist-generated", false, false},
+		{"third_party/lib/a.c", "linguist-vendored", false, true},
+		{"assets/logo.bin", "binary", true, true},
+		{"main.go", "linguist-generated", false, false},
+	}
+	for _, tt := range tests {
+		v, ok := attrs.Lookup(tt.path, tt.attr)
+		if v != tt.value || ok != tt.found {
+			t.Errorf("Lookup(%q, %q) = %v, %v; want %v, %v", tt.path, tt.attr, v, ok, tt.value, tt.found)
+		}
+	}
+
+	var none *GitAttributes
+	if _, ok := none.Lookup("x", "binary"); ok {
+		t.Error("nil attributes should have no values")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	header := func(name, first string) Changeset {
+		return Changeset{NewName: name, Hunks: []Hunk{{Lines: []Line{
+			{Type: Added, NewNum: 1, Content: first},
+			{Type: Added, NewNum: 2, Content: ""},
+			{Type: Added, NewNum: 3, Content: "package x"},
+		}}}}
+	}
+	changesets := []Changeset{
+		{NewName: "go.sum"},
+		{NewName: "vendor/github.com/x/y/z.go"},
+		{NewName: "web/node_modules/a/index.js"},
+		{NewName: "api/v1/service.pb.go"},
+		{NewName: "static/app.min.js"},
+		header("zz_deepcopy.go", "// Code generated by controller-gen. DO NOT EDIT."),
+		header("schema.sql", "-- @generated by sqlc"),
+		header("main.go", "// Package main does things."),
+		{NewName: "logo.png", IsBinary: true},
+		{NewName: "third_party/ours/lib.go"},
+		{NewName: "internal/wire.go"},
+	}
+	attrs := ParseGitAttributes("third_party/ours/** linguist-vendored=false\ninternal/wire.go linguist-generated\n")
+	Classify(changesets, attrs)
+
+	want := []Kind{
+		KindLockfile, KindVendored, KindVendored, KindGenerated, KindGenerated,
+		KindGenerated, KindGenerated, KindSource, KindBinary, KindSource, KindGenerated,
+	}
+	for i, cs := range changesets {
+		if cs.Kind != want[i] {
+			t.Errorf("%s: kind = %q, want %q", cs.DisplayPath(), cs.Kind, want[i])
+		}
+	}
+
+	plan := DefaultLimits.Plan(changesets)
+	if plan[0] != string(KindLockfile) || plan[7] != "" || plan[8] != "" {
+		t.Errorf("plan = %q", plan)
+	}
+}
@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// ContextRows returns highlighted context rows for lines start..end
+// (1-indexed, inclusive) of one side of cs, read from that side's full file
+// content. Lines outside the hunks are the same on both sides, so the other
+// side's line number follows from the nearest preceding hunk. The range is
+// clamped to the file and must not overlap a hunk.
+func ContextRows(cs Changeset, oldSide bool, content string, start, end int) ([]DiffRow, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	start = max(start, 1)
+	end = min(end, len(lines))
+	if start > end {
+		return nil, nil
+	}
+	for _, h := range cs.Hunks {
+		hStart, hCount := h.NewStart, h.NewCount
+		if oldSide {
+			hStart, hCount = h.OldStart, h.OldCount
+		}
+		if hCount > 0 && start < hStart+hCount && end >= hStart {
+			return nil, fmt.Errorf("lines %d-%d overlap the hunk at line %d", start, end, hStart)
+		}
+	}
+
+	// offset maps a line on the requested side to the other side.
+	offset := 0
+	for _, h := range cs.Hunks {
+		from, to := hunkEnd(h.NewStart, h.NewCount), hunkEnd(h.OldStart, h.OldCount)
+		if oldSide {
+			from, to = to, from
+		}
+		if from > start {
+			break
+		}
+		offset = to - from
+	}
+
+	// The whole file is tokenized, so the rows highlight as they do in the
+	// diff, e.g. inside a string or comment opened above them.
+	tokens := tokenizeLines(cs.DisplayPath(), lines)
+	rows := make([]DiffRow, end-start+1)
+	for i := range rows {
+		n := start + i
+		hl := formatLine(tokens[n-1], lines[n-1], nil)
+		row := DiffRow{
+			OldNum:     n + offset,
+			NewNum:     n,
+			OldContent: template.HTML(hl),
+			NewContent: template.HTML(hl),
+			IsContext:  true,
+		}
+		if oldSide {
+			row.OldNum, row.NewNum = n, n+offset
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// hunkEnd returns the first line after a hunk side. An empty side's start
+// is the line before the hunk, as in "@@ -5,3 +4,0 @@".
+func hunkEnd(start, count int) int {
+	if count == 0 {
+		return start + 1
+	}
+	return start + count
+}
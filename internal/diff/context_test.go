@@ -0,0 +1,61 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContextRowsLineMapping(t *testing.T) {
+	// Two lines inserted after old line 2, and old lines 8-9 deleted.
+	cs := Changeset{
+		NewName: "notes.txt",
+		Hunks: []Hunk{
+			{OldStart: 2, OldCount: 0, NewStart: 3, NewCount: 2},
+			{OldStart: 8, OldCount: 2, NewStart: 9, NewCount: 0},
+		},
+	}
+	newFile := "1\n2\nx\ny\n3\n4\n5\n6\n7\n10\n11\n"
+
+	rows, err := ContextRows(cs, false, newFile, 5, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0].NewNum != 5 || rows[0].OldNum != 3 || string(rows[0].NewContent) != "3" {
+		t.Fatalf("rows = %+v", rows)
+	}
+
+	rows, err = ContextRows(cs, false, newFile, 10, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].NewNum != 10 || rows[0].OldNum != 10 || rows[1].OldNum != 11 {
+		t.Errorf("rows after deletion = %+v", rows)
+	}
+
+	oldFile := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n"
+	rows, err = ContextRows(cs, true, oldFile, 10, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].OldNum != 10 || rows[0].NewNum != 10 {
+		t.Errorf("old side rows = %+v", rows)
+	}
+
+	if _, err := ContextRows(cs, false, newFile, 2, 4); err == nil {
+		t.Error("expected an error for a range overlapping a hunk")
+	}
+}
+
+func TestContextRowsHighlightWithinFile(t *testing.T) {
+	// Line 3 is inside a block comment opened on line 2.
+	cs := Changeset{NewName: "main.go", Hunks: []Hunk{{OldStart: 6, OldCount: 1, NewStart: 6, NewCount: 1}}}
+	content := "package main\n/*\nfunc notCode() {}\n*/\nvar x = 1\nvar y = 2\n"
+
+	rows, err := ContextRows(cs, false, content, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !strings.Contains(string(rows[0].NewContent), `class="cm"`) {
+		t.Errorf("rows = %+v, want line 3 highlighted as a comment", rows)
+	}
+}
@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GitAttributes holds the linguist attributes of a .gitattributes file.
+// Only the attributes that affect classification are kept.
+type GitAttributes struct {
+	rules []attrRule
+}
+
+type attrRule struct {
+	pattern *regexp.Regexp
+	attrs   map[string]bool // attribute -> set (true) or unset (false)
+}
+
+// linguistAttrs are the attributes GitAttributes keeps.
+var linguistAttrs = map[string]bool{
+	"linguist-generated": true,
+	"linguist-vendored":  true,
+	"binary":             true,
+}
+
+// ParseGitAttributes parses .gitattributes content. Lines that can't be
+// parsed are skipped, as git does.
+func ParseGitAttributes(content string) *GitAttributes {
+	a := &GitAttributes{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		attrs := make(map[string]bool)
+		for _, f := range fields[1:] {
+			name, value := f, true
+			switch {
+			case strings.HasPrefix(f, "-"):
+				name, value = f[1:], false
+			case strings.HasPrefix(f, "!"):
+				name, value = f[1:], false // unspecified: treat as unset
+			case strings.Contains(f, "="):
+				var v string
+				name, v, _ = strings.Cut(f, "=")
+				value = v == "true" || v == "1"
+			}
+			if linguistAttrs[name] {
+				attrs[name] = value
+			}
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		re, err := attrPattern(fields[0])
+		if err != nil {
+			continue
+		}
+		a.rules = append(a.rules, attrRule{pattern: re, attrs: attrs})
+	}
+	return a
+}
+
+// Lookup returns the value of attr for path and whether any rule sets it.
+// Later lines override earlier ones. A nil receiver has no attributes.
+func (a *GitAttributes) Lookup(path, attr string) (value, ok bool) {
+	if a == nil {
+		return false, false
+	}
+	for i := len(a.rules) - 1; i >= 0; i-- {
+		r := a.rules[i]
+		if v, has := r.attrs[attr]; has && r.pattern.MatchString(path) {
+			return v, true
+		}
+	}
+	return false, false
+}
+
+// attrPattern compiles a gitattributes pattern. A pattern without a slash
+// matches the file name at any depth; otherwise it is anchored at the
+// repository root. "**" matches across directories.
+func attrPattern(p string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(p, "/"), "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "/**") && i+3 == len(p):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -23,6 +23,66 @@ var (
 // HighlightLines takes a filename and a slice of raw source lines,
 // returning syntax-highlighted HTML for each line. The indices match 1:1.
 func HighlightLines(filename string, lines []string) []string {
+	tokenLines := tokenizeLines(filename, lines)
+	result := make([]string, len(lines))
+	for i := range lines {
+		result[i] = formatLine(tokenLines[i], lines[i], nil)
+	}
+	return result
+}
+
+// FileSources are the full contents of a changeset's file before and after
+// the change. Diff lines are highlighted as part of the whole file, so a
+// string or comment opened outside the diff is highlighted correctly. A
+// side that wasn't loaded has its Has flag false.
+type FileSources struct {
+	Old, New       string
+	HasOld, HasNew bool
+}
+
+// sideLine is a displayed line of one side of a changeset.
+type sideLine struct {
+	num     int // line number in the file
+	content string
+}
+
+// highlightSide tokenizes one side's displayed lines, grouped by hunk, and
+// returns their tokens in order. With the full file each line's tokens are
+// sliced from the file's. Without it, and for lines that don't match the
+// file, each hunk is tokenized on its own so that hunks don't bleed into
+// each other.
+func highlightSide(filename string, hunks [][]sideLine, full string, hasFull bool) [][]chroma.Token {
+	var fileLines []string
+	var fileTok [][]chroma.Token
+	if hasFull {
+		fileLines = strings.Split(full, "\n")
+		fileTok = tokenizeLines(filename, fileLines)
+	}
+	var out [][]chroma.Token
+	for _, h := range hunks {
+		var hunkTok [][]chroma.Token
+		for i, l := range h {
+			if n := l.num - 1; hasFull && n >= 0 && n < len(fileLines) && fileLines[n] == l.content {
+				out = append(out, fileTok[n])
+				continue
+			}
+			if hunkTok == nil {
+				contents := make([]string, len(h))
+				for j, hl := range h {
+					contents[j] = hl.content
+				}
+				hunkTok = tokenizeLines(filename, contents)
+			}
+			out = append(out, hunkTok[i])
+		}
+	}
+	return out
+}
+
+// tokenizeLines lexes the lines as one source and splits the tokens back into
+// lines. A nil entry means the line could not be tokenized.
+func tokenizeLines(filename string, lines []string) [][]chroma.Token {
+	out := make([][]chroma.Token, len(lines))
 	lexer := lexers.Match(filename)
 	if lexer == nil {
 		lexer = lexers.Fallback
@@ -32,28 +92,86 @@ func HighlightLines(filename string, lines []string) []string {
 	source := strings.Join(lines, "\n")
 	iter, err := lexer.Tokenise(nil, source)
 	if err != nil {
-		return escapeLines(lines)
+		return out
 	}
 
 	// Split tokens into per-line groups.
 	allTokens := iter.Tokens()
 	tokenLines := splitTokensByLine(allTokens)
+	copy(out, tokenLines)
+	return out
+}
 
-	result := make([]string, len(lines))
-	for i := range lines {
-		if i < len(tokenLines) {
-			var buf bytes.Buffer
-			lineIter := chroma.Literator(tokenLines[i]...)
-			if err := formatter.Format(&buf, style, lineIter); err != nil {
-				result[i] = html.EscapeString(lines[i])
-			} else {
-				result[i] = buf.String()
+// formatLine renders one line's tokens as HTML. Byte ranges in bright are
+// wrapped in <span class="bright"> (Phabricator's intra-line change marker),
+// splitting tokens where a range starts or ends mid-token. If the tokens do
+// not reproduce the line, it is rendered as escaped plain text.
+func formatLine(tokens []chroma.Token, line string, bright []Range) string {
+	var text strings.Builder
+	for _, t := range tokens {
+		text.WriteString(t.Value)
+	}
+	if text.String() != line {
+		if len(bright) == 0 {
+			return html.EscapeString(line)
+		}
+		tokens = []chroma.Token{{Type: chroma.Text, Value: line}}
+	}
+
+	var b strings.Builder
+	var run []chroma.Token
+	runBright := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		var buf bytes.Buffer
+		if err := formatter.Format(&buf, style, chroma.Literator(run...)); err != nil {
+			buf.Reset()
+			for _, t := range run {
+				buf.WriteString(html.EscapeString(t.Value))
 			}
+		}
+		if runBright {
+			b.WriteString(`<span class="bright">`)
+			b.Write(buf.Bytes())
+			b.WriteString(`</span>`)
 		} else {
-			result[i] = html.EscapeString(lines[i])
+			b.Write(buf.Bytes())
 		}
+		run = nil
 	}
-	return result
+
+	pos := 0
+	for _, t := range tokens {
+		for v := t.Value; v != ""; {
+			isBright, n := brightAt(bright, pos, len(v))
+			if isBright != runBright {
+				flush()
+				runBright = isBright
+			}
+			run = append(run, chroma.Token{Type: t.Type, Value: v[:n]})
+			v = v[n:]
+			pos += n
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// brightAt reports whether the byte at pos is inside one of the ranges and
+// how many bytes (at most limit) share that state.
+func brightAt(ranges []Range, pos, limit int) (bool, int) {
+	next := pos + limit
+	for _, r := range ranges {
+		if pos >= r.Start && pos < r.End {
+			return true, min(r.End, next) - pos
+		}
+		if r.Start > pos && r.Start < next {
+			next = r.Start
+		}
+	}
+	return false, next - pos
 }
 
 // splitTokensByLine splits a flat token slice into per-line groups.
@@ -82,14 +200,6 @@ func splitTokensByLine(tokens []chroma.Token) [][]chroma.Token {
 	return lines
 }
 
-func escapeLines(lines []string) []string {
-	out := make([]string, len(lines))
-	for i, l := range lines {
-		out[i] = html.EscapeString(l)
-	}
-	return out
-}
-
 // FileIcon returns a Font Awesome icon class for a filename.
 func FileIcon(filename string) string {
 	switch filepath.Ext(filename) {
@@ -0,0 +1,61 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildDiffRowsHighlightsAgainstFullFile(t *testing.T) {
+	full := `package x
+
+/*
+var commented = 1
+var changed = 2
+*/
+
+var live = 3
+`
+	raw := `diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -4,2 +4,2 @@
+ var commented = 1
+-var changed = 1
++var changed = 2
+`
+	changesets, err := ParseDiff(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := changesets[0]
+
+	rows := BuildDiffRows(cs, FileSources{New: full, HasNew: true})
+	if got := string(rows[0].NewContent); !strings.Contains(got, `class="cm"`) {
+		t.Errorf("line inside a block comment opened above the hunk = %s, want comment highlighting", got)
+	}
+	// The old side wasn't loaded: its lines are tokenized alone, as code.
+	if got := string(rows[1].OldContent); strings.Contains(got, `class="cm"`) {
+		t.Errorf("old side without the file = %s, want code highlighting", got)
+	}
+}
+
+func TestBuildDiffRowsHunksDoNotBleed(t *testing.T) {
+	raw := `diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1,1 +1,1 @@
+-a := 1 /* open
++a := 2 /* open
+@@ -20,1 +20,1 @@
+-var b = 1
++var b = 2
+`
+	changesets, err := ParseDiff(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := BuildDiffRows(changesets[0], FileSources{})
+	if got := string(rows[1].NewContent); strings.Contains(got, `class="cm"`) {
+		t.Errorf("second hunk = %s, want no comment carried over from the first", got)
+	}
+}
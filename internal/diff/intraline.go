@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// intralineMinSimilarity is the share of unchanged text (as in difflib's
+	// ratio) a paired line needs before word-level changes are marked. Below
+	// it the lines are unrelated and only the row is highlighted.
+	intralineMinSimilarity = 0.5
+
+	// intralineMaxCells bounds the word-level LCS table.
+	intralineMaxCells = 200 * 200
+)
+
+// Range is a half-open byte range [Start, End) within a line.
+type Range struct {
+	Start int
+	End   int
+}
+
+// IntralineRanges returns the byte ranges that differ between a removed line
+// and the added line it is paired with. ok is false when the lines are too
+// dissimilar (or too long) for word-level markers to be useful.
+func IntralineRanges(oldLine, newLine string) (oldRanges, newRanges []Range, ok bool) {
+	if oldLine == newLine {
+		return nil, nil, true
+	}
+	a, b := splitWords(oldLine), splitWords(newLine)
+	if len(a)*len(b) > intralineMaxCells {
+		return nil, nil, false
+	}
+
+	keepA, keepB := lcs(a, b)
+	common := 0
+	for i, w := range a {
+		if keepA[i] {
+			common += len(w)
+		}
+	}
+	if float64(2*common) < intralineMinSimilarity*float64(len(oldLine)+len(newLine)) {
+		return nil, nil, false
+	}
+	return changedRanges(a, keepA), changedRanges(b, keepB), true
+}
+
+// splitWords breaks a line into identifier-like words, runs of whitespace and
+// single punctuation characters. Concatenating the result yields the line.
+func splitWords(s string) []string {
+	var words []string
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		j := i + size
+		switch {
+		case isWordRune(r):
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !isWordRune(r) {
+					break
+				}
+				j += size
+			}
+		case unicode.IsSpace(r):
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				j += size
+			}
+		}
+		words = append(words, s[i:j])
+		i = j
+	}
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lcs marks the elements of a and b that belong to a longest common
+// subsequence. It uses O(len(a)*len(b)) memory; callers bound the sizes.
+func lcs(a, b []string) (keepA, keepB []bool) {
+	n, m := len(a), len(b)
+	// dp[i][j] is the LCS length of a[i:] and b[j:].
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+
+	keepA, keepB = make([]bool, n), make([]bool, m)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[i] == b[j]:
+			keepA[i], keepB[j] = true, true
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return keepA, keepB
+}
+
+// changedRanges converts the words not kept by the LCS into byte ranges.
+// Changes separated only by whitespace are merged into one range so that
+// "foo bar" -> "baz qux" reads as a single edit.
+func changedRanges(words []string, keep []bool) []Range {
+	var ranges []Range
+	pos := 0
+	for i, w := range words {
+		end := pos + len(w)
+		if !keep[i] {
+			if n := len(ranges); n > 0 && ranges[n-1].End == pos {
+				ranges[n-1].End = end
+			} else {
+				ranges = append(ranges, Range{Start: pos, End: end})
+			}
+		}
+		pos = end
+	}
+
+	// Bridge whitespace-only gaps between changes.
+	merged := ranges[:0]
+	line := strings.Join(words, "")
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && strings.TrimSpace(line[merged[n-1].End:r.Start]) == "" {
+			merged[n-1].End = r.End
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
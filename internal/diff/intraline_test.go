@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIntralineRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		wantOld  []string
+		wantNew  []string
+		wantOK   bool
+	}{
+		{
+			name:    "single token",
+			old:     "x := compute(a, b)",
+			new:     "x := compute(a, c)",
+			wantOld: []string{"b"},
+			wantNew: []string{"c"},
+			wantOK:  true,
+		},
+		{
+			name:    "adjacent words merge across whitespace",
+			old:     "return foo bar",
+			new:     "return baz qux",
+			wantOld: []string{"foo bar"},
+			wantNew: []string{"baz qux"},
+			wantOK:  true,
+		},
+		{
+			name:    "insertion only",
+			old:     "f(a)",
+			new:     "f(a, b)",
+			wantOld: nil,
+			wantNew: []string{", b"},
+			wantOK:  true,
+		},
+		{
+			name:   "unrelated lines",
+			old:    "import \"fmt\"",
+			new:    "}",
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldR, newR, ok := IntralineRanges(tt.old, tt.new)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got := rangeText(tt.old, oldR); !reflect.DeepEqual(got, tt.wantOld) {
+				t.Errorf("old ranges = %q, want %q", got, tt.wantOld)
+			}
+			if got := rangeText(tt.new, newR); !reflect.DeepEqual(got, tt.wantNew) {
+				t.Errorf("new ranges = %q, want %q", got, tt.wantNew)
+			}
+		})
+	}
+}
+
+func rangeText(s string, ranges []Range) []string {
+	var out []string
+	for _, r := range ranges {
+		out = append(out, s[r.Start:r.End])
+	}
+	return out
+}
+
+func TestFormatLineSplitsTokens(t *testing.T) {
+	line := `name := "hello world"`
+	toks := tokenizeLines("main.go", []string{line})[0]
+	start := strings.Index(line, "world")
+	got := formatLine(toks, line, []Range{{Start: start, End: start + len("world")}})
+
+	if !strings.Contains(got, `<span class="bright">`) {
+		t.Fatalf("no bright marker in %s", got)
+	}
+	bright := got[strings.Index(got, `<span class="bright">`):]
+	if !strings.Contains(bright, "world") || strings.Contains(bright, "hello") {
+		t.Errorf("bright span should cover only %q: %s", "world", got)
+	}
+	if plain := formatLine(toks, line, nil); strings.Contains(plain, "bright") {
+		t.Errorf("unexpected marker without ranges: %s", plain)
+	}
+}
+
+func TestBuildDiffRowsMarksPairedLines(t *testing.T) {
+	cs := Changeset{
+		NewName: "main.go",
+		Hunks: []Hunk{{
+			OldStart: 1, NewStart: 1, OldCount: 2, NewCount: 2,
+			Lines: []Line{
+				{Type: Removed, OldNum: 1, Content: "x := compute(a, b)"},
+				{Type: Removed, OldNum: 2, Content: "import \"fmt\""},
+				{Type: Added, NewNum: 1, Content: "x := compute(a, c)"},
+				{Type: Added, NewNum: 2, Content: "}"},
+			},
+		}},
+	}
+	rows := BuildDiffRows(cs, FileSources{})
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if !strings.Contains(string(rows[0].OldContent), "bright") || !strings.Contains(string(rows[0].NewContent), "bright") {
+		t.Errorf("similar pair not marked: %+v", rows[0])
+	}
+	if strings.Contains(string(rows[1].OldContent), "bright") || strings.Contains(string(rows[1].NewContent), "bright") {
+		t.Errorf("dissimilar pair should fall back to whole-line: %+v", rows[1])
+	}
+}
@@ -0,0 +1,50 @@
+package diff
+
+// Limits bounds how much of a diff is highlighted up front. Changesets over a
+// limit are returned as metadata only and rendered on demand.
+type Limits struct {
+	MaxFileLines  int // changesets with more hunk lines than this are deferred
+	MaxTotalLines int // changesets that would render past this total are deferred
+}
+
+// DefaultLimits keeps a PR response to a few megabytes of HTML.
+var DefaultLimits = Limits{MaxFileLines: 2000, MaxTotalLines: 20000}
+
+// Reasons a changeset is deferred. Generated, vendored and lock files are
+// deferred with their Kind as the reason.
+const (
+	DeferTooLarge = "too_large" // the file alone exceeds MaxFileLines
+	DeferBudget   = "budget"    // earlier files used up MaxTotalLines
+)
+
+// RenderedLines returns the number of diff lines the changeset renders.
+func (c *Changeset) RenderedLines() int {
+	n := 0
+	for _, h := range c.Hunks {
+		n += len(h.Lines)
+	}
+	return n
+}
+
+// Plan decides which changesets to render now. It returns one entry per
+// changeset: "" to render it, or the reason it is deferred. Changesets are
+// considered in order, so the first files of a large diff are still shown.
+// Classified files (see Classify) are always deferred.
+func (l Limits) Plan(changesets []Changeset) []string {
+	plan := make([]string, len(changesets))
+	total := 0
+	for i := range changesets {
+		n := changesets[i].RenderedLines()
+		switch kind := changesets[i].Kind; {
+		case kind == KindGenerated || kind == KindVendored || kind == KindLockfile:
+			plan[i] = string(kind)
+		case l.MaxFileLines > 0 && n > l.MaxFileLines:
+			plan[i] = DeferTooLarge
+		case l.MaxTotalLines > 0 && total+n > l.MaxTotalLines:
+			plan[i] = DeferBudget
+		default:
+			total += n
+		}
+	}
+	return plan
+}
@@ -0,0 +1,28 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func changesetWithLines(id, n int) Changeset {
+	lines := make([]Line, n)
+	for i := range lines {
+		lines[i] = Line{Type: Added, NewNum: i + 1, Content: "x"}
+	}
+	return Changeset{ID: id, NewName: "f", Hunks: []Hunk{{Lines: lines}}}
+}
+
+func TestLimitsPlan(t *testing.T) {
+	l := Limits{MaxFileLines: 100, MaxTotalLines: 150}
+	got := l.Plan([]Changeset{
+		changesetWithLines(1, 80),
+		changesetWithLines(2, 500), // too large on its own
+		changesetWithLines(3, 90),  // would exceed the total
+		changesetWithLines(4, 70),  // still fits
+	})
+	want := []string{"", DeferTooLarge, DeferBudget, ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package diff
+
+// minMoveLines is the shortest block of lines reported as a move.
+const minMoveLines = 3
+
+// lineRef addresses a line within a changeset list.
+type lineRef struct {
+	cs, hunk, line int
+}
+
+// detectMoves finds blocks of at least minMoveLines consecutive removed
+// lines that reappear as consecutive added lines, in the same file or in
+// another changeset, and links both sides through Line.Move. Lines are
+// compared with whitespace collapsed. A removed block is not matched against
+// the added lines directly replacing it; those are ordinary edits.
+func detectMoves(changesets []Changeset) {
+	// Index added lines by normalized content. Trivial lines such as "}"
+	// can't start a block but may continue one.
+	added := make(map[string][]lineRef)
+	for ci, cs := range changesets {
+		for hi, h := range cs.Hunks {
+			for li, l := range h.Lines {
+				if l.Type != Added {
+					continue
+				}
+				if n := normalizeSpace(l.Content); !trivialLine(n) {
+					added[n] = append(added[n], lineRef{ci, hi, li})
+				}
+			}
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	for ci := range changesets {
+		for hi := range changesets[ci].Hunks {
+			lines := changesets[ci].Hunks[hi].Lines
+			for li := 0; li < len(lines); {
+				if lines[li].Type != Removed {
+					li++
+					continue
+				}
+				// The removed run is lines[li:runEnd]; the added lines that
+				// replace it are lines[runEnd:blockEnd].
+				runEnd := li
+				for runEnd < len(lines) && lines[runEnd].Type == Removed {
+					runEnd++
+				}
+				blockEnd := runEnd
+				for blockEnd < len(lines) && lines[blockEnd].Type == Added {
+					blockEnd++
+				}
+				for li < runEnd {
+					src := lineRef{ci, hi, li}
+					dst, n := longestMove(changesets, added, src, runEnd, blockEnd)
+					if n < minMoveLines {
+						li++
+						continue
+					}
+					linkMove(changesets, src, dst, n)
+					li += n
+				}
+				li = blockEnd
+			}
+		}
+	}
+}
+
+// longestMove finds the longest unclaimed added block matching the removed
+// lines starting at src (which end at runEnd).
+func longestMove(changesets []Changeset, added map[string][]lineRef, src lineRef, runEnd, blockEnd int) (lineRef, int) {
+	srcLines := changesets[src.cs].Hunks[src.hunk].Lines
+	if srcLines[src.line].Move != nil {
+		return lineRef{}, 0
+	}
+	var best lineRef
+	bestLen := 0
+	for _, dst := range added[normalizeSpace(srcLines[src.line].Content)] {
+		if dst.cs == src.cs && dst.hunk == src.hunk && dst.line >= runEnd && dst.line < blockEnd {
+			continue
+		}
+		dstLines := changesets[dst.cs].Hunks[dst.hunk].Lines
+		n := 0
+		for src.line+n < runEnd && dst.line+n < len(dstLines) {
+			s, d := srcLines[src.line+n], dstLines[dst.line+n]
+			if d.Type != Added || d.Move != nil || s.Move != nil ||
+				normalizeSpace(s.Content) != normalizeSpace(d.Content) {
+				break
+			}
+			n++
+		}
+		if n > bestLen {
+			best, bestLen = dst, n
+		}
+	}
+	return best, bestLen
+}
+
+// linkMove marks n lines from src (removed) and dst (added) as moved.
+func linkMove(changesets []Changeset, src, dst lineRef, n int) {
+	srcCS, dstCS := &changesets[src.cs], &changesets[dst.cs]
+	srcLines := srcCS.Hunks[src.hunk].Lines
+	dstLines := dstCS.Hunks[dst.hunk].Lines
+	for k := 0; k < n; k++ {
+		s, d := &srcLines[src.line+k], &dstLines[dst.line+k]
+		s.Move = &Move{Dir: "to", Changeset: dstCS.ID, Path: dstCS.DisplayPath(), Line: d.NewNum}
+		d.Move = &Move{Dir: "from", Changeset: srcCS.ID, Path: srcCS.DisplayPath(), Line: s.OldNum}
+	}
+}
+
+// trivialLine reports whether a normalized line has too little content
+// (fewer than three letters or digits) to anchor a move.
+func trivialLine(s string) bool {
+	n := 0
+	for _, r := range s {
+		if isWordRune(r) {
+			n++
+			if n >= 3 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package diff
+
+import "strings"
+
+// Options selects optional transformations of parsed changesets.
+type Options struct {
+	IgnoreWhitespace bool // show whitespace-only changes as context
+	DetectMoves      bool // link blocks of lines moved within or across files
+}
+
+// Apply returns copies of changesets with the transformations in opts
+// applied; the input is not modified. Whitespace is handled first, and move
+// detection compares lines with whitespace collapsed, so reindented blocks
+// are still found.
+func Apply(changesets []Changeset, opts Options) []Changeset {
+	out := make([]Changeset, len(changesets))
+	for i, cs := range changesets {
+		hunks := make([]Hunk, len(cs.Hunks))
+		for j, h := range cs.Hunks {
+			h.Lines = append([]Line(nil), h.Lines...)
+			if opts.IgnoreWhitespace {
+				h.Lines = collapseWhitespace(h.Lines)
+			}
+			hunks[j] = h
+		}
+		cs.Hunks = hunks
+		if opts.IgnoreWhitespace {
+			// The stats count what is shown: collapsed lines are context.
+			cs.LinesAdded, cs.LinesRemoved = countLines(hunks)
+		}
+		out[i] = cs
+	}
+	if opts.DetectMoves {
+		detectMoves(out)
+	}
+	return out
+}
+
+// countLines counts the added and removed lines of hunks.
+func countLines(hunks []Hunk) (added, removed int) {
+	for _, h := range hunks {
+		for _, l := range h.Lines {
+			switch l.Type {
+			case Added:
+				added++
+			case Removed:
+				removed++
+			}
+		}
+	}
+	return added, removed
+}
+
+// normalizeSpace collapses runs of whitespace and trims the ends, like
+// `git diff --ignore-space-change` plus leading whitespace.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
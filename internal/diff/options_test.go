@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestApplyIgnoreWhitespace(t *testing.T) {
+	cs := Changeset{
+		NewName:      "main.go",
+		LinesAdded:   3,
+		LinesRemoved: 3,
+		Hunks: []Hunk{{
+			OldStart: 1, NewStart: 1, OldCount: 3, NewCount: 3,
+			Lines: []Line{
+				{Type: Removed, OldNum: 1, Content: "if ok {"},
+				{Type: Removed, OldNum: 2, Content: "  run()"},
+				{Type: Removed, OldNum: 3, Content: "}"},
+				{Type: Added, NewNum: 1, Content: "if ok {"},
+				{Type: Added, NewNum: 2, Content: "\trun(ctx)"},
+				{Type: Added, NewNum: 3, Content: "}  "},
+			},
+		}},
+	}
+	applied := Apply([]Changeset{cs}, Options{IgnoreWhitespace: true})[0]
+	got := applied.Hunks[0].Lines
+
+	want := []Line{
+		{Type: Context, OldNum: 1, NewNum: 1, Content: "if ok {"},
+		{Type: Removed, OldNum: 2, Content: "  run()"},
+		{Type: Added, NewNum: 2, Content: "\trun(ctx)"},
+		{Type: Context, OldNum: 3, NewNum: 3, Content: "}  "},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if applied.LinesAdded != 1 || applied.LinesRemoved != 1 {
+		t.Errorf("stats +%d -%d, want +1 -1", applied.LinesAdded, applied.LinesRemoved)
+	}
+	if cs.Hunks[0].Lines[0].Type != Removed {
+		t.Error("Apply modified its input")
+	}
+}
+
+func TestApplyIgnoreWhitespaceLargeBlock(t *testing.T) {
+	// Too large for one LCS table: the reindented lines around the edit
+	// must still collapse.
+	var lines []Line
+	const n = 1000
+	for i := 1; i <= n; i++ {
+		lines = append(lines, Line{Type: Removed, OldNum: i, Content: fmt.Sprintf("x%d()", i)})
+	}
+	for i := 1; i <= n; i++ {
+		content := fmt.Sprintf("\tx%d()", i)
+		if i == n/2 {
+			content = "\tchanged()"
+		}
+		lines = append(lines, Line{Type: Added, NewNum: i, Content: content})
+	}
+	cs := Changeset{NewName: "f.go", LinesAdded: n, LinesRemoved: n, Hunks: []Hunk{{Lines: lines}}}
+
+	got := Apply([]Changeset{cs}, Options{IgnoreWhitespace: true})[0]
+	if got.LinesAdded != 1 || got.LinesRemoved != 1 || len(got.Hunks[0].Lines) != n+1 {
+		t.Errorf("+%d -%d in %d lines, want +1 -1 in %d", got.LinesAdded, got.LinesRemoved, len(got.Hunks[0].Lines), n+1)
+	}
+}
+
+func TestApplyDetectMoves(t *testing.T) {
+	block := []string{"func helper() error {", "\treturn doWork()", "}"}
+	from := Changeset{ID: 1, OldName: "a.go", NewName: "a.go", Hunks: []Hunk{{Lines: []Line{
+		{Type: Context, OldNum: 9, NewNum: 9, Content: "// a"},
+		{Type: Removed, OldNum: 10, Content: block[0]},
+		{Type: Removed, OldNum: 11, Content: block[1]},
+		{Type: Removed, OldNum: 12, Content: block[2]},
+	}}}}
+	to := Changeset{ID: 2, OldName: "b.go", NewName: "b.go", Hunks: []Hunk{{Lines: []Line{
+		{Type: Added, NewNum: 40, Content: "  " + block[0]},
+		{Type: Added, NewNum: 41, Content: block[1]},
+		{Type: Added, NewNum: 42, Content: block[2]},
+		{Type: Added, NewNum: 43, Content: "var unrelated = 1"},
+	}}}}
+
+	out := Apply([]Changeset{from, to}, Options{DetectMoves: true})
+	removed := out[0].Hunks[0].Lines
+	added := out[1].Hunks[0].Lines
+
+	if removed[0].Move != nil {
+		t.Errorf("context line marked moved: %+v", removed[0].Move)
+	}
+	for k := 0; k < 3; k++ {
+		m := removed[1+k].Move
+		if m == nil || m.Dir != "to" || m.Changeset != 2 || m.Path != "b.go" || m.Line != 40+k {
+			t.Errorf("removed line %d move = %+v", k, m)
+		}
+		m = added[k].Move
+		if m == nil || m.Dir != "from" || m.Changeset != 1 || m.Path != "a.go" || m.Line != 10+k {
+			t.Errorf("added line %d move = %+v", k, m)
+		}
+	}
+	if added[3].Move != nil {
+		t.Errorf("unrelated line marked moved: %+v", added[3].Move)
+	}
+
+	rows := BuildDiffRows(out[1], FileSources{})
+	if rows[0].NewMove == nil || rows[0].NewMove.Line != 10 {
+		t.Errorf("row move not carried: %+v", rows[0])
+	}
+}
+
+func TestDetectMovesSkipsReplacement(t *testing.T) {
+	// The same lines removed and re-added in place are an edit, not a move.
+	cs := Changeset{ID: 1, NewName: "a.go", Hunks: []Hunk{{Lines: []Line{
+		{Type: Removed, OldNum: 1, Content: "alpha beta"},
+		{Type: Removed, OldNum: 2, Content: "gamma delta"},
+		{Type: Removed, OldNum: 3, Content: "epsilon zeta"},
+		{Type: Added, NewNum: 1, Content: "alpha beta"},
+		{Type: Added, NewNum: 2, Content: "gamma delta"},
+		{Type: Added, NewNum: 3, Content: "epsilon zeta"},
+	}}}}
+	for _, l := range Apply([]Changeset{cs}, Options{DetectMoves: true})[0].Hunks[0].Lines {
+		if l.Move != nil {
+			t.Errorf("line %+v marked moved", l)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package diff
 
 import (
+	"strconv"
 	"strings"
 
 	godiff "github.com/sourcegraph/go-diff/diff"
@@ -27,15 +28,10 @@ func ParseDiff(raw string) ([]Changeset, error) {
 		if cs.NewName == "/dev/null" {
 			cs.IsDeleted = true
 		}
-		if !cs.IsNew && !cs.IsDeleted && cs.OldName != cs.NewName {
+		parseExtended(&cs, fd.Extended)
+		if !cs.IsNew && !cs.IsDeleted && !cs.IsCopied && cs.OldName != cs.NewName {
 			cs.IsRenamed = true
 		}
-		for _, ext := range fd.Extended {
-			if strings.Contains(ext, "Binary files") || strings.Contains(ext, "GIT binary patch") {
-				cs.IsBinary = true
-				break
-			}
-		}
 
 		for _, h := range fd.Hunks {
 			hunk := parseHunk(h)
@@ -65,6 +61,7 @@ func parseHunk(h *godiff.Hunk) Hunk {
 		NewStart: int(h.NewStartLine),
 		OldCount: int(h.OrigLines),
 		NewCount: int(h.NewLines),
+		Section:  strings.TrimSpace(h.Section),
 	}
 
 	for _, raw := range bodyLines {
@@ -108,6 +105,42 @@ func parseHunk(h *godiff.Hunk) Hunk {
 	return hunk
 }
 
+// parseExtended reads git's extended header lines (between "diff --git"
+// and "---"): binary markers, copy and rename similarity, and file modes.
+func parseExtended(cs *Changeset, ext []string) {
+	for _, line := range ext {
+		switch {
+		case strings.Contains(line, "Binary files") || strings.Contains(line, "GIT binary patch"):
+			cs.IsBinary = true
+		case strings.HasPrefix(line, "copy from "):
+			cs.IsCopied = true
+		case strings.HasPrefix(line, "similarity index "):
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+			if err == nil {
+				cs.Similarity = n
+			}
+		case strings.HasPrefix(line, "old mode "):
+			cs.OldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			cs.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "new file mode "):
+			cs.NewMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			cs.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "index "):
+			// "index abc123..def456 100644" carries the mode when it didn't change.
+			if f := strings.Fields(line); len(f) == 3 {
+				if cs.OldMode == "" && !cs.IsNew {
+					cs.OldMode = f[2]
+				}
+				if cs.NewMode == "" && !cs.IsDeleted {
+					cs.NewMode = f[2]
+				}
+			}
+		}
+	}
+}
+
 // cleanPath strips the a/ or b/ prefix from diff paths.
 func cleanPath(p string) string {
 	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
@@ -0,0 +1,70 @@
+package diff
+
+import "testing"
+
+func TestParseDiffExtendedHeaders(t *testing.T) {
+	raw := `diff --git a/old.go b/new.go
+similarity index 100%
+rename from old.go
+rename to new.go
+diff --git a/src.go b/dup.go
+similarity index 87%
+copy from src.go
+copy to dup.go
+index 1111111..2222222 100644
+--- a/src.go
++++ b/dup.go
+@@ -1,2 +1,2 @@
+ package x
+-var a = 1
++var b = 1
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/link b/link
+new file mode 120000
+index 0000000..3333333
+--- /dev/null
++++ b/link
+@@ -0,0 +1 @@
++target
+\ No newline at end of file
+diff --git a/main.go b/main.go
+index 4444444..5555555 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package a
++package b
+`
+	changesets, err := ParseDiff(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changesets) != 5 {
+		t.Fatalf("got %d changesets, want 5", len(changesets))
+	}
+
+	type want struct {
+		oldName, newName   string
+		renamed, copied    bool
+		similarity         int
+		oldMode, newMode   string
+		modeChanged, isNew bool
+	}
+	wants := []want{
+		{"old.go", "new.go", true, false, 100, "", "", false, false},
+		{"src.go", "dup.go", false, true, 87, ModeFile, ModeFile, false, false},
+		{"run.sh", "run.sh", false, false, 0, ModeFile, ModeExecutable, true, false},
+		{"/dev/null", "link", false, false, 0, "", ModeSymlink, false, true},
+		{"main.go", "main.go", false, false, 0, ModeFile, ModeFile, false, false},
+	}
+	for i, w := range wants {
+		cs := changesets[i]
+		got := want{cs.OldName, cs.NewName, cs.IsRenamed, cs.IsCopied, cs.Similarity,
+			cs.OldMode, cs.NewMode, cs.ModeChanged(), cs.IsNew}
+		if got != w {
+			t.Errorf("changeset %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	godiff "github.com/sourcegraph/go-diff/diff"
+)
+
+// portMaxCells bounds the LCS table TextChangeset uses between unique-line
+// anchors. Larger gaps stay unmatched, which only turns more comments in
+// them into ghosts.
+const portMaxCells = 1 << 20
+
+// TextChangeset diffs two versions of a file line by line, with no context
+// lines. It is the intermediate diff comments are ported through when the
+// diff they were made on is gone, e.g. after a force push.
+//
+// Common lines are found the way patience diff does: lines unique to both
+// sides anchor the match, and the gaps between anchors are matched by LCS.
+func TextChangeset(oldName, newName, oldText, newText string) Changeset {
+	a, b := splitText(oldText), splitText(newText)
+	keepA, keepB := make([]bool, len(a)), make([]bool, len(b))
+	matchLines(a, b, 0, 0, keepA, keepB)
+
+	cs := Changeset{OldName: oldName, NewName: newName}
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		if i < len(a) && j < len(b) && keepA[i] && keepB[j] {
+			i++
+			j++
+			continue
+		}
+		// Like git with -U0, a hunk that only adds or only removes starts
+		// at the line before it on the side it doesn't touch.
+		h := Hunk{OldStart: i + 1, NewStart: j + 1}
+		for ; i < len(a) && !keepA[i]; i++ {
+			h.Lines = append(h.Lines, Line{Type: Removed, OldNum: i + 1, Content: a[i]})
+			h.OldCount++
+		}
+		for ; j < len(b) && !keepB[j]; j++ {
+			h.Lines = append(h.Lines, Line{Type: Added, NewNum: j + 1, Content: b[j]})
+			h.NewCount++
+		}
+		if h.OldCount == 0 {
+			h.OldStart--
+		}
+		if h.NewCount == 0 {
+			h.NewStart--
+		}
+		cs.LinesRemoved += h.OldCount
+		cs.LinesAdded += h.NewCount
+		cs.Hunks = append(cs.Hunks, h)
+	}
+	return cs
+}
+
+// splitText splits a file into lines without their endings.
+func splitText(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines marks common lines of a and b, which start at offA and offB in
+// the slices keepA and keepB cover.
+func matchLines(a, b []string, offA, offB int, keepA, keepB []bool) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		keepA[offA], keepB[offB] = true, true
+		a, b = a[1:], b[1:]
+		offA++
+		offB++
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		keepA[offA+len(a)-1], keepB[offB+len(b)-1] = true, true
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+	if len(a)*len(b) <= portMaxCells {
+		ka, kb := lcs(a, b)
+		for i, k := range ka {
+			keepA[offA+i] = k
+		}
+		for j, k := range kb {
+			keepB[offB+j] = k
+		}
+		return
+	}
+
+	i, j := 0, 0
+	for _, p := range uniqueAnchors(a, b) {
+		matchLines(a[i:p[0]], b[j:p[1]], offA+i, offB+j, keepA, keepB)
+		keepA[offA+p[0]], keepB[offB+p[1]] = true, true
+		i, j = p[0]+1, p[1]+1
+	}
+	if i > 0 || j > 0 {
+		matchLines(a[i:], b[j:], offA+i, offB+j, keepA, keepB)
+	}
+}
+
+// uniqueAnchors returns the longest run of lines, in order on both sides,
+// that occur exactly once in a and once in b, as index pairs.
+func uniqueAnchors(a, b []string) [][2]int {
+	type count struct{ a, b, ia, ib int }
+	counts := make(map[string]*count)
+	for i, l := range a {
+		c := counts[l]
+		if c == nil {
+			c = &count{}
+			counts[l] = c
+		}
+		c.a++
+		c.ia = i
+	}
+	for j, l := range b {
+		if c := counts[l]; c != nil {
+			c.b++
+			c.ib = j
+		}
+	}
+	var pairs [][2]int
+	for _, c := range counts {
+		if c.a == 1 && c.b == 1 {
+			pairs = append(pairs, [2]int{c.ia, c.ib})
+		}
+	}
+	sort.Slice(pairs, func(x, y int) bool { return pairs[x][0] < pairs[y][0] })
+
+	// Longest increasing subsequence of the b indexes, by patience sorting.
+	var tails []int // tails[k]: index in pairs ending the best run of length k+1
+	prev := make([]int, len(pairs))
+	for p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool { return pairs[tails[k]][1] >= pairs[p][1] })
+		prev[p] = -1
+		if k > 0 {
+			prev[p] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, p)
+		} else {
+			tails[k] = p
+		}
+	}
+	if len(tails) == 0 {
+		return nil
+	}
+	run := make([][2]int, len(tails))
+	for k, p := len(tails)-1, tails[len(tails)-1]; k >= 0; k, p = k-1, prev[p] {
+		run[k] = pairs[p]
+	}
+	return run
+}
+
+// PortLine maps line on the old side of cs to the new side. ok is false if
+// cs removes the line. A file cs doesn't change maps every line to itself.
+func PortLine(cs Changeset, line int) (int, bool) {
+	delta := 0
+	for _, h := range cs.Hunks {
+		first := h.OldStart
+		if h.OldCount == 0 {
+			// A pure insertion goes after line OldStart.
+			first++
+		}
+		if line < first {
+			break
+		}
+		for _, l := range h.Lines {
+			switch l.Type {
+			case Context:
+				if l.OldNum == line {
+					return l.NewNum, true
+				}
+			case Removed:
+				if l.OldNum == line {
+					return 0, false
+				}
+				delta--
+			case Added:
+				delta++
+			}
+		}
+	}
+	return line + delta, true
+}
+
+// Port is where a comment lands on the current diff.
+type Port struct {
+	Line      int
+	StartLine int  // 0 for a one-line comment
+	Ghost     bool // the comment can't be placed; Line and StartLine are 0
+}
+
+// PortComment ports a comment on lines start..line (start 0 for one line)
+// of a file through interdiff, the diff of the file from the version the
+// comment was made on to the one current shows on side ("LEFT" or
+// "RIGHT"). The comment is a ghost if its last line was removed since or
+// current doesn't show where it lands. A range whose first line was removed
+// shrinks to the lines that remain.
+func PortComment(interdiff, current Changeset, side string, start, line int) Port {
+	to, ok := PortLine(interdiff, line)
+	if !ok || !ShowsLine(current, side, to) {
+		return Port{Ghost: true}
+	}
+	p := Port{Line: to}
+	for s := start; s > 0 && s < line; s++ {
+		if from, ok := PortLine(interdiff, s); ok && from < to {
+			p.StartLine = from
+			break
+		}
+	}
+	return p
+}
+
+// ShowsLine reports whether cs has a row for line on side ("LEFT" for the
+// old file, "RIGHT" for the new one).
+func ShowsLine(cs Changeset, side string, line int) bool {
+	for _, h := range cs.Hunks {
+		for _, l := range h.Lines {
+			if side == "LEFT" && l.Type != Added && l.OldNum == line {
+				return true
+			}
+			if side != "LEFT" && l.Type != Removed && l.NewNum == line {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HunkSnippet returns the last n lines of a review comment's diff hunk as
+// a changeset of path, to show a ghost comment with the code it was made on.
+// ok is false if diffHunk can't be parsed.
+func HunkSnippet(path, diffHunk string, n int) (Changeset, bool) {
+	hunks, err := godiff.ParseHunks([]byte(strings.TrimRight(diffHunk, "\n") + "\n"))
+	if err != nil || len(hunks) != 1 {
+		return Changeset{}, false
+	}
+	h := parseHunk(hunks[0])
+	if len(h.Lines) > n {
+		h.Lines = h.Lines[len(h.Lines)-n:]
+	}
+	if len(h.Lines) == 0 {
+		return Changeset{}, false
+	}
+	h.OldStart, h.NewStart, h.OldCount, h.NewCount = 0, 0, 0, 0
+	for _, l := range h.Lines {
+		if l.Type != Added {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldNum
+			}
+			h.OldCount++
+		}
+		if l.Type != Removed {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewNum
+			}
+			h.NewCount++
+		}
+	}
+	return Changeset{OldName: path, NewName: path, Hunks: []Hunk{h}}, true
+}
@@ -0,0 +1,131 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTextChangeset(t *testing.T) {
+	cs := TextChangeset("f", "f", "a\nb\nc\nd\n", "a\nB\nc\nd\ne\n")
+	if cs.LinesAdded != 2 || cs.LinesRemoved != 1 {
+		t.Fatalf("+%d -%d, want +2 -1", cs.LinesAdded, cs.LinesRemoved)
+	}
+	if len(cs.Hunks) != 2 {
+		t.Fatalf("%d hunks, want 2", len(cs.Hunks))
+	}
+	// The trailing insertion follows old line 4, as with git diff -U0.
+	if h := cs.Hunks[1]; h.OldStart != 4 || h.OldCount != 0 || h.NewStart != 5 || h.NewCount != 1 {
+		t.Errorf("second hunk = -%d,%d +%d,%d; want -4,0 +5,1", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+	}
+}
+
+func TestTextChangesetUniqueAnchors(t *testing.T) {
+	// Too large for one LCS table: the unique lines must anchor the match.
+	var a, b []string
+	for i := range 1200 {
+		a = append(a, fmt.Sprintf("line %d", i), "}")
+		if i == 1190 {
+			b = append(b, "inserted")
+		}
+		if i != 10 {
+			b = append(b, fmt.Sprintf("line %d", i), "}")
+		}
+	}
+	cs := TextChangeset("f", "f", strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if cs.LinesAdded != 1 || cs.LinesRemoved != 2 {
+		t.Fatalf("+%d -%d, want +1 -2", cs.LinesAdded, cs.LinesRemoved)
+	}
+	if got, ok := PortLine(cs, 1203); !ok || got != 1201 {
+		t.Errorf("line 1203 -> %d, %v; want 1201", got, ok)
+	}
+	if got, ok := PortLine(cs, 2400); !ok || got != 2399 {
+		t.Errorf("line 2400 -> %d, %v; want 2399", got, ok)
+	}
+}
+
+func TestPortLine(t *testing.T) {
+	cs := TextChangeset("f", "f", "1\n2\n3\n4\n5\n6\n", "0\n1\n3\n4\nx\n5\n6\n")
+	tests := []struct {
+		line, want int
+		ok         bool
+	}{
+		{1, 2, true},
+		{2, 0, false},
+		{3, 3, true},
+		{4, 4, true},
+		{5, 6, true},
+		{6, 7, true},
+		{9, 10, true},
+	}
+	for _, tt := range tests {
+		got, ok := PortLine(cs, tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("PortLine(%d) = %d, %v; want %d, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+	if got, ok := PortLine(Changeset{}, 7); got != 7 || !ok {
+		t.Errorf("unchanged file: PortLine(7) = %d, %v", got, ok)
+	}
+}
+
+func TestPortLineParsedDiff(t *testing.T) {
+	raw := "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -2,3 +2,2 @@ func f() {\n a\n-b\n c\n"
+	cs, err := ParseDiff(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := PortLine(cs[0], 4); !ok || got != 3 {
+		t.Errorf("PortLine(4) = %d, %v; want 3", got, ok)
+	}
+	if _, ok := PortLine(cs[0], 3); ok {
+		t.Error("removed line 3 ported")
+	}
+}
+
+func TestPortComment(t *testing.T) {
+	interdiff := TextChangeset("f", "f", "a\nb\nc\nd\n", "new\na\nc\nd\n")
+	current := Changeset{Hunks: []Hunk{{Lines: []Line{
+		{Type: Added, NewNum: 1},
+		{Type: Context, OldNum: 1, NewNum: 2},
+		{Type: Context, OldNum: 2, NewNum: 3},
+	}}}}
+	tests := []struct {
+		name        string
+		start, line int
+		want        Port
+	}{
+		{"moved down", 0, 1, Port{Line: 2}},
+		{"range loses its removed first line", 2, 3, Port{Line: 3}},
+		{"range", 1, 3, Port{Line: 3, StartLine: 2}},
+		{"removed line", 0, 2, Port{Ghost: true}},
+		{"not in the diff", 0, 4, Port{Ghost: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PortComment(interdiff, current, "RIGHT", tt.start, tt.line); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkSnippet(t *testing.T) {
+	// GitHub cuts the hunk off at the commented line; the header still
+	// counts the whole hunk.
+	hunk := "@@ -10,6 +10,7 @@ func f() {\n a\n b\n-c\n+C\n+D\n d"
+	cs, ok := HunkSnippet("f.go", hunk, 3)
+	if !ok {
+		t.Fatal("not parsed")
+	}
+	h := cs.Hunks[0]
+	if len(h.Lines) != 3 || h.Lines[0].Content != "C" || h.Lines[2].OldNum != 13 || h.Lines[2].NewNum != 14 {
+		t.Errorf("lines = %+v", h.Lines)
+	}
+	if h.OldStart != 13 || h.OldCount != 1 || h.NewStart != 12 || h.NewCount != 3 {
+		t.Errorf("hunk = -%d,%d +%d,%d; want -13,1 +12,3", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+	}
+	if _, ok := HunkSnippet("f.go", "not a hunk", 3); ok {
+		t.Error("parsed a non-hunk")
+	}
+}
@@ -18,6 +18,8 @@ type InlineComment struct {
 	Path      string // file path (used as changesetID)
 	Line      int
 	Side      string // "LEFT" or "RIGHT"
+	StartLine int    // first line of a multi-line comment, 0 for one line
+	IsGhost   bool   // made on an earlier diff and can't be placed on this one
 }
 
 // InlineCommentMeta builds the full data-meta map expected by DiffInline.js bindToRow.
@@ -27,17 +29,26 @@ func InlineCommentMeta(c InlineComment) map[string]any {
 		"suggestionText": nil,
 		"hasSuggestion":  false,
 	}
+	if text, rest, ok := ParseSuggestion(c.Body); ok {
+		contentState["text"] = rest
+		contentState["suggestionText"] = text
+		contentState["hasSuggestion"] = true
+	}
+	length := 0
+	if c.StartLine > 0 && c.StartLine < c.Line {
+		length = c.Line - c.StartLine
+	}
 	return map[string]any{
 		"id":                  c.ID,
 		"phid":                fmt.Sprintf("GHCMT-%d", c.ID),
 		"on_right":            c.Side == "RIGHT",
-		"number":              c.Line,
-		"length":              0,
+		"number":              c.Line - length,
+		"length":              length,
 		"isNewFile":           c.Side == "RIGHT",
 		"changesetID":         c.Path,
 		"isDraft":             false,
 		"isFixed":             false,
-		"isGhost":             false,
+		"isGhost":             c.IsGhost,
 		"isSynthetic":         false,
 		"isDraftDone":         false,
 		"isEditing":           false,
@@ -47,7 +58,7 @@ func InlineCommentMeta(c InlineComment) map[string]any {
 		"documentEngineKey":   nil,
 		"startOffset":         nil,
 		"endOffset":           nil,
-		"canSuggestEdit":      false,
+		"canSuggestEdit":      c.Side == "RIGHT",
 		"state": map[string]any{
 			"initial":   contentState,
 			"committed": contentState,
@@ -73,37 +84,11 @@ func defaultMenuItems() []map[string]any {
 	}
 }
 
-// ChangesetMeta is the metadata structure for a changeset, stored in Javelin's
-// data store and referenced via data-meta pointer on the DOM element.
-type ChangesetMeta struct {
-	Left        string `json:"left"`
-	Right       string `json:"right"`
-	RenderURI   string `json:"renderURI"`
-	Ref         string `json:"ref"`
-	Loaded      bool   `json:"loaded"`
-	DisplayPath string `json:"displayPath"`
-	Icon        string `json:"icon"`
-}
-
-// BuildChangesetMeta creates the metadata for a changeset.
-func BuildChangesetMeta(cs Changeset) ChangesetMeta {
-	path := cs.DisplayPath()
-	return ChangesetMeta{
-		Left:        path,
-		Right:       path,
-		RenderURI:   "/api/changeset/render",
-		Ref:         path,
-		Loaded:      true,
-		DisplayPath: path,
-		Icon:        FileIcon(path),
-	}
-}
-
 // RenderChangeset produces the full Phabricator-style HTML for a single changeset.
 // metaRef is the Javelin metadata pointer (e.g., "0_3") for the data-meta attribute.
 // comments are inline comments to be rendered within the diff table at their respective lines.
 func RenderChangeset(cs Changeset, metaRef string, comments []InlineComment) template.HTML {
-	hunkRows := buildRowsByHunk(cs)
+	hunkRows := buildRowsByHunk(cs, FileSources{})
 	path := cs.DisplayPath()
 	icon := FileIcon(path)
 
@@ -216,38 +201,6 @@ func renderShowMore(b *strings.Builder, label, path string, startLine, endLine,
 	b.WriteString(`</tr>`)
 }
 
-// RenderContextRows produces <tr> elements for expanded context lines.
-// fileContent is the full file text, startLine/endLine are 1-indexed inclusive.
-func RenderContextRows(path, fileContent string, startLine, endLine, csID int) string {
-	lines := strings.Split(fileContent, "\n")
-	if startLine < 1 {
-		startLine = 1
-	}
-	if endLine > len(lines) {
-		endLine = len(lines)
-	}
-	if startLine > endLine {
-		return ""
-	}
-
-	// Highlight the context slice
-	slice := lines[startLine-1 : endLine]
-	highlighted := HighlightLines(path, slice)
-
-	var b strings.Builder
-	for i, hl := range highlighted {
-		lineNum := startLine + i
-		fmt.Fprintf(&b, `<tr>`)
-		fmt.Fprintf(&b, `<td class="n" data-n="%d" id="C%dOL%d"></td>`, lineNum, csID, lineNum)
-		fmt.Fprintf(&b, `<td data-copy-mode="copy-l">%s</td>`, hl)
-		fmt.Fprintf(&b, `<td class="n" data-n="%d" id="C%dNL%d"></td>`, lineNum, csID, lineNum)
-		fmt.Fprintf(&b, `<td class="copy"></td>`)
-		fmt.Fprintf(&b, `<td colspan="2" data-copy-mode="copy-r">%s</td>`, hl)
-		b.WriteString(`</tr>`)
-	}
-	return b.String()
-}
-
 // renderInlineCommentRow writes a single inline comment as a <tr> inside the diff table.
 // Styled to match the moodboard design with avatar, author, and action buttons.
 func renderInlineCommentRow(b *strings.Builder, c InlineComment) {
@@ -328,8 +281,9 @@ func renderRow(b *strings.Builder, csID int, row DiffRow) {
 }
 
 // BuildDiffRows returns all diff rows for a changeset, flattened across hunks.
-func BuildDiffRows(cs Changeset) []DiffRow {
-	byHunk := buildRowsByHunk(cs)
+// src may hold the full files for highlighting; see FileSources.
+func BuildDiffRows(cs Changeset, src FileSources) []DiffRow {
+	byHunk := buildRowsByHunk(cs, src)
 	var rows []DiffRow
 	for _, hr := range byHunk {
 		rows = append(rows, hr...)
@@ -337,13 +291,75 @@ func BuildDiffRows(cs Changeset) []DiffRow {
 	return rows
 }
 
+// BuildUnifiedRows returns one row per diff line for the one-up view, in
+// unified diff order: each run of removed lines precedes the added lines that
+// replace it. Intra-line markers and highlighting match the two-up rows.
+func BuildUnifiedRows(cs Changeset, src FileSources) []UnifiedRow {
+	var rows []UnifiedRow
+	for _, hunkRows := range buildRowsByHunk(cs, src) {
+		var added []UnifiedRow
+		prevAddOnly := false
+		flush := func() {
+			rows = append(rows, added...)
+			added = nil
+		}
+		for _, row := range hunkRows {
+			if row.IsContext {
+				flush()
+				prevAddOnly = false
+				rows = append(rows, UnifiedRow{
+					Type:    Context,
+					OldNum:  row.OldNum,
+					NewNum:  row.NewNum,
+					Content: row.NewContent,
+				})
+				continue
+			}
+			if row.OldNum > 0 {
+				// A removed line right after an added-only row starts a
+				// new run; the pending additions belong to the previous one.
+				if prevAddOnly {
+					flush()
+				}
+				rows = append(rows, UnifiedRow{
+					Type:    Removed,
+					OldNum:  row.OldNum,
+					Class:   "old",
+					Content: row.OldContent,
+					Move:    row.OldMove,
+				})
+			}
+			if row.NewNum > 0 {
+				added = append(added, UnifiedRow{
+					Type:    Added,
+					NewNum:  row.NewNum,
+					Class:   "new",
+					Content: row.NewContent,
+					Move:    row.NewMove,
+				})
+			}
+			prevAddOnly = row.OldNum == 0
+		}
+		flush()
+	}
+	return rows
+}
+
 // buildRowsByHunk converts a Changeset into rows grouped by hunk for the two-up view.
-// It pairs removed+added lines as modifications when they appear consecutively.
-func buildRowsByHunk(cs Changeset) [][]DiffRow {
+// It pairs removed+added lines as modifications when they appear consecutively,
+// and marks the changed words of each pair with "bright" spans.
+func buildRowsByHunk(cs Changeset, src FileSources) [][]DiffRow {
 	// Collect all lines from all hunks, highlighting each side.
 	oldLines, newLines := collectSides(cs)
-	oldHL := HighlightLines(cs.DisplayPath(), oldLines)
-	newHL := HighlightLines(cs.DisplayPath(), newLines)
+	oldTok := highlightSide(cs.OldName, oldLines, src.Old, src.HasOld)
+	newTok := highlightSide(cs.DisplayPath(), newLines, src.New, src.HasNew)
+	oldFlat, newFlat := flattenSide(oldLines), flattenSide(newLines)
+	oldHL := func(i int, bright []Range) template.HTML {
+		return template.HTML(formatLine(oldTok[i], oldFlat[i].content, bright))
+	}
+	newHL := func(i int, bright []Range) template.HTML {
+		return template.HTML(formatLine(newTok[i], newFlat[i].content, bright))
+	}
 
 	oldIdx, newIdx := 0, 0
 	result := make([][]DiffRow, len(cs.Hunks))
@@ -359,8 +375,8 @@ func buildRowsByHunk(cs Changeset) [][]DiffRow {
 				rows = append(rows, DiffRow{
 					OldNum:     line.OldNum,
 					NewNum:     line.NewNum,
-					OldContent: template.HTML(oldHL[oldIdx]),
-					NewContent: template.HTML(newHL[newIdx]),
+					OldContent: oldHL(oldIdx, nil),
+					NewContent: newHL(newIdx, nil),
 					IsContext:  true,
 				})
 				oldIdx++
@@ -384,10 +400,19 @@ func buildRowsByHunk(cs Changeset) [][]DiffRow {
 				maxPairs := max(len(removed), len(added))
 				for j := 0; j < maxPairs; j++ {
 					row := DiffRow{}
+					// Mark the words that changed within a modified line.
+					var oldBright, newBright []Range
+					if j < len(removed) && j < len(added) {
+						rl, al := hunk.Lines[removed[j]], hunk.Lines[added[j]]
+						if rl.Move == nil && al.Move == nil {
+							oldBright, newBright, _ = IntralineRanges(rl.Content, al.Content)
+						}
+					}
 					if j < len(removed) {
 						rl := hunk.Lines[removed[j]]
 						row.OldNum = rl.OldNum
-						row.OldContent = template.HTML(oldHL[oldIdx])
+						row.OldMove = rl.Move
+						row.OldContent = oldHL(oldIdx, oldBright)
 						oldIdx++
 						if j < len(added) {
 							row.OldClass = "old" // paired with added on this row
@@ -398,7 +423,8 @@ func buildRowsByHunk(cs Changeset) [][]DiffRow {
 					if j < len(added) {
 						al := hunk.Lines[added[j]]
 						row.NewNum = al.NewNum
-						row.NewContent = template.HTML(newHL[newIdx])
+						row.NewMove = al.Move
+						row.NewContent = newHL(newIdx, newBright)
 						newIdx++
 						if j < len(removed) {
 							row.NewClass = "new" // paired with removed on this row
@@ -413,8 +439,9 @@ func buildRowsByHunk(cs Changeset) [][]DiffRow {
 				// Added lines not preceded by removed.
 				rows = append(rows, DiffRow{
 					NewNum:     line.NewNum,
+					NewMove:    line.Move,
 					NewClass:   "new new-full",
-					NewContent: template.HTML(newHL[newIdx]),
+					NewContent: newHL(newIdx, nil),
 				})
 				newIdx++
 				i++
@@ -425,25 +452,36 @@ func buildRowsByHunk(cs Changeset) [][]DiffRow {
 	return result
 }
 
-// collectSides extracts the old-side and new-side line contents in order,
-// for use with the syntax highlighter.
-func collectSides(cs Changeset) (oldLines, newLines []string) {
+// collectSides extracts the old-side and new-side lines of each hunk in
+// order, for use with the syntax highlighter.
+func collectSides(cs Changeset) (oldLines, newLines [][]sideLine) {
 	for _, hunk := range cs.Hunks {
+		var oldHunk, newHunk []sideLine
 		for _, line := range hunk.Lines {
 			switch line.Type {
 			case Context:
-				oldLines = append(oldLines, line.Content)
-				newLines = append(newLines, line.Content)
+				oldHunk = append(oldHunk, sideLine{line.OldNum, line.Content})
+				newHunk = append(newHunk, sideLine{line.NewNum, line.Content})
 			case Removed:
-				oldLines = append(oldLines, line.Content)
+				oldHunk = append(oldHunk, sideLine{line.OldNum, line.Content})
 			case Added:
-				newLines = append(newLines, line.Content)
+				newHunk = append(newHunk, sideLine{line.NewNum, line.Content})
 			}
 		}
+		oldLines = append(oldLines, oldHunk)
+		newLines = append(newLines, newHunk)
 	}
 	return
 }
 
+func flattenSide(hunks [][]sideLine) []sideLine {
+	var out []sideLine
+	for _, h := range hunks {
+		out = append(out, h...)
+	}
+	return out
+}
+
 // RenderFileTree produces a Phabricator-style file tree for the left sidebar.
 // Uses diff-tree-view CSS classes that are part of differential.pkg.css.
 func RenderFileTree(changesets []Changeset) template.HTML {
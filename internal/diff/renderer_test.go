@@ -0,0 +1,63 @@
+package diff
+
+import "testing"
+
+func TestBuildUnifiedRowsOrder(t *testing.T) {
+	// -a +b +c -d +e, then context, then +f -g.
+	cs := Changeset{
+		NewName: "notes.txt",
+		Hunks: []Hunk{{
+			OldStart: 1, NewStart: 1, OldCount: 4, NewCount: 5,
+			Lines: []Line{
+				{Type: Removed, OldNum: 1, Content: "a"},
+				{Type: Added, NewNum: 1, Content: "b"},
+				{Type: Added, NewNum: 2, Content: "c"},
+				{Type: Removed, OldNum: 2, Content: "d"},
+				{Type: Added, NewNum: 3, Content: "e"},
+				{Type: Context, OldNum: 3, NewNum: 4, Content: "x"},
+				{Type: Added, NewNum: 5, Content: "f"},
+				{Type: Removed, OldNum: 4, Content: "g"},
+			},
+		}},
+	}
+	type want struct {
+		typ            LineType
+		oldNum, newNum int
+		content        string
+	}
+	wants := []want{
+		{Removed, 1, 0, "a"},
+		{Added, 0, 1, "b"},
+		{Added, 0, 2, "c"},
+		{Removed, 2, 0, "d"},
+		{Added, 0, 3, "e"},
+		{Context, 3, 4, "x"},
+		{Added, 0, 5, "f"},
+		{Removed, 4, 0, "g"},
+	}
+
+	rows := BuildUnifiedRows(cs, FileSources{})
+	if len(rows) != len(wants) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(wants), rows)
+	}
+	for i, w := range wants {
+		r := rows[i]
+		if r.Type != w.typ || r.OldNum != w.oldNum || r.NewNum != w.newNum || string(r.Content) != w.content {
+			t.Errorf("row %d = %+v, want %+v", i, r, w)
+		}
+	}
+}
+
+func TestInlineCommentMetaRangeAndSuggestion(t *testing.T) {
+	m := InlineCommentMeta(InlineComment{
+		ID: 1, Path: "a.go", Side: "RIGHT", StartLine: 3, Line: 5,
+		Body: "Simpler:\n```suggestion\nreturn nil\n```",
+	})
+	if m["number"] != 3 || m["length"] != 2 || m["canSuggestEdit"] != true {
+		t.Errorf("number=%v length=%v canSuggestEdit=%v", m["number"], m["length"], m["canSuggestEdit"])
+	}
+	state := m["state"].(map[string]any)["committed"].(map[string]any)
+	if state["hasSuggestion"] != true || state["suggestionText"] != "return nil" || state["text"] != "Simpler:" {
+		t.Errorf("state = %v", state)
+	}
+}
@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseSuggestion returns the replacement text of the first ```suggestion
+// block in a review comment body, without a trailing newline, and the rest
+// of the body with the block cut out. An empty block suggests deleting the
+// commented lines. ok is false if the body has no closed suggestion block.
+func ParseSuggestion(body string) (text, rest string, ok bool) {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		fence, info, isFence := splitFence(l)
+		if !isFence || info != "suggestion" {
+			continue
+		}
+		for j := i + 1; j < len(lines); j++ {
+			// The closing fence is at least as long as the opening one.
+			if f, info, ok := splitFence(lines[j]); ok && info == "" && len(f) >= len(fence) {
+				text = strings.Join(lines[i+1:j], "\n")
+				rest = strings.Join(append(lines[:i:i], lines[j+1:]...), "\n")
+				return text, strings.TrimSpace(rest), true
+			}
+		}
+		return "", body, false
+	}
+	return "", body, false
+}
+
+// splitFence splits a code fence line like "```suggestion" into the fence
+// and its info string.
+func splitFence(line string) (fence, info string, ok bool) {
+	t := strings.TrimSpace(line)
+	n := 0
+	for n < len(t) && t[n] == '`' {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	return t[:n], strings.TrimSpace(t[n:]), true
+}
+
+// HunkTail returns the last count lines on side ("LEFT" or "RIGHT") of a
+// review comment's diff hunk, which GitHub cuts off at the commented line:
+// for a comment on lines start..line these are the lines it covers,
+// without line endings. It returns nil if the hunk has fewer lines on that side.
+func HunkTail(diffHunk, side string, count int) []string {
+	skip := byte('-')
+	if side == "LEFT" {
+		skip = '+'
+	}
+	var lines []string
+	for _, l := range strings.Split(strings.TrimRight(diffHunk, "\n"), "\n") {
+		if l == "" || strings.HasPrefix(l, "@@") || l[0] == '\\' || l[0] == skip {
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(l[1:], "\r"))
+	}
+	if count <= 0 || len(lines) < count {
+		return nil
+	}
+	return lines[len(lines)-count:]
+}
+
+// SuggestionChangeset builds a single-hunk changeset of path replacing
+// original, the lines of a file from line start on, with suggested. Its
+// rows, from BuildUnifiedRows, show the suggestion as a small diff.
+func SuggestionChangeset(path string, start int, original []string, suggested string) Changeset {
+	var repl []string
+	if suggested != "" {
+		repl = strings.Split(suggested, "\n")
+	}
+	keepA, keepB := make([]bool, len(original)), make([]bool, len(repl))
+	if len(original)*len(repl) <= intralineMaxCells {
+		keepA, keepB = lcs(original, repl)
+	}
+
+	cs := Changeset{OldName: path, NewName: path}
+	h := Hunk{OldStart: start, NewStart: start, OldCount: len(original), NewCount: len(repl)}
+	for i, j := 0, 0; i < len(original) || j < len(repl); {
+		switch {
+		case i < len(original) && !keepA[i]:
+			h.Lines = append(h.Lines, Line{Type: Removed, OldNum: start + i, Content: original[i]})
+			cs.LinesRemoved++
+			i++
+		case j < len(repl) && !keepB[j]:
+			h.Lines = append(h.Lines, Line{Type: Added, NewNum: start + j, Content: repl[j]})
+			cs.LinesAdded++
+			j++
+		default:
+			h.Lines = append(h.Lines, Line{Type: Context, OldNum: start + i, NewNum: start + j, Content: original[i]})
+			i++
+			j++
+		}
+	}
+	cs.Hunks = []Hunk{h}
+	return cs
+}
+
+// ApplySuggestion replaces lines start..end (1-based, inclusive) of content
+// with suggested, as GitHub does when a suggestion is committed.
+func ApplySuggestion(content string, start, end int, suggested string) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if start < 1 || end < start || end > len(lines) {
+		return "", fmt.Errorf("lines %d-%d are outside the file (%d lines)", start, end, len(lines))
+	}
+
+	var b strings.Builder
+	for _, l := range lines[:start-1] {
+		b.WriteString(l)
+	}
+	if suggested != "" {
+		b.WriteString(suggested)
+		// Keep the replaced range's line ending, or its absence at EOF.
+		last := lines[end-1]
+		switch {
+		case strings.HasSuffix(last, "\r\n"):
+			b.WriteString("\r\n")
+		case strings.HasSuffix(last, "\n"):
+			b.WriteString("\n")
+		}
+	}
+	for _, l := range lines[end:] {
+		b.WriteString(l)
+	}
+	return b.String(), nil
+}
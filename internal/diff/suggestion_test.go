@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSuggestion(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		wantRest string
+		wantOK   bool
+	}{
+		{
+			name:     "single line",
+			body:     "Typo:\n```suggestion\nreturn nil\n```\nThanks",
+			want:     "return nil",
+			wantRest: "Typo:\nThanks",
+			wantOK:   true,
+		},
+		{
+			name:   "multi line with CRLF",
+			body:   "```suggestion\r\na := 1\r\nb := 2\r\n```",
+			want:   "a := 1\nb := 2",
+			wantOK: true,
+		},
+		{
+			name:   "empty block deletes",
+			body:   "```suggestion\n```",
+			want:   "",
+			wantOK: true,
+		},
+		{
+			name:   "longer fence keeps inner fences",
+			body:   "````suggestion\n```go\nx\n```\n````",
+			want:   "```go\nx\n```",
+			wantOK: true,
+		},
+		{name: "plain code block", body: "```go\nx\n```", wantRest: "```go\nx\n```"},
+		{name: "unclosed", body: "```suggestion\nx", wantRest: "```suggestion\nx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, ok := ParseSuggestion(tt.body)
+			if got != tt.want || rest != tt.wantRest || ok != tt.wantOK {
+				t.Errorf("ParseSuggestion = %q, %q, %v; want %q, %q, %v", got, rest, ok, tt.want, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHunkTail(t *testing.T) {
+	hunk := "@@ -1,4 +1,4 @@\n a\n-b\n+B\n c"
+	if got, want := HunkTail(hunk, "RIGHT", 2), []string{"B", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RIGHT = %q, want %q", got, want)
+	}
+	if got, want := HunkTail(hunk, "LEFT", 3), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LEFT = %q, want %q", got, want)
+	}
+	if got := HunkTail(hunk, "RIGHT", 4); got != nil {
+		t.Errorf("too many lines = %q, want nil", got)
+	}
+}
+
+func TestSuggestionChangeset(t *testing.T) {
+	cs := SuggestionChangeset("a.go", 10, []string{"a", "b", "c"}, "a\nB\nc\nd")
+	var got []string
+	for _, l := range cs.Hunks[0].Lines {
+		got = append(got, l.Type.String()+" "+l.Content)
+	}
+	want := []string{"context a", "removed b", "added B", "context c", "added d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if cs.LinesAdded != 2 || cs.LinesRemoved != 1 {
+		t.Errorf("+%d -%d, want +2 -1", cs.LinesAdded, cs.LinesRemoved)
+	}
+	if l := cs.Hunks[0].Lines[4]; l.NewNum != 13 {
+		t.Errorf("last line NewNum = %d, want 13", l.NewNum)
+	}
+}
+
+func TestApplySuggestion(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		start, end int
+		suggested  string
+		want       string
+	}{
+		{"replace range", "a\nb\nc\nd\n", 2, 3, "X", "a\nX\nd\n"},
+		{"delete", "a\nb\nc\n", 2, 2, "", "a\nc\n"},
+		{"grow", "a\nb\n", 1, 1, "x\ny", "x\ny\nb\n"},
+		{"no newline at EOF", "a\nb", 2, 2, "B", "a\nB"},
+		{"CRLF", "a\r\nb\r\n", 1, 1, "A", "A\r\nb\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplySuggestion(tt.content, tt.start, tt.end, tt.suggested)
+			if err != nil || got != tt.want {
+				t.Errorf("ApplySuggestion = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := ApplySuggestion("a\n", 1, 2, "x"); err == nil {
+		t.Error("range past EOF should fail")
+	}
+}
@@ -0,0 +1,310 @@
+package diff
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// Symbol is a declaration in a source file: a function, method, type or
+// class, spanning lines Start to End (1-based, inclusive).
+type Symbol struct {
+	Kind  string // "func", "method", "type", or the declaring keyword ("class", "def", ...)
+	Name  string // identifies the symbol across versions, e.g. "Server.handleAPIPR"
+	Label string // as declared, e.g. "func (s *Server) handleAPIPR"
+	Start int
+	End   int
+}
+
+// Symbols are a file's declarations, in source order.
+type Symbols []Symbol
+
+// Enclosing returns the innermost symbol whose span contains line.
+func (s Symbols) Enclosing(line int) (Symbol, bool) {
+	var best Symbol
+	found := false
+	for _, sym := range s {
+		if sym.Start <= line && line <= sym.End && (!found || sym.End-sym.Start < best.End-best.Start) {
+			best, found = sym, true
+		}
+	}
+	return best, found
+}
+
+// ParseSymbols extracts the declarations in src. Go files are parsed with
+// go/parser; other languages use a heuristic over Chroma tokens. Source that
+// fails to parse yields whatever declarations could be recovered.
+func ParseSymbols(filename, src string) Symbols {
+	if path.Ext(filename) == ".go" {
+		return goSymbols(filename, src)
+	}
+	return tokenSymbols(filename, src)
+}
+
+func goSymbols(filename, src string) Symbols {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var syms Symbols
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sym := Symbol{Kind: "func", Name: d.Name.Name, Label: "func " + d.Name.Name, Start: line(d.Pos()), End: line(d.End())}
+			if d.Recv != nil && len(d.Recv.List) == 1 {
+				recv := d.Recv.List[0]
+				recvType := types.ExprString(recv.Type)
+				if len(recv.Names) == 1 {
+					recvType = recv.Names[0].Name + " " + recvType
+				}
+				sym.Kind = "method"
+				sym.Name = receiverBase(recv.Type) + "." + d.Name.Name
+				sym.Label = "func (" + recvType + ") " + d.Name.Name
+			}
+			syms = append(syms, sym)
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				start, end := line(ts.Pos()), line(ts.End())
+				if !d.Lparen.IsValid() {
+					start = line(d.Pos())
+				}
+				syms = append(syms, Symbol{Kind: "type", Name: ts.Name.Name, Label: "type " + ts.Name.Name, Start: start, End: end})
+			}
+		}
+	}
+	return syms
+}
+
+// receiverBase returns the type name of a method receiver, without pointer
+// or type parameters.
+func receiverBase(e ast.Expr) string {
+	for {
+		switch t := e.(type) {
+		case *ast.StarExpr:
+			e = t.X
+		case *ast.IndexExpr:
+			e = t.X
+		case *ast.IndexListExpr:
+			e = t.X
+		case *ast.ParenExpr:
+			e = t.X
+		default:
+			return types.ExprString(e)
+		}
+	}
+}
+
+// declKeywords are keywords that introduce a named declaration, mapped to
+// the symbol kind they produce.
+var declKeywords = map[string]string{
+	"class":     "class",
+	"struct":    "struct",
+	"interface": "interface",
+	"enum":      "enum",
+	"trait":     "trait",
+	"impl":      "impl",
+	"module":    "module",
+	"object":    "object",
+	"def":       "def",
+	"fn":        "fn",
+	"fun":       "fun",
+	"func":      "func",
+	"function":  "function",
+	"sub":       "sub",
+}
+
+// tokenSymbols finds declarations with Chroma: a line declares a symbol if
+// it has a class or function name token, and either a declaring keyword
+// precedes it or it looks like a C-style definition (the name is followed
+// by a parameter list and the line opens a block). A symbol ends at the
+// next line indented no deeper than its declaration, including a closing
+// "}" or "end" on that line.
+func tokenSymbols(filename, src string) Symbols {
+	lines := strings.Split(src, "\n")
+	tokens := tokenizeLines(filename, lines)
+
+	var syms Symbols
+	for i, toks := range tokens {
+		sym, ok := tokenDecl(toks, lines[i])
+		if !ok {
+			continue
+		}
+		sym.Start = i + 1
+		sym.End = blockEnd(lines, i)
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+func tokenDecl(toks []chroma.Token, line string) (Symbol, bool) {
+	kind := ""
+	for j, t := range toks {
+		switch {
+		case t.Type.InCategory(chroma.Keyword):
+			if k, ok := declKeywords[t.Value]; ok {
+				kind = k
+			}
+		case t.Type.InSubCategory(chroma.NameClass) || t.Type.InSubCategory(chroma.NameFunction):
+			if kind == "" {
+				if !t.Type.InSubCategory(chroma.NameFunction) || !looksLikeDefinition(toks[j+1:], line) {
+					return Symbol{}, false
+				}
+				kind = "function"
+			}
+			label := strings.TrimSpace(line)
+			if k := strings.IndexAny(label, "({:"); k > 0 {
+				label = strings.TrimSpace(label[:k])
+			}
+			return Symbol{Kind: kind, Name: t.Value, Label: label}, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// looksLikeDefinition reports whether the tokens after a function name are
+// a parameter list opening a block, as in "int main(void) {", rather than
+// a call.
+func looksLikeDefinition(rest []chroma.Token, line string) bool {
+	if len(rest) == 0 || !strings.HasPrefix(rest[0].Value, "(") {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	return strings.HasSuffix(trimmed, "{") || strings.HasSuffix(trimmed, ")") && !strings.HasSuffix(trimmed, ");")
+}
+
+// blockEnd returns the last line (1-based) of the block declared at index i.
+func blockEnd(lines []string, i int) int {
+	indent := indentOf(lines[i])
+	end := i
+	for j := i + 1; j < len(lines); j++ {
+		l := lines[j]
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if indentOf(l) <= indent {
+			t := strings.TrimSpace(l)
+			if strings.HasPrefix(t, "}") || strings.HasPrefix(t, ")") || t == "end" {
+				return j + 1
+			}
+			break
+		}
+		end = j
+	}
+	return end + 1
+}
+
+func indentOf(l string) int {
+	n := 0
+	for _, r := range l {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// Symbol changes reported by ChangedSymbols.
+const (
+	SymbolAdded    = "added"
+	SymbolRemoved  = "removed"
+	SymbolModified = "modified"
+)
+
+// ChangedSymbol is a declaration touched by a changeset.
+type ChangedSymbol struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	Change  string `json:"change"`  // SymbolAdded, SymbolRemoved or SymbolModified
+	OldLine int    `json:"oldLine"` // declaration line on the old side, 0 if added
+	NewLine int    `json:"newLine"` // declaration line on the new side, 0 if removed
+}
+
+// ChangedSymbols maps the changed lines of cs to their innermost enclosing
+// symbols in old and new, the declarations of the two versions of the file.
+// A symbol found on both sides is modified; one only on the new side was
+// added, one only on the old side removed. Results are in order of first
+// change.
+func ChangedSymbols(cs Changeset, old, new Symbols) []ChangedSymbol {
+	key := func(s Symbol) string { return s.Kind + " " + s.Name }
+	oldByKey := make(map[string]Symbol, len(old))
+	for _, s := range old {
+		oldByKey[key(s)] = s
+	}
+	newByKey := make(map[string]Symbol, len(new))
+	for _, s := range new {
+		newByKey[key(s)] = s
+	}
+
+	var out []ChangedSymbol
+	seen := make(map[string]bool)
+	add := func(s Symbol) {
+		k := key(s)
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		o, inOld := oldByKey[k]
+		n, inNew := newByKey[k]
+		c := ChangedSymbol{Kind: s.Kind, Name: s.Name, Label: s.Label}
+		switch {
+		case inOld && inNew:
+			c.Change, c.OldLine, c.NewLine, c.Label = SymbolModified, o.Start, n.Start, n.Label
+		case inNew:
+			c.Change, c.NewLine = SymbolAdded, n.Start
+		default:
+			c.Change, c.OldLine = SymbolRemoved, o.Start
+		}
+		out = append(out, c)
+	}
+	for _, h := range cs.Hunks {
+		for _, l := range h.Lines {
+			switch l.Type {
+			case Added:
+				if s, ok := new.Enclosing(l.NewNum); ok {
+					add(s)
+				}
+			case Removed:
+				if s, ok := old.Enclosing(l.OldNum); ok {
+					add(s)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// HunkSection returns the context shown in a hunk's header: git's own
+// function context if the diff has it, otherwise the label of the symbol
+// enclosing the hunk's first line, declared above the hunk. Deleted files
+// use the old side.
+func HunkSection(cs Changeset, h Hunk, old, new Symbols) string {
+	if h.Section != "" {
+		return h.Section
+	}
+	syms, line := new, h.NewStart
+	if cs.IsDeleted {
+		syms, line = old, h.OldStart
+	}
+	if s, ok := syms.Enclosing(line); ok && s.Start < line {
+		return s.Label
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+const symbolsOldGo = `package x
+
+type Server struct {
+	name string
+}
+
+func (s *Server) Name() string {
+	return s.name
+}
+
+func helper() int {
+	return 1
+}
+`
+
+const symbolsNewGo = `package x
+
+type Server struct {
+	name string
+}
+
+func (s *Server) Name() string {
+	return "server: " + s.name
+}
+
+type Foo int
+`
+
+func TestParseSymbolsGo(t *testing.T) {
+	got := ParseSymbols("x.go", symbolsOldGo)
+	want := Symbols{
+		{Kind: "type", Name: "Server", Label: "type Server", Start: 3, End: 5},
+		{Kind: "method", Name: "Server.Name", Label: "func (s *Server) Name", Start: 7, End: 9},
+		{Kind: "func", Name: "helper", Label: "func helper", Start: 11, End: 13},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSymbols = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseSymbolsTokens(t *testing.T) {
+	src := `class Greeter:
+    def greet(self, name):
+        print(name)
+
+    def close(self):
+        pass
+
+def main():
+    Greeter().greet("x")
+`
+	got := ParseSymbols("greet.py", src)
+	want := Symbols{
+		{Kind: "class", Name: "Greeter", Label: "class Greeter", Start: 1, End: 6},
+		{Kind: "def", Name: "greet", Label: "def greet", Start: 2, End: 3},
+		{Kind: "def", Name: "close", Label: "def close", Start: 5, End: 6},
+		{Kind: "def", Name: "main", Label: "def main", Start: 8, End: 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSymbols = %+v\nwant %+v", got, want)
+	}
+
+	c := `int add(int a, int b) {
+    return a + b;
+}
+
+int main(void) {
+    return add(1, 2);
+}
+`
+	got = ParseSymbols("add.c", c)
+	if len(got) != 2 || got[0].Name != "add" || got[0].End != 3 || got[1].Name != "main" || got[1].Start != 5 {
+		t.Errorf("C symbols = %+v", got)
+	}
+}
+
+func TestChangedSymbols(t *testing.T) {
+	raw := `diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -7,7 +7,6 @@ type Server struct {
+ func (s *Server) Name() string {
+-	return s.name
++	return "server: " + s.name
+ }
+ 
+-func helper() int {
+-	return 1
+-}
++type Foo int
+`
+	changesets, err := ParseDiff(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := changesets[0]
+	old, new := ParseSymbols("x.go", symbolsOldGo), ParseSymbols("x.go", symbolsNewGo)
+
+	got := ChangedSymbols(cs, old, new)
+	want := []ChangedSymbol{
+		{Kind: "method", Name: "Server.Name", Label: "func (s *Server) Name", Change: SymbolModified, OldLine: 7, NewLine: 7},
+		{Kind: "func", Name: "helper", Label: "func helper", Change: SymbolRemoved, OldLine: 11},
+		{Kind: "type", Name: "Foo", Label: "type Foo", Change: SymbolAdded, NewLine: 11},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedSymbols = %+v\nwant %+v", got, want)
+	}
+
+	if s := HunkSection(cs, cs.Hunks[0], old, new); s != "type Server struct {" {
+		t.Errorf("HunkSection kept git's context = %q", s)
+	}
+	h := cs.Hunks[0]
+	h.Section, h.NewStart = "", 8
+	if s := HunkSection(cs, h, old, new); s != "func (s *Server) Name" {
+		t.Errorf("HunkSection = %q, want the enclosing method", s)
+	}
+}
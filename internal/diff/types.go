@@ -37,6 +37,16 @@ type Line struct {
 	OldNum  int      `json:"oldNum"`  // 0 if added
 	NewNum  int      `json:"newNum"`  // 0 if removed
 	Content string   `json:"content"` // raw text (no +/- prefix)
+	Move    *Move    `json:"move,omitempty"`
+}
+
+// Move links a moved line to its counterpart: removed lines point to where
+// they were moved to, added lines to where they were moved from.
+type Move struct {
+	Dir       string `json:"dir"`       // "to" on removed lines, "from" on added lines
+	Changeset int    `json:"changeset"` // ID of the changeset holding the counterpart
+	Path      string `json:"path"`
+	Line      int    `json:"line"` // counterpart line: new side for "to", old side for "from"
 }
 
 // Hunk is a contiguous group of diff lines.
@@ -45,6 +55,7 @@ type Hunk struct {
 	NewStart int    `json:"newStart"` // starting line number on the new side
 	OldCount int    `json:"oldCount"` // number of old-side lines covered
 	NewCount int    `json:"newCount"` // number of new-side lines covered
+	Section  string `json:"section"`  // function context after "@@ ... @@", if any
 	Lines    []Line `json:"lines"`
 }
 
@@ -58,10 +69,30 @@ type Changeset struct {
 	IsNew        bool   `json:"isNew"`
 	IsDeleted    bool   `json:"isDeleted"`
 	IsRenamed    bool   `json:"isRenamed"`
+	IsCopied     bool   `json:"isCopied"` // OldName is the copy source
 	IsBinary     bool   `json:"isBinary"`
+	Similarity   int    `json:"similarity,omitempty"` // percent, for renames and copies
+	OldMode      string `json:"oldMode,omitempty"`    // git file mode, e.g. ModeFile
+	NewMode      string `json:"newMode,omitempty"`
+	Kind         Kind   `json:"kind,omitempty"` // set by Classify
 	Hunks        []Hunk `json:"hunks"`
 }
 
+// Git file modes, as they appear in diff headers.
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeSubmodule  = "160000"
+)
+
+// ModeChanged reports whether the file's mode differs between the sides,
+// e.g. an executable bit flip or a file replaced by a symlink. Added and
+// deleted files have no mode change.
+func (c *Changeset) ModeChanged() bool {
+	return c.OldMode != "" && c.NewMode != "" && c.OldMode != c.NewMode
+}
+
 // DisplayPath returns the best path to show for this changeset.
 func (c *Changeset) DisplayPath() string {
 	if c.NewName != "" && c.NewName != "/dev/null" {
@@ -79,4 +110,16 @@ type DiffRow struct {
 	OldContent template.HTML `json:"oldContent"` // syntax-highlighted HTML
 	NewContent template.HTML `json:"newContent"` // syntax-highlighted HTML
 	IsContext  bool          `json:"isContext"`
+	OldMove    *Move         `json:"oldMove,omitempty"`
+	NewMove    *Move         `json:"newMove,omitempty"`
+}
+
+// UnifiedRow is a single row in the one-up (unified) diff view.
+type UnifiedRow struct {
+	Type    LineType      `json:"type"`
+	OldNum  int           `json:"oldNum"`  // 0 if added
+	NewNum  int           `json:"newNum"`  // 0 if removed
+	Class   string        `json:"class"`   // "old", "new", or ""
+	Content template.HTML `json:"content"` // syntax-highlighted HTML
+	Move    *Move         `json:"move,omitempty"`
 }
@@ -0,0 +1,90 @@
+package diff
+
+// maxWhitespaceCells bounds the LCS table for one block of changed lines,
+// after the lines that match at its start and end are taken off. Larger
+// middles are left as they are.
+const maxWhitespaceCells = 200 * 200
+
+// collapseWhitespace turns removed/added line pairs that differ only in
+// whitespace into context lines. Within each block of removed lines followed
+// by added lines, the lines are matched by a longest common subsequence of
+// their whitespace-normalized text, so reindenting a block collapses it
+// while real edits around it remain.
+func collapseWhitespace(lines []Line) []Line {
+	out := make([]Line, 0, len(lines))
+	for i := 0; i < len(lines); {
+		if lines[i].Type != Removed {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		start := i
+		for i < len(lines) && lines[i].Type == Removed {
+			i++
+		}
+		mid := i
+		for i < len(lines) && lines[i].Type == Added {
+			i++
+		}
+		out = append(out, collapseBlock(lines[start:mid], lines[mid:i])...)
+	}
+	return out
+}
+
+func collapseBlock(removed, added []Line) []Line {
+	if len(added) == 0 {
+		return append([]Line(nil), removed...)
+	}
+	a := make([]string, len(removed))
+	for i, l := range removed {
+		a[i] = normalizeSpace(l.Content)
+	}
+	b := make([]string, len(added))
+	for i, l := range added {
+		b[i] = normalizeSpace(l.Content)
+	}
+
+	// A reindented block matches line for line from either end, however
+	// long it is; only what's left in between needs the LCS table.
+	keepA, keepB := make([]bool, len(a)), make([]bool, len(b))
+	lo := 0
+	for lo < len(a) && lo < len(b) && a[lo] == b[lo] {
+		keepA[lo], keepB[lo] = true, true
+		lo++
+	}
+	hiA, hiB := len(a), len(b)
+	for hiA > lo && hiB > lo && a[hiA-1] == b[hiB-1] {
+		hiA--
+		hiB--
+		keepA[hiA], keepB[hiB] = true, true
+	}
+	if (hiA-lo)*(hiB-lo) <= maxWhitespaceCells {
+		ka, kb := lcs(a[lo:hiA], b[lo:hiB])
+		copy(keepA[lo:], ka)
+		copy(keepB[lo:], kb)
+	}
+
+	out := make([]Line, 0, len(removed)+len(added))
+	i, j := 0, 0
+	for i < len(removed) || j < len(added) {
+		for i < len(removed) && !keepA[i] {
+			out = append(out, removed[i])
+			i++
+		}
+		for j < len(added) && !keepB[j] {
+			out = append(out, added[j])
+			j++
+		}
+		if i < len(removed) && j < len(added) {
+			out = append(out, Line{
+				Type:    Context,
+				OldNum:  removed[i].OldNum,
+				NewNum:  added[j].NewNum,
+				Content: added[j].Content,
+			})
+			i++
+			j++
+		}
+	}
+	return out
+}
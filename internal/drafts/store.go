@@ -0,0 +1,225 @@
+// Package drafts persists unpublished inline review comments, so they
+// survive reloads and restarts until the review they belong to is
+// submitted.
+package drafts
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS inline_drafts (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	login       TEXT NOT NULL,
+	owner       TEXT NOT NULL,
+	repo        TEXT NOT NULL,
+	number      INTEGER NOT NULL,
+	path        TEXT NOT NULL,
+	line        INTEGER NOT NULL,
+	side        TEXT NOT NULL,
+	start_line  INTEGER NOT NULL DEFAULT 0,
+	start_side  TEXT NOT NULL DEFAULT '',
+	in_reply_to INTEGER NOT NULL DEFAULT 0,
+	body        TEXT NOT NULL DEFAULT '',
+	created_at  TEXT NOT NULL,
+	updated_at  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS inline_drafts_pr ON inline_drafts (login, owner, repo, number);`
+
+// addedColumns are columns added to inline_drafts after it was first
+// created, with their definitions; Open adds any an older database lacks.
+var addedColumns = [][2]string{
+	{"start_line", "INTEGER NOT NULL DEFAULT 0"},
+	{"start_side", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// sqliteTime is a fixed-width timestamp format, so timestamps sort as text.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// Key identifies one user's pending review on a pull request.
+type Key struct {
+	Login  string
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// Draft is an inline comment that hasn't been published. Body is empty
+// until the user first saves it.
+type Draft struct {
+	ID int64
+	Key
+	Path      string
+	Line      int
+	Side      string // LEFT or RIGHT
+	StartLine int    // first line of a multi-line comment, 0 for one line
+	StartSide string
+	InReplyTo int64 // if replying to an existing comment
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Store keeps drafts in an embedded SQLite database. Every operation is
+// scoped to a login: users never see or change each other's drafts.
+type Store struct {
+	db *sql.DB
+}
+
+// OpenDefault opens drafts.db in ~/.ghabricator, next to the Herald store.
+func OpenDefault() (*Store, error) {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".ghabricator")
+	os.MkdirAll(dir, 0o755)
+	return Open(filepath.Join(dir, "drafts.db"))
+}
+
+// Open opens (creating if needed) the database at path.
+func Open(path string) (*Store, error) {
+	// WAL lets readers proceed during writes; busy_timeout makes concurrent
+	// writers from other processes wait instead of failing.
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init %s: %w", path, err)
+	}
+	if err := addMissingColumns(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func addMissingColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('inline_drafts')`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range addedColumns {
+		if have[c[0]] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE inline_drafts ADD COLUMN ` + c[0] + ` ` + c[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add stores d under a new ID and returns it with the ID and timestamps set.
+func (s *Store) Add(d Draft) (Draft, error) {
+	now := time.Now().UTC()
+	d.CreatedAt, d.UpdatedAt = now, now
+	res, err := s.db.Exec(`INSERT INTO inline_drafts
+		(login, owner, repo, number, path, line, side, start_line, start_side, in_reply_to, body, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Login, d.Owner, d.Repo, d.Number, d.Path, d.Line, d.Side, d.StartLine, d.StartSide, d.InReplyTo, d.Body,
+		now.Format(sqliteTime), now.Format(sqliteTime))
+	if err != nil {
+		return Draft{}, fmt.Errorf("add draft: %w", err)
+	}
+	if d.ID, err = res.LastInsertId(); err != nil {
+		return Draft{}, fmt.Errorf("add draft: %w", err)
+	}
+	return d, nil
+}
+
+// Get returns login's draft id, or nil if there is none.
+func (s *Store) Get(login string, id int64) (*Draft, error) {
+	row := s.db.QueryRow(`SELECT `+columns+` FROM inline_drafts WHERE id = ? AND login = ?`, id, login)
+	d, err := scanDraft(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get draft: %w", err)
+	}
+	return d, nil
+}
+
+// SetBody saves the body of login's draft id and returns the draft, or nil
+// if login has no such draft (id may then name a published comment).
+func (s *Store) SetBody(login string, id int64, body string) (*Draft, error) {
+	res, err := s.db.Exec(`UPDATE inline_drafts SET body = ?, updated_at = ? WHERE id = ? AND login = ?`,
+		body, time.Now().UTC().Format(sqliteTime), id, login)
+	if err != nil {
+		return nil, fmt.Errorf("save draft: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return s.Get(login, id)
+}
+
+// Delete removes login's draft id and reports whether it existed.
+func (s *Store) Delete(login string, id int64) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM inline_drafts WHERE id = ? AND login = ?`, id, login)
+	if err != nil {
+		return false, fmt.Errorf("delete draft: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// List returns the drafts of k, oldest first.
+func (s *Store) List(k Key) ([]Draft, error) {
+	rows, err := s.db.Query(`SELECT `+columns+` FROM inline_drafts
+		WHERE login = ? AND owner = ? AND repo = ? AND number = ? ORDER BY id`,
+		k.Login, k.Owner, k.Repo, k.Number)
+	if err != nil {
+		return nil, fmt.Errorf("list drafts: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Draft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list drafts: %w", err)
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+const columns = `id, login, owner, repo, number, path, line, side, start_line, start_side, in_reply_to, body, created_at, updated_at`
+
+func scanDraft(row interface{ Scan(dest ...any) error }) (*Draft, error) {
+	var d Draft
+	var created, updated string
+	err := row.Scan(&d.ID, &d.Login, &d.Owner, &d.Repo, &d.Number, &d.Path, &d.Line, &d.Side,
+		&d.StartLine, &d.StartSide, &d.InReplyTo, &d.Body, &created, &updated)
+	if err != nil {
+		return nil, err
+	}
+	d.CreatedAt, _ = time.Parse(sqliteTime, created)
+	d.UpdatedAt, _ = time.Parse(sqliteTime, updated)
+	return &d, nil
+}
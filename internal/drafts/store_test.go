@@ -0,0 +1,105 @@
+package drafts
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func openTest(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreScopedToLogin(t *testing.T) {
+	s := openTest(t, filepath.Join(t.TempDir(), "drafts.db"))
+	alice := Key{Login: "alice", Owner: "o", Repo: "r", Number: 1}
+	bob := Key{Login: "bob", Owner: "o", Repo: "r", Number: 1}
+
+	a, err := s.Add(Draft{Key: alice, Path: "a.go", Line: 3, Side: "RIGHT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := s.Add(Draft{Key: alice, Path: "b.go", Line: 7, Side: "LEFT", StartLine: 5, StartSide: "LEFT", InReplyTo: 42})
+	other, _ := s.Add(Draft{Key: bob, Path: "a.go", Line: 3, Side: "RIGHT"})
+	if a.ID == 0 || b.ID == a.ID {
+		t.Fatalf("IDs not assigned: %d, %d", a.ID, b.ID)
+	}
+
+	if d, err := s.SetBody("alice", a.ID, "nit"); err != nil || d == nil || d.Body != "nit" {
+		t.Fatalf("SetBody = %+v, %v", d, err)
+	}
+	if d, _ := s.SetBody("alice", other.ID, "hijack"); d != nil {
+		t.Error("SetBody on another user's draft should find nothing")
+	}
+	if ok, _ := s.Delete("alice", other.ID); ok {
+		t.Error("Delete of another user's draft should fail")
+	}
+
+	got, err := s.List(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != a.ID || got[0].Body != "nit" || got[1].InReplyTo != 42 || got[1].StartLine != 5 {
+		t.Errorf("List(alice) = %+v", got)
+	}
+	if got, _ := s.List(bob); len(got) != 1 || got[0].Body != "" {
+		t.Errorf("List(bob) = %+v", got)
+	}
+
+	if ok, _ := s.Delete("alice", a.ID); !ok {
+		t.Error("Delete should succeed")
+	}
+	if d, _ := s.Get("alice", a.ID); d != nil {
+		t.Error("draft survived delete")
+	}
+}
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drafts.db")
+	k := Key{Login: "alice", Owner: "o", Repo: "r", Number: 1}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := s.Add(Draft{Key: k, Path: "a.go", Line: 1, Side: "RIGHT", Body: "keep me"})
+	s.Close()
+
+	got, err := openTest(t, path).List(k)
+	if err != nil || len(got) != 1 || got[0].ID != d.ID || got[0].Body != "keep me" {
+		t.Errorf("after reopen: %+v, %v", got, err)
+	}
+}
+
+func TestOpenAddsMissingColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drafts.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The table as first released, without range columns.
+	_, err = db.Exec(`CREATE TABLE inline_drafts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT NOT NULL, owner TEXT NOT NULL,
+		repo TEXT NOT NULL, number INTEGER NOT NULL, path TEXT NOT NULL, line INTEGER NOT NULL,
+		side TEXT NOT NULL, in_reply_to INTEGER NOT NULL DEFAULT 0, body TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL, updated_at TEXT NOT NULL)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTest(t, path)
+	k := Key{Login: "alice", Owner: "o", Repo: "r", Number: 1}
+	if _, err := s.Add(Draft{Key: k, Path: "a.go", Line: 4, Side: "RIGHT", StartLine: 2, StartSide: "RIGHT"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.List(k); err != nil || len(got) != 1 || got[0].StartLine != 2 {
+		t.Errorf("List = %+v, %v", got, err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strconv"
 
 	gh "github.com/google/go-github/v68/github"
 )
@@ -161,18 +163,24 @@ func FetchReviewComment(ctx context.Context, client *gh.Client, owner, repo stri
 	if err != nil {
 		return nil, fmt.Errorf("fetch review comment: %w", err)
 	}
+	// The comment endpoint isn't scoped to a PR; the PR's number ends its URL.
+	number, _ := strconv.Atoi(path.Base(c.GetPullRequestURL()))
 	return &ReviewComment{
-		ID:   c.GetID(),
-		Body: c.GetBody(),
-		Path: c.GetPath(),
-		Line: c.GetLine(),
-		Side: c.GetSide(),
+		ID:        c.GetID(),
+		PRNumber:  number,
+		Body:      c.GetBody(),
+		Path:      c.GetPath(),
+		Line:      c.GetLine(),
+		Side:      c.GetSide(),
+		StartLine: c.GetStartLine(),
+		StartSide: c.GetStartSide(),
 		Author: User{
 			Login:     c.GetUser().GetLogin(),
 			AvatarURL: c.GetUser().GetAvatarURL(),
 		},
 		CreatedAt: c.GetCreatedAt().Time,
 		UpdatedAt: c.GetUpdatedAt().Time,
+		DiffHunk:  c.GetDiffHunk(),
 	}, nil
 }
 
@@ -194,6 +202,8 @@ func FetchReviewComments(ctx context.Context, client *gh.Client, owner, repo str
 				Path:      c.GetPath(),
 				Line:      c.GetLine(),
 				Side:      c.GetSide(),
+				StartLine: c.GetStartLine(),
+				StartSide: c.GetStartSide(),
 				CreatedAt: c.GetCreatedAt().Time,
 				UpdatedAt: c.GetUpdatedAt().Time,
 				DiffHunk:  c.GetDiffHunk(),
@@ -201,6 +211,9 @@ func FetchReviewComments(ctx context.Context, client *gh.Client, owner, repo str
 					Login:     c.GetUser().GetLogin(),
 					AvatarURL: c.GetUser().GetAvatarURL(),
 				},
+				OriginalLine:      c.GetOriginalLine(),
+				OriginalStartLine: c.GetOriginalStartLine(),
+				OriginalCommitID:  c.GetOriginalCommitID(),
 			}
 			if c.InReplyTo != nil {
 				rc.InReplyTo = c.GetInReplyTo()
@@ -256,24 +269,32 @@ func FetchReviews(ctx context.Context, client *gh.Client, owner, repo string, nu
 	return result, nil
 }
 
-// CreateReviewComment creates an inline review comment.
-func CreateReviewComment(ctx context.Context, client *gh.Client, owner, repo string, number int, body, path string, line int, side string) (*ReviewComment, error) {
+// CreateReviewComment creates an inline review comment, spanning
+// c.StartLine to c.Line if StartLine is set.
+func CreateReviewComment(ctx context.Context, client *gh.Client, owner, repo string, number int, c InlineCommentRequest) (*ReviewComment, error) {
 	comment := &gh.PullRequestComment{
-		Body: gh.Ptr(body),
-		Path: gh.Ptr(path),
-		Line: gh.Ptr(line),
-		Side: gh.Ptr(side),
+		Body: gh.Ptr(c.Body),
+		Path: gh.Ptr(c.Path),
+		Line: gh.Ptr(c.Line),
+		Side: gh.Ptr(c.Side),
+	}
+	// GitHub rejects start_line on single-line comments.
+	if c.StartLine > 0 && c.StartLine < c.Line {
+		comment.StartLine = gh.Ptr(c.StartLine)
+		comment.StartSide = gh.Ptr(c.StartSide)
 	}
 	created, _, err := client.PullRequests.CreateComment(ctx, owner, repo, number, comment)
 	if err != nil {
 		return nil, fmt.Errorf("create review comment: %w", err)
 	}
 	return &ReviewComment{
-		ID:   created.GetID(),
-		Body: created.GetBody(),
-		Path: created.GetPath(),
-		Line: created.GetLine(),
-		Side: created.GetSide(),
+		ID:        created.GetID(),
+		Body:      created.GetBody(),
+		Path:      created.GetPath(),
+		Line:      created.GetLine(),
+		Side:      created.GetSide(),
+		StartLine: created.GetStartLine(),
+		StartSide: created.GetStartSide(),
 		Author: User{
 			Login:     created.GetUser().GetLogin(),
 			AvatarURL: created.GetUser().GetAvatarURL(),
@@ -457,6 +478,20 @@ func FetchCompare(ctx context.Context, client *gh.Client, owner, repo, base, hea
 	return string(body), nil
 }
 
+// FetchMergeBase returns the merge base of base and head, the commit that
+// three-dot diffs (PR and compare diffs) show as the old side.
+func FetchMergeBase(ctx context.Context, client *gh.Client, owner, repo, base, head string) (string, error) {
+	cmp, _, err := client.Repositories.CompareCommits(ctx, owner, repo, base, head, &gh.ListOptions{PerPage: 1})
+	if err != nil {
+		return "", fmt.Errorf("fetch merge base: %w", err)
+	}
+	sha := cmp.GetMergeBaseCommit().GetSHA()
+	if sha == "" {
+		return "", fmt.Errorf("fetch merge base: no common ancestor of %s and %s", base, head)
+	}
+	return sha, nil
+}
+
 // EditPRBody updates the body of a pull request.
 func EditPRBody(ctx context.Context, client *gh.Client, owner, repo string, number int, body string) error {
 	_, _, err := client.PullRequests.Edit(ctx, owner, repo, number, &gh.PullRequest{Body: gh.Ptr(body)})
@@ -473,12 +508,17 @@ func EditIssueComment(ctx context.Context, client *gh.Client, owner, repo string
 func SubmitReview(ctx context.Context, client *gh.Client, owner, repo string, number int, event, body string, comments []InlineCommentRequest) (*Review, error) {
 	var reviewComments []*gh.DraftReviewComment
 	for _, c := range comments {
-		reviewComments = append(reviewComments, &gh.DraftReviewComment{
+		rc := &gh.DraftReviewComment{
 			Path: gh.Ptr(c.Path),
 			Line: gh.Ptr(c.Line),
 			Side: gh.Ptr(c.Side),
 			Body: gh.Ptr(c.Body),
-		})
+		}
+		if c.StartLine > 0 && c.StartLine < c.Line {
+			rc.StartLine = gh.Ptr(c.StartLine)
+			rc.StartSide = gh.Ptr(c.StartSide)
+		}
+		reviewComments = append(reviewComments, rc)
 	}
 	review := &gh.PullRequestReviewRequest{
 		Event:    gh.Ptr(event),
@@ -500,3 +540,118 @@ func SubmitReview(ctx context.Context, client *gh.Client, owner, repo string, nu
 		},
 	}, nil
 }
+
+// RequestReviewers requests reviews from the given users on a pull request.
+func RequestReviewers(ctx context.Context, client *gh.Client, owner, repo string, number int, logins []string) error {
+	_, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, number, gh.ReviewersRequest{Reviewers: logins})
+	if err != nil {
+		return fmt.Errorf("request reviewers: %w", err)
+	}
+	return nil
+}
+
+// AddLabels adds labels to a pull request. Missing labels are created by GitHub.
+func AddLabels(ctx context.Context, client *gh.Client, owner, repo string, number int, labels []string) error {
+	_, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+	if err != nil {
+		return fmt.Errorf("add labels: %w", err)
+	}
+	return nil
+}
+
+// IsTeamMember reports whether login is an active member of org/teamSlug.
+// A 404 (no such team, or not a member) is reported as false, not an error.
+func IsTeamMember(ctx context.Context, client *gh.Client, org, teamSlug, login string) (bool, error) {
+	m, resp, err := client.Teams.GetTeamMembershipBySlug(ctx, org, teamSlug, login)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("team membership: %w", err)
+	}
+	return m.GetState() == "active", nil
+}
+
+// RequestTeamReviewers requests reviews from teams (by slug, within the
+// repository's organization) on a pull request.
+func RequestTeamReviewers(ctx context.Context, client *gh.Client, owner, repo string, number int, teamSlugs []string) error {
+	_, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, number, gh.ReviewersRequest{TeamReviewers: teamSlugs})
+	if err != nil {
+		return fmt.Errorf("request team reviewers: %w", err)
+	}
+	return nil
+}
+
+// AddAssignees assigns users to a pull request.
+func AddAssignees(ctx context.Context, client *gh.Client, owner, repo string, number int, logins []string) error {
+	_, _, err := client.Issues.AddAssignees(ctx, owner, repo, number, logins)
+	if err != nil {
+		return fmt.Errorf("add assignees: %w", err)
+	}
+	return nil
+}
+
+// RemoveLabel removes a label from a pull request. Removing a label the PR
+// doesn't have is not an error.
+func RemoveLabel(ctx context.Context, client *gh.Client, owner, repo string, number int, label string) error {
+	resp, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("remove label: %w", err)
+	}
+	return nil
+}
+
+// SetPRDraft converts a pull request to a draft, or marks it ready for
+// review. The REST API can't change draft state, so this uses GraphQL.
+func SetPRDraft(ctx context.Context, client *gh.Client, owner, repo string, number int, draft bool) error {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return fmt.Errorf("set draft: %w", err)
+	}
+	mutation := `mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId } }`
+	if draft {
+		mutation = `mutation($id: ID!) { convertPullRequestToDraft(input: {pullRequestId: $id}) { clientMutationId } }`
+	}
+	var resp struct{}
+	if err := clientGraphQL(ctx, client, mutation, map[string]interface{}{"id": pr.GetNodeID()}, &resp); err != nil {
+		return fmt.Errorf("set draft: %w", err)
+	}
+	return nil
+}
+
+// FetchCommitStatuses returns the latest state (error, failure, pending,
+// success) of each status context on a commit.
+func FetchCommitStatuses(ctx context.Context, client *gh.Client, owner, repo, sha string) (map[string]string, error) {
+	states := make(map[string]string)
+	opts := &gh.ListOptions{PerPage: 100}
+	for {
+		combined, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, fmt.Errorf("fetch commit status: %w", err)
+		}
+		for _, st := range combined.Statuses {
+			states[st.GetContext()] = st.GetState()
+		}
+		if resp.NextPage == 0 {
+			return states, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// SetCommitStatus sets a commit status. state is error, failure, pending or
+// success.
+func SetCommitStatus(ctx context.Context, client *gh.Client, owner, repo, sha, statusContext, state, description string) error {
+	_, _, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, &gh.RepoStatus{
+		Context:     gh.Ptr(statusContext),
+		State:       gh.Ptr(state),
+		Description: gh.Ptr(description),
+	})
+	if err != nil {
+		return fmt.Errorf("set commit status: %w", err)
+	}
+	return nil
+}
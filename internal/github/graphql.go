@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	gh "github.com/google/go-github/v68/github"
 )
 
 const graphqlEndpoint = "https://api.github.com/graphql"
@@ -60,3 +62,29 @@ func QueryGraphQL(ctx context.Context, token, query string, variables map[string
 	}
 	return nil
 }
+
+// clientGraphQL runs a GraphQL query through a REST client, reusing its
+// authentication and base URL. result receives the "data" object.
+func clientGraphQL(ctx context.Context, client *gh.Client, query string, variables map[string]interface{}, result interface{}) error {
+	req, err := client.NewRequest(http.MethodPost, "graphql", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("create graphql request: %w", err)
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return fmt.Errorf("graphql request: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql error: %s", resp.Errors[0].Message)
+	}
+	if len(resp.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, result)
+}
@@ -2,6 +2,7 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -43,9 +44,13 @@ query PRDetail($owner: String!, $repo: String!, $number: Int!) {
         nodes {
           requestedReviewer {
             ... on User { login avatarUrl }
+            ... on Team { combinedSlug }
           }
         }
       }
+      assignees(first: 20) {
+        nodes { login avatarUrl }
+      }
       reviews(first: 100) {
         nodes {
           databaseId
@@ -78,7 +83,7 @@ query PRDetail($owner: String!, $repo: String!, $number: Int!) {
             }
           }
         }
-      }
+      }` + reviewThreadsSelection + `
     }
   }
 }
@@ -133,9 +138,15 @@ type gqlPRResponse struct {
 				} `json:"labels"`
 				ReviewRequests struct {
 					Nodes []struct {
-						RequestedReviewer *gqlAuthor `json:"requestedReviewer"`
+						RequestedReviewer *struct {
+							gqlAuthor
+							CombinedSlug string `json:"combinedSlug"` // teams only
+						} `json:"requestedReviewer"`
 					} `json:"nodes"`
 				} `json:"reviewRequests"`
+				Assignees struct {
+					Nodes []gqlAuthor `json:"nodes"`
+				} `json:"assignees"`
 				Reviews struct {
 					Nodes []struct {
 						DatabaseId int64     `json:"databaseId"`
@@ -166,6 +177,7 @@ type gqlPRResponse struct {
 						} `json:"commit"`
 					} `json:"nodes"`
 				} `json:"commits"`
+				ReviewThreads gqlReviewThreads `json:"reviewThreads"`
 			} `json:"pullRequest"`
 		} `json:"repository"`
 	} `json:"data"`
@@ -177,12 +189,14 @@ type PRDetailGraphQL struct {
 	Reviews          []Review
 	IssueComments    []IssueComment
 	Commits          []PRCommit
+	ReviewThreads    []ReviewThread
 	CheckRuns        []CheckRun
 	ViewerPermission string // ADMIN, MAINTAIN, WRITE, TRIAGE, READ, or ""
 }
 
 // FetchPRDetailGraphQL fetches PR metadata, reviews, issue comments, commits,
-// and check runs in a single GraphQL query.
+// review threads and check runs in a single GraphQL query. Review threads
+// beyond the first page, rare in practice, take further queries.
 func FetchPRDetailGraphQL(ctx context.Context, token, owner, repo string, number int) (*PRDetailGraphQL, error) {
 	vars := map[string]interface{}{
 		"owner":  owner,
@@ -236,7 +250,11 @@ func FetchPRDetailGraphQL(ctx context.Context, token, owner, repo string, number
 	}
 
 	for _, rr := range gpr.ReviewRequests.Nodes {
-		if rr.RequestedReviewer != nil {
+		switch {
+		case rr.RequestedReviewer == nil:
+		case rr.RequestedReviewer.CombinedSlug != "":
+			pr.TeamReviewers = append(pr.TeamReviewers, rr.RequestedReviewer.CombinedSlug)
+		case rr.RequestedReviewer.Login != "":
 			pr.Reviewers = append(pr.Reviewers, User{
 				Login:     rr.RequestedReviewer.Login,
 				AvatarURL: rr.RequestedReviewer.AvatarUrl,
@@ -244,6 +262,10 @@ func FetchPRDetailGraphQL(ctx context.Context, token, owner, repo string, number
 		}
 	}
 
+	for _, a := range gpr.Assignees.Nodes {
+		pr.Assignees = append(pr.Assignees, User{Login: a.Login, AvatarURL: a.AvatarUrl})
+	}
+
 	// Map reviews
 	reviews := make([]Review, 0, len(gpr.Reviews.Nodes))
 	for _, r := range gpr.Reviews.Nodes {
@@ -286,11 +308,26 @@ func FetchPRDetailGraphQL(ctx context.Context, token, owner, repo string, number
 		commits = append(commits, commit)
 	}
 
+	query := func(q string, vars map[string]interface{}, result interface{}) error {
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := QueryGraphQL(ctx, token, q, vars, &resp); err != nil || len(resp.Data) == 0 {
+			return err
+		}
+		return json.Unmarshal(resp.Data, result)
+	}
+	threads, err := completeReviewThreads(query, owner, repo, number, gpr.ReviewThreads)
+	if err != nil {
+		return nil, fmt.Errorf("graphql PR detail: %w", err)
+	}
+
 	return &PRDetailGraphQL{
 		PR:               pr,
 		Reviews:          reviews,
 		IssueComments:    issueComments,
 		Commits:          commits,
+		ReviewThreads:    threads,
 		ViewerPermission: resp.Data.Repository.ViewerPermission,
 	}, nil
 }
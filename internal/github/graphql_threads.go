@@ -0,0 +1,246 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// reviewThreadFields selects a review thread with its first page of
+// comment IDs. Longer threads are completed with threadCommentsQuery.
+const reviewThreadFields = `
+          id
+          path
+          isResolved
+          isOutdated
+          line
+          originalLine
+          startLine
+          originalStartLine
+          diffSide
+          resolvedBy { login }
+          comments(first: 100) {
+            pageInfo { hasNextPage endCursor }
+            nodes { databaseId }
+          }`
+
+// reviewThreadsSelection selects the first page of a pull request's review
+// threads in prDetailQuery. GraphQL can't page a nested connection, so
+// further pages are fetched with reviewThreadsQuery, only when there are any.
+const reviewThreadsSelection = `
+      reviewThreads(first: 100) {
+        pageInfo { hasNextPage endCursor }
+        nodes {` + reviewThreadFields + `
+        }
+      }`
+
+// reviewThreadsQuery fetches the page of review threads after $after, or
+// the first one if it is null.
+const reviewThreadsQuery = `
+query ReviewThreads($owner: String!, $repo: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes {` + reviewThreadFields + `
+        }
+      }
+    }
+  }
+}
+`
+
+const threadCommentsQuery = `
+query ThreadComments($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on PullRequestReviewThread {
+      comments(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes { databaseId }
+      }
+    }
+  }
+}
+`
+
+type gqlPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type gqlThreadComments struct {
+	PageInfo gqlPageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		DatabaseId int64 `json:"databaseId"`
+	} `json:"nodes"`
+}
+
+type gqlReviewThreads struct {
+	PageInfo gqlPageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		ID                string `json:"id"`
+		Path              string `json:"path"`
+		IsResolved        bool   `json:"isResolved"`
+		IsOutdated        bool   `json:"isOutdated"`
+		Line              *int   `json:"line"`
+		OriginalLine      *int   `json:"originalLine"`
+		StartLine         *int   `json:"startLine"`
+		OriginalStartLine *int   `json:"originalStartLine"`
+		DiffSide          string `json:"diffSide"`
+		ResolvedBy        *struct {
+			Login string `json:"login"`
+		} `json:"resolvedBy"`
+		Comments gqlThreadComments `json:"comments"`
+	} `json:"nodes"`
+}
+
+// mapReviewThreads converts one page of threads. more holds the cursors of
+// the threads with comments beyond the first page, by thread ID.
+func mapReviewThreads(g gqlReviewThreads) (threads []ReviewThread, more map[string]string) {
+	deref := func(p *int) int {
+		if p == nil {
+			return 0
+		}
+		return *p
+	}
+	threads = make([]ReviewThread, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		t := ReviewThread{
+			ID:                n.ID,
+			Path:              n.Path,
+			IsResolved:        n.IsResolved,
+			IsOutdated:        n.IsOutdated,
+			Line:              deref(n.Line),
+			OriginalLine:      deref(n.OriginalLine),
+			StartLine:         deref(n.StartLine),
+			OriginalStartLine: deref(n.OriginalStartLine),
+			DiffSide:          n.DiffSide,
+		}
+		if n.ResolvedBy != nil {
+			t.ResolvedBy = n.ResolvedBy.Login
+		}
+		for _, c := range n.Comments.Nodes {
+			t.CommentIDs = append(t.CommentIDs, c.DatabaseId)
+		}
+		if n.Comments.PageInfo.HasNextPage {
+			if more == nil {
+				more = make(map[string]string)
+			}
+			more[n.ID] = n.Comments.PageInfo.EndCursor
+		}
+		threads = append(threads, t)
+	}
+	return threads, more
+}
+
+// graphQLFunc runs a GraphQL query and unmarshals its "data" object into
+// result, as clientGraphQL does.
+type graphQLFunc func(query string, variables map[string]interface{}, result interface{}) error
+
+// FetchReviewThreads fetches all review threads of a pull request, with all
+// their comment IDs.
+func FetchReviewThreads(ctx context.Context, client *gh.Client, owner, repo string, number int) ([]ReviewThread, error) {
+	query := func(q string, vars map[string]interface{}, result interface{}) error {
+		return clientGraphQL(ctx, client, q, vars, result)
+	}
+	first, err := fetchThreadPage(query, owner, repo, number, nil)
+	if err != nil {
+		return nil, err
+	}
+	return completeReviewThreads(query, owner, repo, number, first)
+}
+
+// fetchThreadPage fetches the page of review threads after the cursor, or
+// the first page if after is nil.
+func fetchThreadPage(query graphQLFunc, owner, repo string, number int, after *string) (gqlReviewThreads, error) {
+	vars := map[string]interface{}{
+		"owner":  owner,
+		"repo":   repo,
+		"number": number,
+		"after":  after,
+	}
+	var resp struct {
+		Repository struct {
+			PullRequest *struct {
+				ReviewThreads gqlReviewThreads `json:"reviewThreads"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	if err := query(reviewThreadsQuery, vars, &resp); err != nil {
+		return gqlReviewThreads{}, fmt.Errorf("fetch review threads: %w", err)
+	}
+	if resp.Repository.PullRequest == nil {
+		return gqlReviewThreads{}, fmt.Errorf("pull request %s/%s#%d not found", owner, repo, number)
+	}
+	return resp.Repository.PullRequest.ReviewThreads, nil
+}
+
+// completeReviewThreads maps a first page of review threads and fetches
+// what it leaves out: later pages of threads, and later pages of comments
+// of long threads.
+func completeReviewThreads(query graphQLFunc, owner, repo string, number int, page gqlReviewThreads) ([]ReviewThread, error) {
+	var threads []ReviewThread
+	for {
+		mapped, more := mapReviewThreads(page)
+		for i, t := range mapped {
+			if cursor, ok := more[t.ID]; ok {
+				ids, err := fetchThreadComments(query, t.ID, cursor)
+				if err != nil {
+					return nil, err
+				}
+				mapped[i].CommentIDs = append(mapped[i].CommentIDs, ids...)
+			}
+		}
+		threads = append(threads, mapped...)
+		if !page.PageInfo.HasNextPage {
+			return threads, nil
+		}
+		after := page.PageInfo.EndCursor
+		var err error
+		if page, err = fetchThreadPage(query, owner, repo, number, &after); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchThreadComments fetches the comment IDs of a review thread after
+// cursor.
+func fetchThreadComments(query graphQLFunc, threadID, cursor string) ([]int64, error) {
+	var ids []int64
+	for {
+		var resp struct {
+			Node *struct {
+				Comments gqlThreadComments `json:"comments"`
+			} `json:"node"`
+		}
+		vars := map[string]interface{}{"id": threadID, "after": cursor}
+		if err := query(threadCommentsQuery, vars, &resp); err != nil {
+			return nil, fmt.Errorf("fetch thread comments: %w", err)
+		}
+		if resp.Node == nil {
+			return nil, fmt.Errorf("review thread %s not found", threadID)
+		}
+		for _, c := range resp.Node.Comments.Nodes {
+			ids = append(ids, c.DatabaseId)
+		}
+		if !resp.Node.Comments.PageInfo.HasNextPage {
+			return ids, nil
+		}
+		cursor = resp.Node.Comments.PageInfo.EndCursor
+	}
+}
+
+// SetThreadResolved resolves or unresolves a review thread by its node ID.
+// The REST API has no notion of resolution, so this uses GraphQL.
+func SetThreadResolved(ctx context.Context, client *gh.Client, threadID string, resolved bool) error {
+	mutation := `mutation($id: ID!) { unresolveReviewThread(input: {threadId: $id}) { thread { isResolved } } }`
+	if resolved {
+		mutation = `mutation($id: ID!) { resolveReviewThread(input: {threadId: $id}) { thread { isResolved } } }`
+	}
+	var resp struct{}
+	if err := clientGraphQL(ctx, client, mutation, map[string]interface{}{"id": threadID}, &resp); err != nil {
+		return fmt.Errorf("set thread resolved: %w", err)
+	}
+	return nil
+}
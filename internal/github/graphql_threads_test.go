@@ -0,0 +1,134 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+func TestMapReviewThreads(t *testing.T) {
+	var page gqlReviewThreads
+	err := json.Unmarshal([]byte(`{"nodes": [
+		{"id": "T1", "path": "a.go", "isResolved": true, "line": 7, "originalLine": 5, "startLine": 6,
+		 "diffSide": "RIGHT", "resolvedBy": {"login": "alice"},
+		 "comments": {"nodes": [{"databaseId": 1}, {"databaseId": 2}]}},
+		{"id": "T2", "path": "b.go", "isOutdated": true, "line": null, "originalLine": 3, "diffSide": "LEFT",
+		 "comments": {"pageInfo": {"hasNextPage": true, "endCursor": "c2"}, "nodes": [{"databaseId": 3}]}}
+	]}`), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	threads, more := mapReviewThreads(page)
+	want := []ReviewThread{
+		{ID: "T1", Path: "a.go", IsResolved: true, Line: 7, OriginalLine: 5, StartLine: 6,
+			DiffSide: "RIGHT", ResolvedBy: "alice", CommentIDs: []int64{1, 2}},
+		{ID: "T2", Path: "b.go", IsOutdated: true, OriginalLine: 3, DiffSide: "LEFT", CommentIDs: []int64{3}},
+	}
+	if !reflect.DeepEqual(threads, want) {
+		t.Errorf("threads = %+v\nwant %+v", threads, want)
+	}
+	if !reflect.DeepEqual(more, map[string]string{"T2": "c2"}) {
+		t.Errorf("more = %v, want T2's cursor", more)
+	}
+}
+
+func TestFetchReviewThreadsPages(t *testing.T) {
+	// Two pages of threads; the second thread's comments span two pages.
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "ThreadComments") && req.Variables["id"] == "T2" && req.Variables["after"] == "c1":
+			w.Write([]byte(`{"data": {"node": {"comments": {"nodes": [{"databaseId": 21}]}}}}`))
+		case strings.Contains(req.Query, "ReviewThreads") && req.Variables["after"] == nil:
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+				"pageInfo": {"hasNextPage": true, "endCursor": "p1"},
+				"nodes": [{"id": "T1", "comments": {"nodes": [{"databaseId": 10}]}}]}}}}}`))
+		case strings.Contains(req.Query, "ReviewThreads") && req.Variables["after"] == "p1":
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+				"nodes": [{"id": "T2", "comments": {"pageInfo": {"hasNextPage": true, "endCursor": "c1"},
+					"nodes": [{"databaseId": 20}]}}]}}}}}`))
+		default:
+			t.Errorf("unexpected query %q with %v", req.Query, req.Variables)
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+		}
+	}))
+	defer fake.Close()
+	client := gh.NewClient(nil)
+	client.BaseURL, _ = url.Parse(fake.URL + "/")
+
+	threads, err := FetchReviewThreads(context.Background(), client, "acme", "widgets", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]int64)
+	for _, th := range threads {
+		got[th.ID] = th.CommentIDs
+	}
+	want := map[string][]int64{"T1": {10}, "T2": {20, 21}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("comment IDs by thread = %v, want %v", got, want)
+	}
+}
+
+// hostTransport sends every request to target, so QueryGraphQL's fixed
+// endpoint reaches a fake server.
+type hostTransport struct{ target *url.URL }
+
+func (rt hostTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestFetchPRDetailPagesRemainingThreads(t *testing.T) {
+	var queries []string
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "query PRDetail"):
+			queries = append(queries, "PRDetail")
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"number": 42, "state": "OPEN",
+				"reviewThreads": {"pageInfo": {"hasNextPage": true, "endCursor": "p1"},
+					"nodes": [{"id": "T1", "comments": {"nodes": [{"databaseId": 10}]}}]}}}}}`))
+		case strings.Contains(req.Query, "query ReviewThreads") && req.Variables["after"] == "p1":
+			queries = append(queries, "ReviewThreads")
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+				"nodes": [{"id": "T2", "comments": {"nodes": [{"databaseId": 20}]}}]}}}}}`))
+		default:
+			t.Errorf("unexpected query %q with %v", req.Query, req.Variables)
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+		}
+	}))
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL)
+	saved := http.DefaultClient.Transport
+	http.DefaultClient.Transport = hostTransport{target: target}
+	defer func() { http.DefaultClient.Transport = saved }()
+
+	detail, err := FetchPRDetailGraphQL(context.Background(), "token", "acme", "widgets", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.ReviewThreads) != 2 || detail.ReviewThreads[1].ID != "T2" {
+		t.Errorf("threads = %+v, want T1 and T2", detail.ReviewThreads)
+	}
+	if want := []string{"PRDetail", "ReviewThreads"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+}
@@ -150,6 +150,14 @@ type RepoFile struct {
 	Encoding string
 }
 
+// RepoBlob holds the raw bytes of a file, for binary content.
+type RepoBlob struct {
+	Path string
+	SHA  string // git blob SHA
+	Size int
+	Data []byte // nil if the file was larger than the caller's limit
+}
+
 // Branch holds branch metadata.
 type Branch struct {
 	Name      string
@@ -180,6 +188,38 @@ func FetchRepoTree(ctx context.Context, client *gh.Client, owner, repo, ref, pat
 	return entries, nil
 }
 
+// FetchFileBlob returns the bytes of a file at ref. Files larger than
+// maxSize are returned without Data. Unlike FetchFileContent it handles
+// files over the contents API's 1 MB inline limit by fetching the blob.
+func FetchFileBlob(ctx context.Context, client *gh.Client, owner, repo, ref, path string, maxSize int) (*RepoBlob, error) {
+	opts := &gh.RepositoryContentGetOptions{Ref: ref}
+	fc, _, _, err := client.Repositories.GetContents(ctx, owner, repo, path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("fetch file: %w", err)
+	}
+	if fc == nil {
+		return nil, fmt.Errorf("path is a directory, not a file")
+	}
+	blob := &RepoBlob{Path: fc.GetPath(), SHA: fc.GetSHA(), Size: fc.GetSize()}
+	if blob.Size > maxSize {
+		return blob, nil
+	}
+	if fc.GetEncoding() == "base64" && fc.Content != nil {
+		content, err := fc.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("decode file content: %w", err)
+		}
+		blob.Data = []byte(content)
+		return blob, nil
+	}
+	data, _, err := client.Git.GetBlobRaw(ctx, owner, repo, blob.SHA)
+	if err != nil {
+		return nil, fmt.Errorf("fetch blob: %w", err)
+	}
+	blob.Data = data
+	return blob, nil
+}
+
 // FetchFileContent returns the decoded content of a single file.
 func FetchFileContent(ctx context.Context, client *gh.Client, owner, repo, ref, path string) (*RepoFile, error) {
 	opts := &gh.RepositoryContentGetOptions{Ref: ref}
@@ -204,6 +244,23 @@ func FetchFileContent(ctx context.Context, client *gh.Client, owner, repo, ref,
 	}, nil
 }
 
+// UpdateFile commits new content for path to branch. blobSHA is the SHA of
+// the file being replaced; GitHub rejects the commit if the file changed
+// since. It returns the new commit's SHA.
+func UpdateFile(ctx context.Context, client *gh.Client, owner, repo, branch, path, message string, content []byte, blobSHA string) (string, error) {
+	opts := &gh.RepositoryContentFileOptions{
+		Message: gh.Ptr(message),
+		Content: content,
+		SHA:     gh.Ptr(blobSHA),
+		Branch:  gh.Ptr(branch),
+	}
+	resp, _, err := client.Repositories.UpdateFile(ctx, owner, repo, path, opts)
+	if err != nil {
+		return "", fmt.Errorf("update file: %w", err)
+	}
+	return resp.Commit.GetSHA(), nil
+}
+
 // FetchBranches lists branches for a repository.
 func FetchBranches(ctx context.Context, client *gh.Client, owner, repo string) ([]Branch, error) {
 	opts := &gh.BranchListOptions{
@@ -240,3 +297,29 @@ func FetchRepoInfo(ctx context.Context, client *gh.Client, owner, repo string) (
 		Forks:         r.GetForksCount(),
 	}, nil
 }
+
+// FetchViewerPermission returns the viewer's permission on a repository:
+// ADMIN, MAINTAIN, WRITE, TRIAGE, READ, or "" if they have none.
+func FetchViewerPermission(ctx context.Context, token, owner, repo string) (string, error) {
+	query := `query($owner: String!, $repo: String!) {
+		repository(owner: $owner, name: $repo) { viewerPermission }
+	}`
+	vars := map[string]interface{}{
+		"owner": owner,
+		"repo":  repo,
+	}
+	var resp struct {
+		Data struct {
+			Repository *struct {
+				ViewerPermission string `json:"viewerPermission"`
+			} `json:"repository"`
+		} `json:"data"`
+	}
+	if err := QueryGraphQL(ctx, token, query, vars, &resp); err != nil {
+		return "", fmt.Errorf("graphql viewer permission: %w", err)
+	}
+	if resp.Data.Repository == nil {
+		return "", fmt.Errorf("repository %s/%s not found", owner, repo)
+	}
+	return resp.Data.Repository.ViewerPermission, nil
+}
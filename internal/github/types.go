@@ -3,22 +3,24 @@ package github
 import "time"
 
 type PullRequest struct {
-	Number    int
-	Title     string
-	Body      string
-	State     string // "open", "closed"
-	Draft     bool
-	Merged    bool
-	Author    User
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Labels    []Label
-	Reviewers []User
-	Head      Ref
-	Base      Ref
-	Additions int
-	Deletions int
-	ChangedFiles int
+	Number        int
+	Title         string
+	Body          string
+	State         string // "open", "closed"
+	Draft         bool
+	Merged        bool
+	Author        User
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Labels        []Label
+	Reviewers     []User
+	TeamReviewers []string // "org/team"
+	Assignees     []User
+	Head          Ref
+	Base          Ref
+	Additions     int
+	Deletions     int
+	ChangedFiles  int
 }
 
 type User struct {
@@ -58,23 +60,51 @@ type ReactionSummary struct {
 
 type ReviewComment struct {
 	ID        int64
+	PRNumber  int // set by FetchReviewComment only
 	Author    User
 	Body      string
 	Path      string
-	Line      int
+	Line      int    // 0 once the comment is outdated
 	Side      string // LEFT or RIGHT
+	StartLine int    // first line of a multi-line comment, 0 for one line
+	StartSide string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	InReplyTo int64
 	DiffHunk  string
 	Reactions *ReactionSummary
+
+	// Where the comment was made: lines of Path at OriginalCommitID (the
+	// PR head then) or, for LEFT comments, at its merge base.
+	OriginalLine      int
+	OriginalStartLine int
+	OriginalCommitID  string
+}
+
+// ReviewThread is a thread of inline review comments. Line and StartLine
+// refer to the PR's current diff and are 0 once the thread is outdated;
+// the Original fields keep its position in the diff it was started on.
+type ReviewThread struct {
+	ID                string // GraphQL node ID, used to resolve the thread
+	Path              string
+	IsResolved        bool
+	IsOutdated        bool
+	Line              int
+	OriginalLine      int
+	StartLine         int // first line of a multi-line thread, 0 for one line
+	OriginalStartLine int
+	DiffSide          string  // LEFT or RIGHT
+	ResolvedBy        string  // login, if resolved
+	CommentIDs        []int64 // REST IDs of the thread's comments, oldest first
 }
 
 type InlineCommentRequest struct {
-	Body string
-	Path string
-	Line int
-	Side string // LEFT or RIGHT
+	Body      string
+	Path      string
+	Line      int
+	Side      string // LEFT or RIGHT
+	StartLine int    // first line of a multi-line comment, 0 for one line
+	StartSide string
 }
 
 type PRCommit struct {
@@ -0,0 +1,136 @@
+package herald
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// Blocker is a blocking-reviewer requirement from a matched rule: the PR
+// carries a failing commit status until Reviewer approves.
+type Blocker struct {
+	Reviewer string
+	RuleID   string
+	RuleName string
+	Approved bool
+}
+
+// StatusContext is the commit status context Herald uses for the blocker.
+func (b Blocker) StatusContext() string {
+	return blockerStatusPrefix + strings.ToLower(b.Reviewer)
+}
+
+// Blockers collects the blocking reviewers of all matches, one per reviewer,
+// and whether each has approved. Unlike other actions, blockers are
+// re-checked on every run regardless of the rule's repetition policy.
+func Blockers(matches []RuleMatch, pr *PRContext) []Blocker {
+	var out []Blocker
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		for _, a := range m.Actions {
+			login := strings.TrimSpace(a.Value)
+			if a.Type != ActionBlockingReviewer || login == "" || seen[strings.ToLower(login)] {
+				continue
+			}
+			seen[strings.ToLower(login)] = true
+			out = append(out, Blocker{
+				Reviewer: login,
+				RuleID:   m.Rule.ID,
+				RuleName: m.Rule.Name,
+				Approved: containsFold(pr.Approvers, login),
+			})
+		}
+	}
+	return out
+}
+
+// blockerStatusPrefix starts the commit status context of every blocker.
+const blockerStatusPrefix = "herald/review/"
+
+// syncBlockers sets each blocker's commit status on the PR head, writing
+// only when the state on GitHub differs, and requests review from blocking
+// reviewers who haven't approved and aren't requested yet. Blocker statuses
+// left on the head by earlier runs whose rules no longer match are set to
+// success; those of held blockers are left alone. It returns entries for
+// the writes.
+func syncBlockers(ctx context.Context, client *gh.Client, pr *PRContext, blockers, held []Blocker) []LogEntry {
+	if pr.HeadSHA == "" {
+		return nil
+	}
+	current, err := ghapi.FetchCommitStatuses(ctx, client, pr.Owner, pr.Repo, pr.HeadSHA)
+	var entries []LogEntry
+	for _, b := range blockers {
+		state, desc := "failure", "Waiting for approval from @"+b.Reviewer
+		if b.Approved {
+			state, desc = "success", "Approved by @"+b.Reviewer
+		}
+		if err == nil && current[b.StatusContext()] == state {
+			continue
+		}
+		entry := blockerEntry(pr, b)
+		werr := err
+		if werr == nil && !b.Approved && !strings.EqualFold(b.Reviewer, pr.Author) && !containsFold(pr.Reviewers, b.Reviewer) {
+			werr = ghapi.RequestReviewers(ctx, client, pr.Owner, pr.Repo, pr.Number, []string{b.Reviewer})
+		}
+		if werr == nil {
+			werr = ghapi.SetCommitStatus(ctx, client, pr.Owner, pr.Repo, pr.HeadSHA, b.StatusContext(), state, desc)
+		}
+		if werr != nil {
+			entry.Status = StatusFailed
+			entry.Error = werr.Error()
+		}
+		entries = append(entries, entry)
+	}
+	if err != nil {
+		return entries
+	}
+
+	required := make(map[string]bool)
+	for _, b := range slices.Concat(blockers, held) {
+		required[b.StatusContext()] = true
+	}
+	var stale []string
+	for statusContext, state := range current {
+		if strings.HasPrefix(statusContext, blockerStatusPrefix) && !required[statusContext] && state != "success" {
+			stale = append(stale, statusContext)
+		}
+	}
+	sort.Strings(stale)
+	for _, statusContext := range stale {
+		entry := blockerEntry(pr, Blocker{Reviewer: strings.TrimPrefix(statusContext, blockerStatusPrefix)})
+		if err := ghapi.SetCommitStatus(ctx, client, pr.Owner, pr.Repo, pr.HeadSHA, statusContext, "success", "No longer required"); err != nil {
+			entry.Status = StatusFailed
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// blockerEntry returns an applied log entry for a status write for b.
+func blockerEntry(pr *PRContext, b Blocker) LogEntry {
+	return LogEntry{
+		Repo:     pr.FullRepo(),
+		Number:   pr.Number,
+		RuleID:   b.RuleID,
+		RuleName: b.RuleName,
+		Action:   Action{Type: ActionBlockingReviewer, Value: b.Reviewer},
+		Status:   StatusApplied,
+		At:       time.Now(),
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package herald
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// BundleVersion is the current export format version.
+const BundleVersion = 1
+
+// Bundle is the import/export format for a set of rules.
+type Bundle struct {
+	Version int    `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+// MarshalBundle serializes rules as "yaml" or "json", sorted by ID and
+// without timestamps, so exports diff cleanly in version control.
+func MarshalBundle(rules []Rule, format string) ([]byte, error) {
+	b := Bundle{Version: BundleVersion, Rules: make([]Rule, len(rules))}
+	copy(b.Rules, rules)
+	for i := range b.Rules {
+		b.Rules[i].CreatedAt, b.Rules[i].UpdatedAt = time.Time{}, time.Time{}
+	}
+	sort.Slice(b.Rules, func(i, j int) bool { return b.Rules[i].ID < b.Rules[j].ID })
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(b, "", "  ")
+	case "yaml", "":
+		return yaml.Marshal(b)
+	}
+	return nil, fmt.Errorf("unknown format %q (want yaml or json)", format)
+}
+
+// ParseBundle reads a YAML or JSON bundle. A bare list of rules is accepted
+// too. Rules without an ID get one derived from their name, so importing the
+// same file twice updates rather than duplicates them.
+func ParseBundle(data []byte) (*Bundle, error) {
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	var b Bundle
+	if trimmed := bytes.TrimSpace(js); len(trimmed) > 0 && trimmed[0] == '[' {
+		b.Version = BundleVersion
+		err = strictUnmarshal(trimmed, &b.Rules)
+	} else {
+		err = strictUnmarshal(js, &b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	if b.Version > BundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than supported (%d)", b.Version, BundleVersion)
+	}
+
+	seen := make(map[string]bool)
+	for i := range b.Rules {
+		r := &b.Rules[i]
+		if r.ID == "" {
+			r.ID = stableID(r.Name)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("duplicate rule id %q", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	return &b, nil
+}
+
+// Validate checks every rule in the bundle and reports all problems.
+func (b *Bundle) Validate() []error {
+	var errs []error
+	for i := range b.Rules {
+		r := &b.Rules[i]
+		if strings.TrimSpace(r.Name) == "" {
+			errs = append(errs, fmt.Errorf("rule %d (%s): name is required", i+1, r.ID))
+		}
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d (%s): %w", i+1, r.Name, err))
+		}
+	}
+	return errs
+}
+
+// ImportMode controls how an import treats existing rules.
+type ImportMode string
+
+const (
+	ImportMerge   ImportMode = "merge"   // create and update; keep rules missing from the bundle
+	ImportReplace ImportMode = "replace" // also delete replaceable rules missing from the bundle
+)
+
+// ChangeKind describes what an import does to one rule.
+type ChangeKind string
+
+const (
+	ChangeCreate    ChangeKind = "create"
+	ChangeUpdate    ChangeKind = "update"
+	ChangeDelete    ChangeKind = "delete"
+	ChangeUnchanged ChangeKind = "unchanged"
+)
+
+// RuleChange is one entry of an import plan.
+type RuleChange struct {
+	Kind     ChangeKind
+	Rule     Rule     // the incoming rule, or the deleted one
+	Existing *Rule    // nil for creates
+	Fields   []string // JSON names of changed fields, for updates
+}
+
+// PlanImport compares incoming rules with existing ones. In replace mode,
+// existing rules missing from incoming are deleted if replaceable reports
+// true for them (callers restrict this to rules the importer may edit).
+func PlanImport(existing, incoming []Rule, mode ImportMode, replaceable func(*Rule) bool) []RuleChange {
+	byID := make(map[string]*Rule, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+	var plan []RuleChange
+	inBundle := make(map[string]bool, len(incoming))
+	for _, r := range incoming {
+		inBundle[r.ID] = true
+		old, ok := byID[r.ID]
+		if !ok {
+			plan = append(plan, RuleChange{Kind: ChangeCreate, Rule: r})
+			continue
+		}
+		fields := changedFields(old, &r)
+		kind := ChangeUpdate
+		if len(fields) == 0 {
+			kind = ChangeUnchanged
+		}
+		plan = append(plan, RuleChange{Kind: kind, Rule: r, Existing: old, Fields: fields})
+	}
+	if mode == ImportReplace {
+		for i := range existing {
+			old := &existing[i]
+			if !inBundle[old.ID] && replaceable(old) {
+				plan = append(plan, RuleChange{Kind: ChangeDelete, Rule: *old, Existing: old})
+			}
+		}
+	}
+	return plan
+}
+
+// changedFields returns the JSON names of fields that differ between two
+// rules, ignoring ID, ownership and timestamps.
+func changedFields(a, b *Rule) []string {
+	am, bm := ruleFields(a), ruleFields(b)
+	var out []string
+	for k := range am {
+		if !reflect.DeepEqual(am[k], bm[k]) {
+			out = append(out, k)
+		}
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func ruleFields(r *Rule) map[string]any {
+	data, _ := json.Marshal(r)
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	for _, k := range []string{"id", "author_login", "created_at", "updated_at"} {
+		delete(m, k)
+	}
+	return m
+}
+
+// ReassignIDs gives each rule whose ID is in taken a new one derived from
+// the old ID and salt (the importer's login), so importing the same bundle
+// again updates the same rules.
+func ReassignIDs(rules []Rule, taken map[string]bool, salt string) {
+	for i := range rules {
+		for id := rules[i].ID; taken[rules[i].ID]; {
+			id = stableID(salt + "/" + id)
+			rules[i].ID = id
+		}
+	}
+}
+
+// stableID derives a rule ID from its name.
+func stableID(name string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(name))))
+	return hex.EncodeToString(sum[:8])
+}
+
+func strictUnmarshal(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,94 @@
+package herald
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	rules := []Rule{
+		{ID: "b", Name: "second", AuthorLogin: "alice", CreatedAt: time.Now(),
+			Conditions: []Condition{{Type: CondFilePath, Value: "*.md"}},
+			Actions:    []Action{{Type: ActionAddLabel, Value: "docs"}}},
+		{ID: "a", Name: "first", Scope: ScopeRepository, Repository: "acme/widgets"},
+	}
+	for _, format := range []string{"yaml", "json"} {
+		data, err := MarshalBundle(rules, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "created_at") {
+			t.Errorf("%s export contains timestamps:\n%s", format, data)
+		}
+		b, err := ParseBundle(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(b.Rules) != 2 || b.Rules[0].ID != "a" || b.Rules[1].Actions[0].Value != "docs" {
+			t.Errorf("%s: round trip = %+v", format, b.Rules)
+		}
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	b, err := ParseBundle([]byte("- name: Docs\n  conditions: [{type: file_path, value: '*.md'}]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ParseBundle([]byte("- name: docs\n"))
+	if b.Rules[0].ID == "" || b.Rules[0].ID != again.Rules[0].ID {
+		t.Errorf("expected a stable ID derived from the name, got %q and %q", b.Rules[0].ID, again.Rules[0].ID)
+	}
+
+	for _, bad := range []string{
+		"rules: [{name: x, condtions: []}]",           // typo'd field
+		"version: 99\nrules: []",                      // newer format
+		"rules: [{id: a, name: x}, {id: a, name: y}]", // duplicate ID
+	} {
+		if _, err := ParseBundle([]byte(bad)); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	b, _ = ParseBundle([]byte("rules: [{name: x, conditions: [{type: title, operator: matches-regex, value: '('}]}, {name: ''}]"))
+	if errs := b.Validate(); len(errs) != 2 {
+		t.Errorf("expected 2 validation errors, got %v", errs)
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	existing := []Rule{
+		{ID: "keep", Name: "keep", AuthorLogin: "alice"},
+		{ID: "edit", Name: "edit", AuthorLogin: "alice"},
+		{ID: "mine", Name: "mine", AuthorLogin: "alice"},
+		{ID: "theirs", Name: "theirs", AuthorLogin: "bob"},
+	}
+	incoming := []Rule{
+		{ID: "keep", Name: "keep"},
+		{ID: "edit", Name: "edited", Disabled: true},
+		{ID: "new", Name: "new"},
+	}
+	kinds := func(plan []RuleChange) []string {
+		var out []string
+		for _, c := range plan {
+			out = append(out, c.Rule.ID+":"+string(c.Kind))
+		}
+		return out
+	}
+	ownedByAlice := func(r *Rule) bool { return r.AuthorLogin == "alice" }
+
+	merge := PlanImport(existing, incoming, ImportMerge, ownedByAlice)
+	if got, want := kinds(merge), []string{"keep:unchanged", "edit:update", "new:create"}; !slices.Equal(got, want) {
+		t.Errorf("merge plan = %v, want %v", got, want)
+	}
+	if !slices.Equal(merge[1].Fields, []string{"disabled", "name"}) {
+		t.Errorf("changed fields = %v", merge[1].Fields)
+	}
+
+	replace := PlanImport(existing, incoming, ImportReplace, ownedByAlice)
+	if got, want := kinds(replace), []string{"keep:unchanged", "edit:update", "new:create", "mine:delete"}; !slices.Equal(got, want) {
+		t.Errorf("replace plan = %v, want %v", got, want)
+	}
+}
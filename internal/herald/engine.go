@@ -1,16 +1,50 @@
 package herald
 
 import (
+	"fmt"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-// Evaluate runs all enabled rules against the given PR context and returns matches.
+// defaultOperators gives each condition type the operator it had before
+// operators were configurable, so older rules keep their meaning.
+var defaultOperators = map[ConditionType]Operator{
+	CondFilePath:     OpGlob,
+	CondAuthor:       OpIs,
+	CondTitle:        OpContains,
+	CondLabel:        OpIs,
+	CondBaseBranch:   OpIs,
+	CondBody:         OpContains,
+	CondHeadBranch:   OpIs,
+	CondDiffContent:  OpContains,
+	CondDiffAdded:    OpContains,
+	CondDiffRemoved:  OpContains,
+	CondLinesChanged: OpGreaterThan,
+	CondDraft:        OpIs,
+	CondRepository:   OpIs,
+	CondAuthorTeam:   OpIs,
+}
+
+// conditionAliases maps the combined type names used by the web UI
+// ("title_contains") to a type and operator.
+var conditionAliases = map[ConditionType]Condition{
+	"title_contains": {Type: CondTitle, Operator: OpContains},
+	"body_contains":  {Type: CondBody, Operator: OpContains},
+	"file_matches":   {Type: CondFilePath, Operator: OpGlob},
+	"author_is":      {Type: CondAuthor, Operator: OpIs},
+	"label_is":       {Type: CondLabel, Operator: OpIs},
+}
+
+// Evaluate runs all enabled rules that apply to the PR (see
+// Rule.AppliesToPR) and returns matches in precedence order (see Rule.Precedence). Actions
+// that contradict a higher-precedence match are dropped.
 func Evaluate(rules []Rule, ctx *PRContext) []RuleMatch {
 	var matches []RuleMatch
-	for i := range rules {
-		r := &rules[i]
-		if r.Disabled {
+	for _, r := range byPrecedence(rules) {
+		if r.Disabled || !r.AppliesToPR(ctx) {
 			continue
 		}
 		if matchRule(r, ctx) {
@@ -20,7 +54,7 @@ func Evaluate(rules []Rule, ctx *PRContext) []RuleMatch {
 			})
 		}
 	}
-	return matches
+	return dropConflicts(matches)
 }
 
 func matchRule(r *Rule, ctx *PRContext) bool {
@@ -44,32 +78,234 @@ func matchRule(r *Rule, ctx *PRContext) bool {
 	return false
 }
 
+// Trace evaluates a rule against ctx without short-circuiting, explaining
+// every condition. It never executes actions.
+func Trace(r *Rule, ctx *PRContext) RuleTrace {
+	t := RuleTrace{Rule: r, InScope: r.AppliesToPR(ctx)}
+	for i := range r.Conditions {
+		t.Conditions = append(t.Conditions, evalCondition(&r.Conditions[i], ctx))
+	}
+	t.Matched = t.InScope && matchRule(r, ctx)
+	return t
+}
+
+// normalizeCondition resolves UI aliases and fills in the default operator.
+func normalizeCondition(c Condition) Condition {
+	if alias, ok := conditionAliases[c.Type]; ok {
+		c.Type = alias.Type
+		if c.Operator == "" {
+			c.Operator = alias.Operator
+		}
+	}
+	if c.Operator == "" {
+		c.Operator = defaultOperators[c.Type]
+	}
+	return c
+}
+
 func matchCondition(c *Condition, ctx *PRContext) bool {
-	switch c.Type {
+	return evalCondition(c, ctx).Matched
+}
+
+// evalCondition evaluates a single condition and explains the outcome.
+func evalCondition(c *Condition, ctx *PRContext) ConditionResult {
+	n := normalizeCondition(*c)
+	res := ConditionResult{Condition: n}
+	switch n.Type {
 	case CondAuthor:
-		return strings.EqualFold(ctx.Author, c.Value)
+		res.Matched, res.Reason = matchOne(n, "author", ctx.Author)
 	case CondTitle:
-		return strings.Contains(strings.ToLower(ctx.Title), strings.ToLower(c.Value))
-	case CondLabel:
-		for _, l := range ctx.Labels {
-			if strings.EqualFold(l, c.Value) {
-				return true
-			}
-		}
-		return false
+		res.Matched, res.Reason = matchOne(n, "title", ctx.Title)
+	case CondBody:
+		res.Matched, res.Reason = matchOne(n, "body", ctx.Body)
 	case CondBaseBranch:
-		return ctx.BaseBranch == c.Value
+		res.Matched, res.Reason = matchOne(n, "base branch", ctx.BaseBranch)
+	case CondHeadBranch:
+		res.Matched, res.Reason = matchOne(n, "head branch", ctx.HeadBranch)
+	case CondRepository:
+		res.Matched, res.Reason = matchOne(n, "repository", ctx.FullRepo())
+	case CondLabel:
+		res.Matched, res.Reason = matchAny(n, "label", ctx.Labels)
 	case CondFilePath:
-		for _, f := range ctx.ChangedFiles {
-			if matched, _ := filepath.Match(c.Value, f); matched {
-				return true
-			}
-			// Also try matching against just the filename
-			if matched, _ := filepath.Match(c.Value, filepath.Base(f)); matched {
-				return true
-			}
+		res.Matched, res.Reason = matchFiles(n, ctx.ChangedFiles)
+	case CondDiffContent:
+		lines := append(append([]string(nil), ctx.AddedLines...), ctx.RemovedLines...)
+		res.Matched, res.Reason = matchAny(n, "changed line", lines)
+	case CondDiffAdded:
+		res.Matched, res.Reason = matchAny(n, "added line", ctx.AddedLines)
+	case CondDiffRemoved:
+		res.Matched, res.Reason = matchAny(n, "removed line", ctx.RemovedLines)
+	case CondLinesChanged:
+		res.Matched, res.Reason = matchLinesChanged(n, ctx.LinesAdded+ctx.LinesRemoved)
+	case CondDraft:
+		res.Matched, res.Reason = matchDraft(n, ctx.Draft)
+	case CondAuthorTeam:
+		res.Matched, res.Reason = matchTeam(n, ctx)
+	default:
+		res.Reason = fmt.Sprintf("unknown condition type %q", n.Type)
+	}
+	return res
+}
+
+// matchOne applies a string condition to a single value.
+func matchOne(c Condition, noun, s string) (bool, string) {
+	pred, negate, err := matcher(c.Operator, c.Value)
+	if err != nil {
+		return false, err.Error()
+	}
+	hit := pred(s)
+	verb, notVerb := verbs(c.Operator)
+	if !hit {
+		verb = notVerb
+	}
+	return hit != negate, fmt.Sprintf("%s %q %s %q", noun, snippet(s), verb, c.Value)
+}
+
+// matchAny applies a string condition to a list. Positive operators match if
+// any item matches; negated operators match if no item does.
+func matchAny(c Condition, noun string, items []string) (bool, string) {
+	pred, negate, err := matcher(c.Operator, c.Value)
+	if err != nil {
+		return false, err.Error()
+	}
+	verb, _ := verbs(c.Operator)
+	for _, s := range items {
+		if pred(s) {
+			return !negate, fmt.Sprintf("%s %q %s %q", noun, snippet(s), verb, c.Value)
 		}
-		return false
 	}
-	return false
+	return negate, fmt.Sprintf("no %s %s %q", noun, verb, c.Value)
+}
+
+// matchFiles is matchAny for changed paths, where globs also match against
+// just the filename.
+func matchFiles(c Condition, files []string) (bool, string) {
+	pred, negate, err := matcher(c.Operator, c.Value)
+	if err != nil {
+		return false, err.Error()
+	}
+	verb, _ := verbs(c.Operator)
+	for _, f := range files {
+		if pred(f) || (c.Operator == OpGlob && pred(filepath.Base(f))) {
+			return !negate, fmt.Sprintf("file %q %s %q", f, verb, c.Value)
+		}
+	}
+	return negate, fmt.Sprintf("no file %s %q", verb, c.Value)
+}
+
+func matchLinesChanged(c Condition, total int) (bool, string) {
+	threshold, err := strconv.Atoi(strings.TrimSpace(c.Value))
+	if err != nil {
+		return false, fmt.Sprintf("invalid line count %q", c.Value)
+	}
+	var hit bool
+	switch c.Operator {
+	case OpGreaterThan:
+		hit = total > threshold
+	case OpLessThan:
+		hit = total < threshold
+	case OpIs:
+		hit = total == threshold
+	case OpIsNot:
+		hit = total != threshold
+	default:
+		return false, fmt.Sprintf("operator %q not supported for %s", c.Operator, c.Type)
+	}
+	return hit, fmt.Sprintf("%d lines changed, %s %d: %v", total, c.Operator, threshold, hit)
+}
+
+func matchDraft(c Condition, draft bool) (bool, string) {
+	want, err := strconv.ParseBool(strings.TrimSpace(c.Value))
+	if err != nil {
+		return false, fmt.Sprintf("invalid draft value %q (want true or false)", c.Value)
+	}
+	reason := "PR is not a draft"
+	if draft {
+		reason = "PR is a draft"
+	}
+	switch c.Operator {
+	case OpIs:
+		return draft == want, reason
+	case OpIsNot:
+		return draft != want, reason
+	}
+	return false, fmt.Sprintf("operator %q not supported for %s", c.Operator, c.Type)
+}
+
+func matchTeam(c Condition, ctx *PRContext) (bool, string) {
+	if ctx.TeamMember == nil {
+		return false, "team membership unavailable"
+	}
+	if c.Operator != OpIs && c.Operator != OpIsNot {
+		return false, fmt.Sprintf("operator %q not supported for %s", c.Operator, c.Type)
+	}
+	member := ctx.TeamMember(c.Value)
+	reason := fmt.Sprintf("%s is not a member of %s", ctx.Author, c.Value)
+	if member {
+		reason = fmt.Sprintf("%s is a member of %s", ctx.Author, c.Value)
+	}
+	return member == (c.Operator == OpIs), reason
+}
+
+// matcher returns a predicate for the positive form of op (is-not becomes
+// is, does-not-contain becomes contains) and whether op negates it.
+// Comparisons are case-insensitive except for regexes and globs.
+func matcher(op Operator, value string) (pred func(string) bool, negate bool, err error) {
+	switch op {
+	case OpIsNot:
+		negate = true
+		fallthrough
+	case OpIs:
+		return func(s string) bool { return strings.EqualFold(s, value) }, negate, nil
+	case OpDoesNotContain:
+		negate = true
+		fallthrough
+	case OpContains:
+		lower := strings.ToLower(value)
+		return func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }, negate, nil
+	case OpMatchesRegex:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid regex %q: %v", value, err)
+		}
+		return re.MatchString, false, nil
+	case OpGlob:
+		if _, err := filepath.Match(value, ""); err != nil {
+			return nil, false, fmt.Errorf("invalid glob %q: %v", value, err)
+		}
+		return func(s string) bool {
+			matched, _ := filepath.Match(value, s)
+			return matched
+		}, false, nil
+	}
+	return nil, false, fmt.Errorf("operator %q not supported here", op)
+}
+
+// verbs returns the phrases describing a positive and failed match for op.
+func verbs(op Operator) (verb, notVerb string) {
+	switch op {
+	case OpIs, OpIsNot:
+		return "is", "is not"
+	case OpContains, OpDoesNotContain:
+		return "contains", "does not contain"
+	case OpMatchesRegex:
+		return "matches regex", "does not match regex"
+	case OpGlob:
+		return "matches glob", "does not match glob"
+	}
+	return string(op), "not " + string(op)
+}
+
+// snippet shortens long values (PR bodies, diff lines) for trace output.
+func snippet(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= 80 {
+		return s
+	}
+	// Cut on a rune boundary so the trace stays valid UTF-8.
+	n := 80
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
 }
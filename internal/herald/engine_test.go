@@ -0,0 +1,139 @@
+package herald
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func testContext() *PRContext {
+	return &PRContext{
+		Owner:        "acme",
+		Repo:         "widgets",
+		Number:       42,
+		Author:       "octocat",
+		Title:        "Fix widget rendering",
+		Body:         "Closes #12. Touches the SECURITY boundary.",
+		Draft:        true,
+		Labels:       []string{"bug", "ui"},
+		BaseBranch:   "main",
+		HeadBranch:   "release/1.2",
+		ChangedFiles: []string{"internal/widget/render.go", "docs/widgets.md"},
+		AddedLines:   []string{"\tpassword := os.Getenv(\"PW\")"},
+		RemovedLines: []string{"\t// TODO: remove"},
+		LinesAdded:   120,
+		LinesRemoved: 30,
+		TeamMember:   func(team string) bool { return team == "acme/core" },
+	}
+}
+
+func TestMatchCondition(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		// Defaults preserve the pre-operator behaviour.
+		{"author default", Condition{Type: CondAuthor, Value: "OctoCat"}, true},
+		{"title default", Condition{Type: CondTitle, Value: "widget"}, true},
+		{"file glob default", Condition{Type: CondFilePath, Value: "*.md"}, true},
+		{"file glob full path", Condition{Type: CondFilePath, Value: "internal/*/*.go"}, true},
+		{"base default", Condition{Type: CondBaseBranch, Value: "main"}, true},
+
+		{"author is-not", Condition{Type: CondAuthor, Operator: OpIsNot, Value: "octocat"}, false},
+		{"title does-not-contain", Condition{Type: CondTitle, Operator: OpDoesNotContain, Value: "WIP"}, true},
+		{"title regex", Condition{Type: CondTitle, Operator: OpMatchesRegex, Value: `^Fix\b`}, true},
+		{"invalid regex", Condition{Type: CondTitle, Operator: OpMatchesRegex, Value: `(`}, false},
+		{"body contains", Condition{Type: CondBody, Value: "security"}, true},
+		{"head glob", Condition{Type: CondHeadBranch, Operator: OpGlob, Value: "release/*"}, true},
+		{"repository", Condition{Type: CondRepository, Value: "acme/widgets"}, true},
+		{"label is-not", Condition{Type: CondLabel, Operator: OpIsNot, Value: "bug"}, false},
+		{"label is-not absent", Condition{Type: CondLabel, Operator: OpIsNot, Value: "docs"}, true},
+		{"file does-not-contain", Condition{Type: CondFilePath, Operator: OpDoesNotContain, Value: "vendor/"}, true},
+
+		{"diff added", Condition{Type: CondDiffAdded, Value: "password"}, true},
+		{"diff removed", Condition{Type: CondDiffRemoved, Value: "password"}, false},
+		{"diff content", Condition{Type: CondDiffContent, Operator: OpMatchesRegex, Value: `TODO`}, true},
+
+		{"lines over", Condition{Type: CondLinesChanged, Value: "100"}, true},
+		{"lines under", Condition{Type: CondLinesChanged, Operator: OpLessThan, Value: "100"}, false},
+		{"lines bad value", Condition{Type: CondLinesChanged, Value: "lots"}, false},
+
+		{"draft", Condition{Type: CondDraft, Value: "true"}, true},
+		{"not draft", Condition{Type: CondDraft, Operator: OpIsNot, Value: "true"}, false},
+
+		{"team member", Condition{Type: CondAuthorTeam, Value: "acme/core"}, true},
+		{"team non-member", Condition{Type: CondAuthorTeam, Value: "acme/docs"}, false},
+		{"team is-not", Condition{Type: CondAuthorTeam, Operator: OpIsNot, Value: "acme/docs"}, true},
+
+		// Web UI aliases.
+		{"alias body_contains", Condition{Type: "body_contains", Value: "closes"}, true},
+		{"alias file_matches", Condition{Type: "file_matches", Value: "*.go"}, true},
+
+		{"unknown type", Condition{Type: "nope", Value: "x"}, false},
+	}
+	ctx := testContext()
+	for _, tc := range tests {
+		if got := matchCondition(&tc.cond, ctx); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTeamConditionWithoutResolver(t *testing.T) {
+	ctx := testContext()
+	ctx.TeamMember = nil
+	for _, op := range []Operator{OpIs, OpIsNot} {
+		c := Condition{Type: CondAuthorTeam, Operator: op, Value: "acme/core"}
+		if matchCondition(&c, ctx) {
+			t.Errorf("%s: matched without a team resolver", op)
+		}
+	}
+}
+
+func TestTraceExplainsEveryCondition(t *testing.T) {
+	r := &Rule{
+		MustMatchAll: true,
+		Conditions: []Condition{
+			{Type: CondFilePath, Value: "*.md"},
+			{Type: CondAuthor, Value: "hubot"},
+			{Type: CondTitle, Operator: OpMatchesRegex, Value: "("},
+		},
+		Actions: []Action{{Type: ActionAddLabel, Value: "docs"}},
+	}
+	tr := Trace(r, testContext())
+	if tr.Matched {
+		t.Error("rule should not match")
+	}
+	if len(tr.Conditions) != 3 {
+		t.Fatalf("expected 3 condition results, got %d", len(tr.Conditions))
+	}
+	want := []struct {
+		matched bool
+		reason  string
+	}{
+		{true, `file "docs/widgets.md" matches glob "*.md"`},
+		{false, `author "octocat" is not "hubot"`},
+		{false, "invalid regex \"(\": error parsing regexp: missing closing ): `(`"},
+	}
+	for i, w := range want {
+		got := tr.Conditions[i]
+		if got.Matched != w.matched || got.Reason != w.reason {
+			t.Errorf("condition %d: got (%v, %q), want (%v, %q)", i, got.Matched, got.Reason, w.matched, w.reason)
+		}
+	}
+	if tr.Conditions[0].Condition.Operator != OpGlob {
+		t.Errorf("expected normalized operator glob, got %q", tr.Conditions[0].Condition.Operator)
+	}
+}
+
+func TestSnippetKeepsUTF8(t *testing.T) {
+	s := strings.Repeat("a", 79) + "é and more"
+	got := snippet(s)
+	if !utf8.ValidString(got) {
+		t.Fatalf("snippet(%q) = %q, not valid UTF-8", s, got)
+	}
+	if got != strings.Repeat("a", 79)+"..." {
+		t.Errorf("snippet = %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package herald
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// Executor applies matched rule actions to a pull request on GitHub.
+// Every action is recorded in the ActionLog and every firing in the
+// TranscriptStore. Rules fire again only as their repetition policy allows,
+// and actions of first-time rules already applied to a PR are never repeated.
+// Each action is claimed in the log before it is applied, so executors in
+// several processes sharing the log don't apply it twice.
+type Executor struct {
+	log         *ActionLog
+	transcripts *TranscriptStore
+	locks       sync.Map // "owner/repo#number" -> *sync.Mutex
+}
+
+// NewExecutor creates an executor that records to the given log and
+// transcript store.
+func NewExecutor(l *ActionLog, t *TranscriptStore) *Executor {
+	return &Executor{log: l, transcripts: t}
+}
+
+// Log returns the executor's action log.
+func (e *Executor) Log() *ActionLog { return e.log }
+
+// Transcripts returns the executor's transcript store.
+func (e *Executor) Transcripts() *TranscriptStore { return e.transcripts }
+
+// Execute applies the actions of all matches to the PR described by pr and
+// returns the log entries it wrote. Rules that already fired are skipped
+// without a transcript, and actions already applied without a log entry.
+// Blocking reviewers are synced on every call. Held matches are skipped,
+// but their blocker statuses aren't cleared as stale.
+func (e *Executor) Execute(ctx context.Context, client *gh.Client, pr *PRContext, matches []RuleMatch) []LogEntry {
+	mu, _ := e.locks.LoadOrStore(fmt.Sprintf("%s#%d", pr.FullRepo(), pr.Number), &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	var (
+		entries     []LogEntry
+		transcripts []Transcript
+	)
+	seen := make(map[Action]bool)
+	var run, held []RuleMatch
+	for _, m := range matches {
+		if m.Held {
+			held = append(held, m)
+		} else {
+			run = append(run, m)
+		}
+	}
+	for _, m := range run {
+		fired, err := e.transcripts.Fired(m.Rule, pr)
+		if err != nil {
+			log.Printf("herald: read transcripts: %v", err)
+			return entries
+		}
+		if fired {
+			continue
+		}
+
+		t := Transcript{
+			RuleID:     m.Rule.ID,
+			RuleName:   m.Rule.Name,
+			Repetition: m.Rule.EffectiveRepetition(),
+			Repo:       pr.FullRepo(),
+			Number:     pr.Number,
+			HeadSHA:    pr.HeadSHA,
+			Conditions: Trace(m.Rule, pr).Conditions,
+			Actions:    []LogEntry{},
+			At:         time.Now(),
+		}
+		for _, a := range m.Actions {
+			if seen[a] || a.Type == ActionBlockingReviewer {
+				continue
+			}
+			seen[a] = true
+
+			if t.Repetition == RepeatFirst {
+				done, err := e.log.Done(pr.FullRepo(), pr.Number, a)
+				if err != nil {
+					t.Errors = append(t.Errors, fmt.Sprintf("read action log: %v", err))
+					continue
+				}
+				if done {
+					continue
+				}
+			}
+
+			entry := LogEntry{
+				Repo:     pr.FullRepo(),
+				Number:   pr.Number,
+				RuleID:   m.Rule.ID,
+				RuleName: m.Rule.Name,
+				Action:   a,
+				At:       time.Now(),
+			}
+			firing := ""
+			if t.Repetition == RepeatEvery {
+				firing = pr.HeadSHA
+			}
+			claimed, err := e.log.Claim(&entry, firing)
+			if err != nil {
+				t.Errors = append(t.Errors, fmt.Sprintf("write action log: %v", err))
+				continue
+			}
+			if !claimed {
+				// Another process is applying it, or already has.
+				continue
+			}
+			if satisfied(pr, a) {
+				entry.Status = StatusSkipped
+			} else if err := apply(ctx, client, pr, a); err != nil {
+				entry.Status = StatusFailed
+				entry.Error = err.Error()
+			} else {
+				entry.Status = StatusApplied
+			}
+			if err := e.log.Finish(entry); err != nil {
+				log.Printf("herald: write action log: %v", err)
+			}
+			entries = append(entries, entry)
+			t.Actions = append(t.Actions, entry)
+		}
+		transcripts = append(transcripts, t)
+	}
+	synced := syncBlockers(ctx, client, pr, Blockers(run, pr), Blockers(held, pr))
+	entries = append(entries, synced...)
+
+	if err := e.log.Append(synced...); err != nil {
+		log.Printf("herald: write action log: %v", err)
+	}
+	if err := e.transcripts.Append(transcripts...); err != nil {
+		log.Printf("herald: write transcripts: %v", err)
+	}
+	return entries
+}
+
+// satisfied reports whether the PR already reflects the action, so applying
+// it would be a no-op (or, for reviewers, an error from GitHub).
+func satisfied(pr *PRContext, a Action) bool {
+	switch a.Type {
+	case ActionAddReviewer:
+		// GitHub rejects requesting review from the author.
+		return strings.EqualFold(a.Value, pr.Author) || containsFold(pr.Reviewers, a.Value)
+	case ActionRequestTeamReview:
+		return containsFold(pr.TeamReviewers, a.Value)
+	case ActionAddAssignee:
+		return containsFold(pr.Assignees, a.Value)
+	case ActionAddLabel:
+		return containsFold(pr.Labels, a.Value)
+	case ActionRemoveLabel:
+		return !containsFold(pr.Labels, a.Value)
+	case ActionSetDraft:
+		want, err := strconv.ParseBool(strings.TrimSpace(a.Value))
+		return err == nil && pr.Draft == want
+	}
+	return false
+}
+
+func apply(ctx context.Context, client *gh.Client, pr *PRContext, a Action) error {
+	if strings.TrimSpace(a.Value) == "" {
+		return fmt.Errorf("%s: empty value", a.Type)
+	}
+	switch a.Type {
+	case ActionAddReviewer:
+		return ghapi.RequestReviewers(ctx, client, pr.Owner, pr.Repo, pr.Number, []string{a.Value})
+	case ActionAddLabel:
+		return ghapi.AddLabels(ctx, client, pr.Owner, pr.Repo, pr.Number, []string{a.Value})
+	case ActionPostComment:
+		return ghapi.CreateIssueComment(ctx, client, pr.Owner, pr.Repo, pr.Number, a.Value)
+	case ActionRequestTeamReview:
+		org, slug, ok := strings.Cut(a.Value, "/")
+		if !ok || slug == "" {
+			return fmt.Errorf("%s: want org/team, got %q", a.Type, a.Value)
+		}
+		if !strings.EqualFold(org, pr.Owner) {
+			return fmt.Errorf("%s: team %s is not in the %s organization", a.Type, a.Value, pr.Owner)
+		}
+		return ghapi.RequestTeamReviewers(ctx, client, pr.Owner, pr.Repo, pr.Number, []string{slug})
+	case ActionAddAssignee:
+		return ghapi.AddAssignees(ctx, client, pr.Owner, pr.Repo, pr.Number, []string{a.Value})
+	case ActionRemoveLabel:
+		return ghapi.RemoveLabel(ctx, client, pr.Owner, pr.Repo, pr.Number, a.Value)
+	case ActionSetDraft:
+		draft, err := strconv.ParseBool(strings.TrimSpace(a.Value))
+		if err != nil {
+			return fmt.Errorf("%s: want true or false, got %q", a.Type, a.Value)
+		}
+		return ghapi.SetPRDraft(ctx, client, pr.Owner, pr.Repo, pr.Number, draft)
+	}
+	return fmt.Errorf("unknown action type %q", a.Type)
+}
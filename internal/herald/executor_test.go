@@ -0,0 +1,441 @@
+package herald
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// fakeGitHub records the REST calls made against it.
+type fakeGitHub struct {
+	mu     sync.Mutex
+	calls  []string
+	status string // combined commit status body, if set
+}
+
+func (f *fakeGitHub) client(t *testing.T) *gh.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/o/r/issues/7/labels":
+			w.Write([]byte(`[]`))
+		case "/repos/o/r/commits/abc/status":
+			w.Write([]byte(cmp.Or(f.status, `{}`)))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c := gh.NewClient(nil)
+	c.BaseURL, _ = url.Parse(srv.URL + "/")
+	return c
+}
+
+func newTestExecutor(t *testing.T) *Executor {
+	b, err := OpenSQLiteBackend(filepath.Join(t.TempDir(), "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return NewExecutor(b.ActionLog(), b.Transcripts())
+}
+
+func TestExecuteIsIdempotent(t *testing.T) {
+	fake := &fakeGitHub{}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	rule := &Rule{ID: "r1", Name: "docs"}
+	matches := []RuleMatch{{
+		Rule: rule,
+		Actions: []Action{
+			{Type: ActionAddReviewer, Value: "alice"},
+			{Type: ActionAddLabel, Value: "docs"},
+			{Type: ActionPostComment, Value: "thanks"},
+		},
+	}}
+	pr := &PRContext{Owner: "o", Repo: "r", Number: 7, Author: "bob"}
+
+	first := exec.Execute(context.Background(), client, pr, matches)
+	if len(first) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(first))
+	}
+	for _, e := range first {
+		if e.Status != StatusApplied {
+			t.Errorf("%s: status %s (%s)", e.Action.Type, e.Status, e.Error)
+		}
+	}
+	if len(fake.calls) != 3 {
+		t.Fatalf("expected 3 GitHub calls, got %v", fake.calls)
+	}
+
+	second := exec.Execute(context.Background(), client, pr, matches)
+	if len(second) != 0 {
+		t.Errorf("expected no entries on re-run, got %+v", second)
+	}
+	if len(fake.calls) != 3 {
+		t.Errorf("re-run made GitHub calls: %v", fake.calls[3:])
+	}
+
+	logged, err := exec.Log().ForPR("o/r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 3 {
+		t.Errorf("expected 3 logged entries, got %d", len(logged))
+	}
+}
+
+func TestExecuteSkipsSatisfiedActions(t *testing.T) {
+	fake := &fakeGitHub{}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	matches := []RuleMatch{{
+		Rule: &Rule{ID: "r1"},
+		Actions: []Action{
+			{Type: ActionAddReviewer, Value: "Alice"},
+			{Type: ActionAddReviewer, Value: "bob"},
+			{Type: ActionAddLabel, Value: "docs"},
+		},
+	}}
+	pr := &PRContext{
+		Owner: "o", Repo: "r", Number: 7,
+		Author:    "bob",
+		Reviewers: []string{"alice"},
+		Labels:    []string{"Docs"},
+	}
+
+	entries := exec.Execute(context.Background(), client, pr, matches)
+	for _, e := range entries {
+		if e.Status != StatusSkipped {
+			t.Errorf("%s %s: expected skipped, got %s", e.Action.Type, e.Action.Value, e.Status)
+		}
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no GitHub calls, got %v", fake.calls)
+	}
+}
+
+func TestExecuteRepetitionPolicy(t *testing.T) {
+	fake := &fakeGitHub{}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	comment := Action{Type: ActionPostComment, Value: "please add a changelog entry"}
+	matches := []RuleMatch{
+		{Rule: &Rule{ID: "once", Name: "once"}, Actions: []Action{{Type: ActionAddLabel, Value: "docs"}}},
+		{Rule: &Rule{ID: "each", Name: "each", Repetition: RepeatEvery}, Actions: []Action{comment}},
+	}
+	pr := &PRContext{Owner: "o", Repo: "r", Number: 7, Author: "bob", HeadSHA: "aaa"}
+
+	if n := len(exec.Execute(context.Background(), client, pr, matches)); n != 2 {
+		t.Fatalf("first run: expected 2 entries, got %d", n)
+	}
+	// Same head SHA: neither rule fires again.
+	if n := len(exec.Execute(context.Background(), client, pr, matches)); n != 0 {
+		t.Fatalf("same SHA: expected no entries, got %d", n)
+	}
+	// New push: only the every-time rule fires, and re-posts its comment.
+	pr.HeadSHA = "bbb"
+	again := exec.Execute(context.Background(), client, pr, matches)
+	if len(again) != 1 || again[0].RuleID != "each" || again[0].Status != StatusApplied {
+		t.Fatalf("new SHA: expected the comment again, got %+v", again)
+	}
+
+	ts, err := exec.Transcripts().List(TranscriptFilter{Repo: "o/r", Number: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 3 {
+		t.Fatalf("expected 3 transcripts, got %d", len(ts))
+	}
+	if ts[0].RuleID != "each" || ts[0].HeadSHA != "bbb" || len(ts[0].Actions) != 1 {
+		t.Errorf("newest transcript = %+v", ts[0])
+	}
+	if only, _ := exec.Transcripts().List(TranscriptFilter{RuleID: "once"}); len(only) != 1 {
+		t.Errorf("expected 1 transcript for rule once, got %d", len(only))
+	}
+}
+
+func TestExecuteNewActionTypes(t *testing.T) {
+	fake := &fakeGitHub{}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	matches := []RuleMatch{{
+		Rule: &Rule{ID: "r1"},
+		Actions: []Action{
+			{Type: ActionRequestTeamReview, Value: "o/core"},
+			{Type: ActionRequestTeamReview, Value: "other/core"},
+			{Type: ActionAddAssignee, Value: "alice"},
+			{Type: ActionAddAssignee, Value: "carol"},
+			{Type: ActionRemoveLabel, Value: "wip"},
+			{Type: ActionRemoveLabel, Value: "absent"},
+			{Type: ActionSetDraft, Value: "false"},
+		},
+	}}
+	pr := &PRContext{
+		Owner: "o", Repo: "r", Number: 7, Author: "bob", Draft: true,
+		Labels:    []string{"WIP"},
+		Assignees: []string{"carol"},
+	}
+
+	status := make(map[Action]ActionStatus)
+	for _, e := range exec.Execute(context.Background(), client, pr, matches) {
+		status[e.Action] = e.Status
+	}
+	want := map[Action]ActionStatus{
+		{Type: ActionRequestTeamReview, Value: "o/core"}:     StatusApplied,
+		{Type: ActionRequestTeamReview, Value: "other/core"}: StatusFailed,
+		{Type: ActionAddAssignee, Value: "alice"}:            StatusApplied,
+		{Type: ActionAddAssignee, Value: "carol"}:            StatusSkipped,
+		{Type: ActionRemoveLabel, Value: "wip"}:              StatusApplied,
+		{Type: ActionRemoveLabel, Value: "absent"}:           StatusSkipped,
+		{Type: ActionSetDraft, Value: "false"}:               StatusApplied,
+	}
+	for a, s := range want {
+		if status[a] != s {
+			t.Errorf("%s %s: status %q, want %q", a.Type, a.Value, status[a], s)
+		}
+	}
+	wantCalls := []string{
+		"POST /repos/o/r/pulls/7/requested_reviewers",
+		"POST /repos/o/r/issues/7/assignees",
+		"DELETE /repos/o/r/issues/7/labels/wip",
+		"GET /repos/o/r/pulls/7",
+		"POST /graphql",
+	}
+	if !slices.Equal(fake.calls, wantCalls) {
+		t.Errorf("GitHub calls = %v, want %v", fake.calls, wantCalls)
+	}
+}
+
+func TestExecuteSyncsBlockingReviewers(t *testing.T) {
+	fake := &fakeGitHub{}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	matches := []RuleMatch{{
+		Rule:    &Rule{ID: "r1", Name: "security"},
+		Actions: []Action{{Type: ActionBlockingReviewer, Value: "alice"}},
+	}}
+	pr := &PRContext{Owner: "o", Repo: "r", Number: 7, Author: "bob", HeadSHA: "abc"}
+
+	blockers := Blockers(matches, pr)
+	if len(blockers) != 1 || blockers[0].Approved || blockers[0].StatusContext() != "herald/review/alice" {
+		t.Fatalf("blockers = %+v", blockers)
+	}
+	entries := exec.Execute(context.Background(), client, pr, matches)
+	if len(entries) != 1 || entries[0].Status != StatusApplied {
+		t.Fatalf("entries = %+v", entries)
+	}
+	wantCalls := []string{
+		"GET /repos/o/r/commits/abc/status",
+		"POST /repos/o/r/pulls/7/requested_reviewers",
+		"POST /repos/o/r/statuses/abc",
+	}
+	if !slices.Equal(fake.calls, wantCalls) {
+		t.Errorf("GitHub calls = %v, want %v", fake.calls, wantCalls)
+	}
+
+	// Blockers are re-synced even though the rule has already fired.
+	pr.Approvers = []string{"Alice"}
+	if !Blockers(matches, pr)[0].Approved {
+		t.Error("approval not detected")
+	}
+	exec.Execute(context.Background(), client, pr, matches)
+	if len(fake.calls) != 5 {
+		t.Errorf("expected the status to be updated, calls = %v", fake.calls)
+	}
+}
+
+func TestExecuteClearsStaleBlockers(t *testing.T) {
+	fake := &fakeGitHub{status: `{"statuses": [
+		{"context": "herald/review/alice", "state": "failure"},
+		{"context": "herald/review/carol", "state": "success"},
+		{"context": "ci/build", "state": "failure"}
+	]}`}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	// No rule asks for alice any more.
+	pr := &PRContext{Owner: "o", Repo: "r", Number: 7, Author: "bob", HeadSHA: "abc"}
+	entries := exec.Execute(context.Background(), client, pr, nil)
+	if len(entries) != 1 || entries[0].Action.Value != "alice" || entries[0].Status != StatusApplied {
+		t.Fatalf("entries = %+v", entries)
+	}
+	wantCalls := []string{"GET /repos/o/r/commits/abc/status", "POST /repos/o/r/statuses/abc"}
+	if !slices.Equal(fake.calls, wantCalls) {
+		t.Errorf("GitHub calls = %v, want %v", fake.calls, wantCalls)
+	}
+}
+
+func TestExecuteSkipsHeldMatches(t *testing.T) {
+	fake := &fakeGitHub{status: `{"statuses": [{"context": "herald/review/alice", "state": "failure"}]}`}
+	client := fake.client(t)
+	exec := newTestExecutor(t)
+
+	// Carol's personal rule, in a run with bob's token.
+	matches := HoldPersonal([]RuleMatch{{
+		Rule: &Rule{ID: "r1", Name: "mine", AuthorLogin: "carol", Scope: ScopePersonal},
+		Actions: []Action{
+			{Type: ActionAddLabel, Value: "x"},
+			{Type: ActionBlockingReviewer, Value: "alice"},
+		},
+	}}, "bob")
+	pr := &PRContext{Owner: "o", Repo: "r", Number: 7, Author: "bob", HeadSHA: "abc"}
+	if entries := exec.Execute(context.Background(), client, pr, matches); len(entries) != 0 {
+		t.Errorf("entries = %+v, want none", entries)
+	}
+	if want := []string{"GET /repos/o/r/commits/abc/status"}; !slices.Equal(fake.calls, want) {
+		t.Errorf("GitHub calls = %v, want %v", fake.calls, want)
+	}
+	if !HoldPersonal(matches, "Carol")[0].Held {
+		t.Error("a held match stays held")
+	}
+}
+
+func TestActionLogClaims(t *testing.T) {
+	b, err := OpenSQLiteBackend(filepath.Join(t.TempDir(), "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	l := b.ActionLog()
+
+	a := Action{Type: ActionAddLabel, Value: "docs"}
+	claim := func(firing string) (*LogEntry, bool) {
+		e := &LogEntry{Repo: "o/r", Number: 7, RuleID: "r1", Action: a}
+		ok, err := l.Claim(e, firing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e, ok
+	}
+
+	first, ok := claim("")
+	if !ok {
+		t.Fatal("first claim refused")
+	}
+	if _, ok := claim(""); ok {
+		t.Error("second claim of a pending action succeeded")
+	}
+	if done, _ := l.Done("o/r", 7, a); !done {
+		t.Error("pending action not done")
+	}
+
+	// A failure releases the claim for a retry.
+	first.Status = StatusFailed
+	if err := l.Finish(*first); err != nil {
+		t.Fatal(err)
+	}
+	retry, ok := claim("")
+	if !ok {
+		t.Fatal("claim after a failure refused")
+	}
+	retry.Status = StatusApplied
+	if err := l.Finish(*retry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claim(""); ok {
+		t.Error("claimed an applied action")
+	}
+	if _, ok := claim("abc"); !ok {
+		t.Error("claim for a new head SHA refused")
+	}
+
+	entries, err := l.ForPR("o/r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ActionStatus
+	for _, e := range entries {
+		got = append(got, e.Status)
+	}
+	if want := []ActionStatus{StatusFailed, StatusApplied, StatusPending}; !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+}
+
+func TestImportHistoryKeepsUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "herald-actions.json")
+	corrupt := []byte(`[{"repo": "o/r"`)
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenSQLiteBackend(filepath.Join(dir, "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.ImportHistory(dir); err == nil {
+		t.Error("imported a corrupt log")
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(corrupt) {
+		t.Errorf("corrupt log changed: %s", data)
+	}
+
+	// Once the file is fixed, the import goes through on the next start.
+	entries, _ := json.Marshal([]LogEntry{{Repo: "o/r", Number: 7, Action: Action{Type: ActionAddLabel, Value: "docs"}, Status: StatusApplied}})
+	if err := os.WriteFile(path, entries, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ImportHistory(dir); err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := b.ActionLog().Done("o/r", 7, Action{Type: ActionAddLabel, Value: "docs"}); !done {
+		t.Error("imported action not done")
+	}
+}
+
+func TestActionLogReleasesAbandonedClaims(t *testing.T) {
+	b, err := OpenSQLiteBackend(filepath.Join(t.TempDir(), "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	l := b.ActionLog()
+
+	// A run claims the action and dies before finishing it.
+	a := Action{Type: ActionAddLabel, Value: "docs"}
+	if ok, err := l.Claim(&LogEntry{Repo: "o/r", Number: 7, RuleID: "r1", Action: a}, ""); !ok || err != nil {
+		t.Fatalf("claim = %v, %v", ok, err)
+	}
+	if done, _ := l.Done("o/r", 7, a); !done {
+		t.Fatal("fresh claim not done")
+	}
+
+	l.claimTimeout = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if done, _ := l.Done("o/r", 7, a); done {
+		t.Error("abandoned claim still counts as done")
+	}
+	retry := &LogEntry{Repo: "o/r", Number: 7, RuleID: "r1", Action: a}
+	if ok, err := l.Claim(retry, ""); !ok || err != nil {
+		t.Fatalf("claim after an abandoned one = %v, %v", ok, err)
+	}
+
+	entries, err := l.ForPR("o/r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Status != StatusFailed || entries[0].Error == "" || entries[1].Status != StatusPending {
+		t.Errorf("entries = %+v, want the abandoned claim failed and the retry pending", entries)
+	}
+}
@@ -0,0 +1,185 @@
+package herald
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// claimTimeout is how long a claim may stay pending. A run that dies or
+// times out between Claim and Finish leaves its claim behind; once it is
+// this old, the claim counts as failed and the action is retried. Execute's
+// GitHub calls are bounded well within it.
+const claimTimeout = 5 * time.Minute
+
+// ActionStatus is the outcome of a single action execution.
+type ActionStatus string
+
+const (
+	StatusPending ActionStatus = "pending" // claimed by a run that hasn't finished
+	StatusApplied ActionStatus = "applied" // action was performed on GitHub
+	StatusSkipped ActionStatus = "skipped" // PR already satisfied the action
+	StatusFailed  ActionStatus = "failed"  // GitHub call failed; retried next time
+)
+
+// LogEntry records one action Herald took (or tried to take) on a PR.
+type LogEntry struct {
+	Repo     string       `json:"repo"` // "owner/repo"
+	Number   int          `json:"number"`
+	RuleID   string       `json:"rule_id"`
+	RuleName string       `json:"rule_name"`
+	Action   Action       `json:"action"`
+	Status   ActionStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	At       time.Time    `json:"at"`
+
+	seq int64 // row of a claimed entry
+}
+
+// ActionLog persists executed Herald actions in the herald_actions table,
+// which every process sharing the database sees.
+type ActionLog struct {
+	db           *sql.DB
+	claimTimeout time.Duration // 0 means claimTimeout
+}
+
+// abandonedBefore returns the claim time before which pending claims are
+// abandoned, formatted for comparison with the at column.
+func (l *ActionLog) abandonedBefore() string {
+	timeout := l.claimTimeout
+	if timeout == 0 {
+		timeout = claimTimeout
+	}
+	return time.Now().Add(-timeout).UTC().Format(sqliteTime)
+}
+
+// ForPR returns all entries for a pull request, oldest first.
+func (l *ActionLog) ForPR(repo string, number int) ([]LogEntry, error) {
+	rows, err := l.db.Query(`SELECT seq, data FROM herald_actions
+		WHERE repo = ? AND number = ? ORDER BY seq`, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LogEntry
+	for rows.Next() {
+		var (
+			seq  int64
+			data string
+		)
+		if err := rows.Scan(&seq, &data); err != nil {
+			return nil, err
+		}
+		var e LogEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		e.seq = seq
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Done reports whether the action has already been applied to (or found
+// satisfied on) the PR, or is being applied by another run. Failed attempts
+// and abandoned claims don't count.
+func (l *ActionLog) Done(repo string, number int, a Action) (bool, error) {
+	action, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	var n int
+	err = l.db.QueryRow(`SELECT COUNT(*) FROM herald_actions
+		WHERE repo = ? AND number = ? AND action = ? AND status != ?
+		AND NOT (status = ? AND at < ?)`,
+		repo, number, string(action), StatusFailed, StatusPending, l.abandonedBefore()).Scan(&n)
+	return n > 0, err
+}
+
+// Claim records e as pending, as of now, before its action is applied.
+// firing names the firing of the rule: "" for rules that fire once, the head
+// SHA for rules that fire on every push. Only one claim per PR, rule, action
+// and firing succeeds until it fails or is abandoned (see claimTimeout), so
+// runs in other processes don't apply the action twice; ok is false if
+// another run holds it. Finish records the outcome.
+func (l *ActionLog) Claim(e *LogEntry, firing string) (ok bool, err error) {
+	action, err := json.Marshal(e.Action)
+	if err != nil {
+		return false, err
+	}
+	// An abandoned claim is marked failed, which releases it.
+	_, err = l.db.Exec(`UPDATE herald_actions
+		SET status = ?, data = json_set(data, '$.status', ?, '$.error', ?)
+		WHERE repo = ? AND number = ? AND rule_id = ? AND action = ? AND firing = ?
+		AND status = ? AND at < ?`,
+		StatusFailed, StatusFailed, "claim abandoned before the action finished",
+		e.Repo, e.Number, e.RuleID, string(action), firing, StatusPending, l.abandonedBefore())
+	if err != nil {
+		return false, err
+	}
+
+	e.Status = StatusPending
+	e.At = time.Now()
+	seq, err := insertLogEntry(l.db, e, &firing)
+	if err != nil || seq == 0 {
+		return false, err
+	}
+	e.seq = seq
+	return true, nil
+}
+
+// Finish records the outcome of an entry taken with Claim. A failed entry
+// releases the claim.
+func (l *ActionLog) Finish(e LogEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`UPDATE herald_actions SET status = ?, data = ? WHERE seq = ?`,
+		e.Status, string(data), e.seq)
+	return err
+}
+
+// Append adds entries that aren't claims, such as blocker syncs, to the log.
+func (l *ActionLog) Append(entries ...LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range entries {
+		if _, err := insertLogEntry(tx, &entries[i], nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertLogEntry inserts e, ignoring it if it collides with a live claim.
+// It returns the new row, or 0 if e was ignored.
+func insertLogEntry(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, e *LogEntry, firing *string) (int64, error) {
+	action, err := json.Marshal(e.Action)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec(`INSERT OR IGNORE INTO herald_actions
+		(repo, number, rule_id, action, firing, status, data, at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Repo, e.Number, e.RuleID, string(action), firing, e.Status, string(data), e.At.UTC().Format(sqliteTime))
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,99 @@
+package herald
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RepoRulesPath is where a repository keeps its own Herald rules, read from
+// the PR's base branch.
+const RepoRulesPath = ".ghabricator/herald.yml"
+
+// ParseRepoRules reads a repository's rule file (same format as an export
+// bundle). Every rule is bound to fullRepo and namespaced so its ID can't
+// collide with server rules. Invalid rules are dropped and reported.
+func ParseRepoRules(fullRepo string, data []byte) ([]Rule, []error) {
+	b, err := ParseBundle(data)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var (
+		rules []Rule
+		errs  []error
+	)
+	for _, r := range b.Rules {
+		r.ID = "repo:" + strings.ToLower(fullRepo) + ":" + r.ID
+		r.Source = SourceRepoFile
+		r.Scope = ScopeRepository
+		r.Repository = fullRepo
+		r.AuthorLogin = ""
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: rule %q: %w", RepoRulesPath, r.Name, err))
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, errs
+}
+
+// Precedence orders rules for evaluation; lower runs first and wins
+// conflicts. Host-wide rules come first, then server rules bound to the
+// repository, then the repository's own file, then personal rules.
+func (r *Rule) Precedence() int {
+	switch {
+	case r.Source == SourceRepoFile:
+		return 2
+	case r.EffectiveScope() == ScopeGlobal:
+		return 0
+	case r.EffectiveScope() == ScopeRepository:
+		return 1
+	}
+	return 3
+}
+
+// byPrecedence returns the rules sorted by precedence, keeping the original
+// order within each level.
+func byPrecedence(rules []Rule) []*Rule {
+	out := make([]*Rule, len(rules))
+	for i := range rules {
+		out[i] = &rules[i]
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Precedence() < out[j].Precedence() })
+	return out
+}
+
+// conflictKey identifies the PR property an action sets, for actions that
+// can contradict each other. Actions with no key never conflict.
+func conflictKey(a Action) string {
+	switch a.Type {
+	case ActionAddLabel, ActionRemoveLabel:
+		return "label:" + strings.ToLower(strings.TrimSpace(a.Value))
+	case ActionSetDraft:
+		return "draft"
+	}
+	return ""
+}
+
+// dropConflicts removes actions that contradict an action from an earlier
+// (higher-precedence) match, such as adding a label another rule removes.
+func dropConflicts(matches []RuleMatch) []RuleMatch {
+	claimed := make(map[string]Action)
+	for i := range matches {
+		var kept []Action
+		for _, a := range matches[i].Actions {
+			key := conflictKey(a)
+			if key == "" {
+				kept = append(kept, a)
+				continue
+			}
+			if prev, ok := claimed[key]; ok && (prev.Type != a.Type || !strings.EqualFold(strings.TrimSpace(prev.Value), strings.TrimSpace(a.Value))) {
+				continue
+			}
+			claimed[key] = a
+			kept = append(kept, a)
+		}
+		matches[i].Actions = kept
+	}
+	return matches
+}
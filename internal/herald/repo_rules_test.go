@@ -0,0 +1,63 @@
+package herald
+
+import "testing"
+
+func TestParseRepoRules(t *testing.T) {
+	data := []byte(`
+rules:
+  - name: docs
+    scope: global
+    author_login: mallory
+    conditions: [{type: file_path, value: "docs/*"}]
+    actions: [{type: add_label, value: documentation}]
+  - name: broken
+    conditions: [{type: title, operator: matches-regex, value: "("}]
+`)
+	rules, errs := ParseRepoRules("acme/widgets", data)
+	if len(errs) != 1 {
+		t.Errorf("expected the broken rule to be reported, got %v", errs)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 valid rule, got %d", len(rules))
+	}
+	r := rules[0]
+	if r.Source != SourceRepoFile || r.EffectiveScope() != ScopeRepository || r.Repository != "acme/widgets" || r.AuthorLogin != "" {
+		t.Errorf("repo rule not bound to its repository: %+v", r)
+	}
+	if r.ID != "repo:acme/widgets:"+stableID("docs") {
+		t.Errorf("ID = %q", r.ID)
+	}
+	if r.AppliesTo("acme/gadgets") {
+		t.Error("repo rule applies to another repository")
+	}
+}
+
+func TestEvaluatePrecedence(t *testing.T) {
+	rules := []Rule{
+		{ID: "personal", Scope: ScopePersonal, AuthorLogin: "octocat", Actions: []Action{{Type: ActionAddLabel, Value: "wip"}}},
+		{ID: "file", Source: SourceRepoFile, Scope: ScopeRepository, Repository: "acme/widgets",
+			Actions: []Action{{Type: ActionSetDraft, Value: "false"}, {Type: ActionAddLabel, Value: "docs"}}},
+		{ID: "repo", Scope: ScopeRepository, Repository: "acme/widgets",
+			Actions: []Action{{Type: ActionSetDraft, Value: "true"}}},
+		{ID: "global", Actions: []Action{{Type: ActionRemoveLabel, Value: "WIP"}}},
+	}
+	matches := Evaluate(rules, testContext())
+	var order []string
+	for _, m := range matches {
+		order = append(order, m.Rule.ID)
+	}
+	if len(order) != 4 || order[0] != "global" || order[1] != "repo" || order[2] != "file" || order[3] != "personal" {
+		t.Fatalf("order = %v", order)
+	}
+	// The file's draft action loses to the server repo rule; its label survives.
+	if got := matches[2].Actions; len(got) != 1 || got[0].Value != "docs" {
+		t.Errorf("file rule actions = %+v", got)
+	}
+	// The personal label loses to the global removal.
+	if len(matches[3].Actions) != 0 {
+		t.Errorf("personal rule actions = %+v", matches[3].Actions)
+	}
+	if len(rules[1].Actions) != 2 {
+		t.Error("Evaluate modified the rule's own actions")
+	}
+}
@@ -0,0 +1,87 @@
+package herald
+
+import (
+	"path"
+	"strings"
+)
+
+// EffectiveScope returns the rule's scope, treating an empty scope as global.
+func (r *Rule) EffectiveScope() RuleScope {
+	if r.Scope == "" {
+		return ScopeGlobal
+	}
+	return r.Scope
+}
+
+// AppliesTo reports whether the rule's scope and repository filter include
+// the given "owner/repo".
+func (r *Rule) AppliesTo(repo string) bool {
+	repo = strings.ToLower(repo)
+	if r.EffectiveScope() == ScopeRepository && !strings.EqualFold(r.Repository, repo) {
+		return false
+	}
+	if len(r.Repositories) == 0 {
+		return true
+	}
+	for _, p := range r.Repositories {
+		if ok, _ := path.Match(strings.ToLower(p), repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesToPR reports whether the rule runs on pr: its scope and repository
+// filter include the PR's repository and, for a personal rule, its author
+// opened the PR or is asked to review it. Personal rules act for their
+// author; runs with another user's token hold them (see HoldPersonal).
+func (r *Rule) AppliesToPR(pr *PRContext) bool {
+	if !r.AppliesTo(pr.FullRepo()) {
+		return false
+	}
+	if r.EffectiveScope() != ScopePersonal {
+		return true
+	}
+	if strings.EqualFold(r.AuthorLogin, pr.Author) {
+		return true
+	}
+	for _, login := range pr.Reviewers {
+		if strings.EqualFold(r.AuthorLogin, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldPersonal marks the matches of other users' personal rules as held,
+// for runs that act with login's token. Their actions aren't taken, and
+// their blocker statuses are left as they are.
+func HoldPersonal(matches []RuleMatch, login string) []RuleMatch {
+	out := make([]RuleMatch, len(matches))
+	for i, m := range matches {
+		m.Held = m.Held || m.Rule.EffectiveScope() == ScopePersonal && !strings.EqualFold(m.Rule.AuthorLogin, login)
+		out[i] = m
+	}
+	return out
+}
+
+// VisibleTo reports whether login may see the rule. Personal rules are
+// private to their author.
+func (r *Rule) VisibleTo(login string) bool {
+	return r.EffectiveScope() != ScopePersonal || strings.EqualFold(r.AuthorLogin, login)
+}
+
+// EditableBy reports whether login may update or delete the rule.
+// permission is the viewer's GitHub permission on r.Repository (ADMIN,
+// MAINTAIN, WRITE, ...) and only matters for repository-scoped rules.
+func (r *Rule) EditableBy(login, permission string) bool {
+	if strings.EqualFold(r.AuthorLogin, login) {
+		return true
+	}
+	return r.EffectiveScope() == ScopeRepository && permission == "ADMIN"
+}
+
+func validRepo(s string) bool {
+	owner, name, ok := strings.Cut(s, "/")
+	return ok && owner != "" && name != "" && !strings.ContainsAny(name, "/*?[")
+}
@@ -0,0 +1,130 @@
+package herald
+
+import "testing"
+
+func TestRuleAppliesTo(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		repo string
+		want bool
+	}{
+		{"legacy rule applies everywhere", Rule{}, "acme/widgets", true},
+		{"repository scope", Rule{Scope: ScopeRepository, Repository: "Acme/Widgets"}, "acme/widgets", true},
+		{"repository scope elsewhere", Rule{Scope: ScopeRepository, Repository: "acme/gadgets"}, "acme/widgets", false},
+		{"filter exact", Rule{Scope: ScopePersonal, Repositories: []string{"acme/widgets"}}, "acme/widgets", true},
+		{"filter glob", Rule{Scope: ScopeGlobal, Repositories: []string{"acme/*"}}, "acme/widgets", true},
+		{"filter miss", Rule{Scope: ScopeGlobal, Repositories: []string{"other/*"}}, "acme/widgets", false},
+	}
+	for _, tc := range tests {
+		if got := tc.rule.AppliesTo(tc.repo); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPersonalRulesApplyToOwnPRs(t *testing.T) {
+	rule := Rule{Scope: ScopePersonal, AuthorLogin: "alice"}
+	tests := []struct {
+		name string
+		pr   PRContext
+		want bool
+	}{
+		{"authored", PRContext{Owner: "acme", Repo: "widgets", Author: "Alice"}, true},
+		{"asked to review", PRContext{Owner: "acme", Repo: "widgets", Author: "bob", Reviewers: []string{"alice"}}, true},
+		{"someone else's", PRContext{Owner: "acme", Repo: "widgets", Author: "bob", Reviewers: []string{"carol"}}, false},
+	}
+	for _, tc := range tests {
+		if got := rule.AppliesToPR(&tc.pr); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	global := Rule{AuthorLogin: "alice"}
+	if !global.AppliesToPR(&tests[2].pr) {
+		t.Error("global rules apply to every PR")
+	}
+
+	held := HoldPersonal([]RuleMatch{{Rule: &rule}, {Rule: &global}}, "bob")
+	if !held[0].Held || held[1].Held {
+		t.Errorf("held = %v, %v; want only the personal rule held for bob", held[0].Held, held[1].Held)
+	}
+	if HoldPersonal([]RuleMatch{{Rule: &rule}}, "Alice")[0].Held {
+		t.Error("the author's own personal rule is held")
+	}
+}
+
+func TestRuleVisibilityAndEditing(t *testing.T) {
+	personal := Rule{Scope: ScopePersonal, AuthorLogin: "alice"}
+	repo := Rule{Scope: ScopeRepository, Repository: "acme/widgets", AuthorLogin: "alice"}
+	global := Rule{AuthorLogin: "alice"}
+
+	if personal.VisibleTo("bob") || !personal.VisibleTo("Alice") {
+		t.Error("personal rules should be visible to their author only")
+	}
+	if !repo.VisibleTo("bob") || !global.VisibleTo("bob") {
+		t.Error("repository and global rules should be visible to everyone")
+	}
+
+	if !personal.EditableBy("alice", "") {
+		t.Error("authors can edit their own rules")
+	}
+	if personal.EditableBy("bob", "ADMIN") || global.EditableBy("bob", "ADMIN") {
+		t.Error("admin permission only applies to repository-scoped rules")
+	}
+	if !repo.EditableBy("bob", "ADMIN") {
+		t.Error("repo admins can edit repository-scoped rules")
+	}
+	if repo.EditableBy("bob", "WRITE") {
+		t.Error("write access is not enough to edit someone else's rule")
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	bad := []Rule{
+		{Scope: "team"},
+		{Scope: ScopeRepository},
+		{Scope: ScopeRepository, Repository: "acme/*"},
+		{Repositories: []string{"widgets"}},
+		{Repositories: []string{"acme/["}},
+		{Conditions: []Condition{{Type: "nope", Value: "x"}}},
+		{Conditions: []Condition{{Type: CondTitle, Operator: OpMatchesRegex, Value: "("}}},
+		{Conditions: []Condition{{Type: CondFilePath, Value: "docs/["}}},
+		{Conditions: []Condition{{Type: CondDraft, Operator: OpContains, Value: "true"}}},
+		{Conditions: []Condition{{Type: CondLinesChanged, Value: "lots"}}},
+		{Actions: []Action{{Type: "close_pr", Value: "x"}}},
+		{Actions: []Action{{Type: ActionAddLabel, Value: " "}}},
+		{Actions: []Action{{Type: ActionSetDraft, Value: "maybe"}}},
+	}
+	for _, r := range bad {
+		if r.Validate() == nil {
+			t.Errorf("expected %+v to be rejected", r)
+		}
+	}
+	good := Rule{
+		Scope: ScopeRepository, Repository: "acme/widgets", Repositories: []string{"acme/*"},
+		Conditions: []Condition{
+			{Type: "title_contains", Value: "fix"},
+			{Type: CondFilePath, Operator: OpMatchesRegex, Value: `\.go$`},
+			{Type: CondLinesChanged, Operator: OpLessThan, Value: "10"},
+			{Type: CondAuthorTeam, Value: "acme/core"},
+		},
+		Actions: []Action{{Type: ActionRequestTeamReview, Value: "acme/core"}, {Type: ActionSetDraft, Value: "true"}},
+	}
+	if err := good.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEvaluateSkipsOutOfScopeRules(t *testing.T) {
+	rules := []Rule{
+		{ID: "here", Scope: ScopeRepository, Repository: "acme/widgets"},
+		{ID: "there", Scope: ScopeRepository, Repository: "acme/gadgets"},
+	}
+	matches := Evaluate(rules, testContext())
+	if len(matches) != 1 || matches[0].Rule.ID != "here" {
+		t.Errorf("expected only the in-scope rule to match, got %+v", matches)
+	}
+	if tr := Trace(&rules[1], testContext()); tr.InScope || tr.Matched {
+		t.Errorf("trace of out-of-scope rule: %+v", tr)
+	}
+}
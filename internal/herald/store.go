@@ -3,122 +3,147 @@ package herald
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 )
 
-// Store persists Herald rules to a JSON file.
+// Backend persists rules. Implementations must make each Apply and Delete
+// atomic; Store takes care of IDs and timestamps.
+type Backend interface {
+	List() ([]Rule, error)
+	Get(id string) (*Rule, error) // nil, nil if not found
+	// Apply inserts the rules in put, or replaces them by ID keeping the
+	// stored CreatedAt, and deletes the rules with IDs in del.
+	Apply(put []*Rule, del []string) error
+	Delete(id string) error
+	Close() error
+}
+
+// Store manages Herald rules on top of a Backend.
 type Store struct {
-	mu   sync.RWMutex
-	path string
+	backend Backend
+}
+
+// NewStore creates a store on the given backend.
+func NewStore(b Backend) *Store {
+	return &Store{backend: b}
+}
+
+// OpenStore opens the rule store in ~/.ghabricator. kind is "sqlite" (the
+// default, herald.db) or "json" (herald-rules.json). On first start, the
+// SQLite store imports an existing herald-rules.json.
+func OpenStore(kind string) (*Store, error) {
+	jsonPath := filepath.Join(dataDir(), "herald-rules.json")
+	switch kind {
+	case "json":
+		return NewStore(NewJSONBackend(jsonPath)), nil
+	case "", "sqlite":
+		b, err := OpenSQLiteBackend(filepath.Join(dataDir(), "herald.db"))
+		if err != nil {
+			return nil, err
+		}
+		if err := b.ImportJSON(jsonPath); err != nil {
+			b.Close()
+			return nil, err
+		}
+		return NewStore(b), nil
+	}
+	return nil, fmt.Errorf("unknown herald store %q (want sqlite or json)", kind)
 }
 
-// NewStore creates a store backed by ~/.ghabricator/herald-rules.json.
-func NewStore() *Store {
+// OpenExecutor opens an executor that records to herald.db in
+// ~/.ghabricator, whichever rule store is in use, so every process sharing
+// the directory sees the same action log and transcripts. On first start it
+// imports the herald-actions.json and herald-transcripts.json files.
+func OpenExecutor() (*Executor, error) {
+	b, err := OpenSQLiteBackend(filepath.Join(dataDir(), "herald.db"))
+	if err != nil {
+		return nil, err
+	}
+	if err := b.ImportHistory(dataDir()); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return NewExecutor(b.ActionLog(), b.Transcripts()), nil
+}
+
+// dataDir returns ~/.ghabricator, creating it if needed.
+func dataDir() string {
 	home, _ := os.UserHomeDir()
 	dir := filepath.Join(home, ".ghabricator")
 	os.MkdirAll(dir, 0o755)
-	return &Store{path: filepath.Join(dir, "herald-rules.json")}
+	return dir
 }
 
 // List returns all rules.
 func (s *Store) List() ([]Rule, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.readAll()
+	return s.backend.List()
 }
 
 // Get returns a single rule by ID.
 func (s *Store) Get(id string) (*Rule, error) {
-	rules, err := s.List()
-	if err != nil {
-		return nil, err
-	}
-	for i := range rules {
-		if rules[i].ID == id {
-			return &rules[i], nil
-		}
-	}
-	return nil, nil
+	return s.backend.Get(id)
 }
 
 // Save creates or updates a rule. If r.ID is empty, a new ID is assigned.
+// An update keeps the rule's CreatedAt.
 func (s *Store) Save(r *Rule) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	rules, err := s.readAll()
-	if err != nil {
-		rules = nil // treat as empty
-	}
+	return s.Apply([]*Rule{r}, nil)
+}
 
+// Apply saves put and deletes the rules with IDs in del, all or nothing.
+func (s *Store) Apply(put []*Rule, del []string) error {
 	now := time.Now()
-	if r.ID == "" {
-		r.ID = randomHex(8)
-		r.CreatedAt = now
+	for _, r := range put {
+		r.Source = SourceServer
 		r.UpdatedAt = now
-		rules = append(rules, *r)
-	} else {
-		r.UpdatedAt = now
-		found := false
-		for i := range rules {
-			if rules[i].ID == r.ID {
-				r.CreatedAt = rules[i].CreatedAt
-				rules[i] = *r
-				found = true
-				break
-			}
-		}
-		if !found {
-			r.CreatedAt = now
-			rules = append(rules, *r)
+		r.CreatedAt = now
+		if r.ID == "" {
+			r.ID = randomHex(8)
 		}
 	}
-	return s.writeAll(rules)
+	return s.backend.Apply(put, del)
 }
 
 // Delete removes a rule by ID.
 func (s *Store) Delete(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.backend.Delete(id)
+}
+
+// Close releases the backend.
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
 
-	rules, err := s.readAll()
+// writeFileAtomic writes data to a temp file next to path and renames it
+// into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
 		return err
 	}
-	filtered := rules[:0]
-	for _, r := range rules {
-		if r.ID != id {
-			filtered = append(filtered, r)
-		}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
 	}
-	return s.writeAll(filtered)
-}
-
-func (s *Store) readAll() ([]Rule, error) {
-	data, err := os.ReadFile(s.path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
 	}
-	var rules []Rule
-	if err := json.Unmarshal(data, &rules); err != nil {
-		return nil, err
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
 	}
-	return rules, nil
-}
-
-func (s *Store) writeAll(rules []Rule) error {
-	data, err := json.MarshalIndent(rules, "", "  ")
-	if err != nil {
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	return os.WriteFile(s.path, data, 0o644)
+	return os.Rename(tmp, path)
 }
 
 func randomHex(n int) string {
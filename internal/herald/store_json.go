@@ -0,0 +1,115 @@
+package herald
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// JSONBackend stores all rules in a single JSON file. Writes replace the file
+// atomically, but the lock is process-local: use the SQLite backend when
+// several processes share the data directory.
+type JSONBackend struct {
+	mu   sync.RWMutex
+	path string
+}
+
+// NewJSONBackend creates a backend for the JSON file at path.
+func NewJSONBackend(path string) *JSONBackend {
+	return &JSONBackend{path: path}
+}
+
+func (b *JSONBackend) List() ([]Rule, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.readAll()
+}
+
+func (b *JSONBackend) Get(id string) (*Rule, error) {
+	rules, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID == id {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *JSONBackend) Delete(id string) error {
+	return b.Apply(nil, []string{id})
+}
+
+// Apply rewrites the file once for all changes, so they land together.
+func (b *JSONBackend) Apply(put []*Rule, del []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rules, err := b.readAll()
+	if err != nil {
+		return err
+	}
+	for _, r := range put {
+		found := false
+		for i := range rules {
+			if rules[i].ID == r.ID {
+				r.CreatedAt = rules[i].CreatedAt
+				rules[i] = *r
+				found = true
+				break
+			}
+		}
+		if !found {
+			rules = append(rules, *r)
+		}
+	}
+	deleted := make(map[string]bool, len(del))
+	for _, id := range del {
+		deleted[id] = true
+	}
+	filtered := rules[:0]
+	for _, r := range rules {
+		if !deleted[r.ID] {
+			filtered = append(filtered, r)
+		}
+	}
+	return b.writeAll(filtered)
+}
+
+func (b *JSONBackend) Close() error { return nil }
+
+func (b *JSONBackend) readAll() ([]Rule, error) {
+	return readRulesFile(b.path)
+}
+
+func (b *JSONBackend) writeAll(rules []Rule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.path, data)
+}
+
+// readRulesFile reads a herald-rules.json file. A missing file is empty.
+func readRulesFile(path string) ([]Rule, error) {
+	var rules []Rule
+	if err := readJSONFile(path, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// readJSONFile decodes the JSON file at path into v. A missing file leaves v
+// unchanged.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
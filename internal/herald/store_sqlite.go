@@ -0,0 +1,261 @@
+package herald
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS herald_rules (
+	id         TEXT PRIMARY KEY,
+	data       TEXT NOT NULL, -- the Rule as JSON
+	created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS herald_meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS herald_actions (
+	seq     INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo    TEXT NOT NULL,
+	number  INTEGER NOT NULL,
+	rule_id TEXT NOT NULL,
+	action  TEXT NOT NULL, -- the Action as JSON
+	firing  TEXT,          -- set on claims: "" or the head SHA
+	status  TEXT NOT NULL,
+	data    TEXT NOT NULL, -- the LogEntry as JSON
+	at      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS herald_actions_pr ON herald_actions (repo, number);
+CREATE UNIQUE INDEX IF NOT EXISTS herald_actions_claim
+	ON herald_actions (repo, number, rule_id, action, firing)
+	WHERE firing IS NOT NULL AND status != 'failed';
+CREATE TABLE IF NOT EXISTS herald_transcripts (
+	id      TEXT PRIMARY KEY,
+	rule_id TEXT NOT NULL,
+	repo    TEXT NOT NULL COLLATE NOCASE,
+	number  INTEGER NOT NULL,
+	data    TEXT NOT NULL, -- the Transcript as JSON
+	at      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS herald_transcripts_pr ON herald_transcripts (repo, number);`
+
+// sqliteTime is a fixed-width timestamp format, so created_at sorts as text.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// SQLiteBackend stores rules in an embedded SQLite database, along with the
+// executor's action log and transcripts. Records are kept as JSON documents
+// so new fields need no migration.
+type SQLiteBackend struct {
+	db *sql.DB
+}
+
+// OpenSQLiteBackend opens (creating if needed) the database at path.
+func OpenSQLiteBackend(path string) (*SQLiteBackend, error) {
+	// WAL lets readers proceed during writes; busy_timeout makes concurrent
+	// writers from other processes wait instead of failing.
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init %s: %w", path, err)
+	}
+	return &SQLiteBackend{db: db}, nil
+}
+
+// ImportJSON copies the rules from a herald-rules.json file into the
+// database. It runs once: later calls are no-ops, even if rules have since
+// been deleted. A missing file counts as imported.
+func (b *SQLiteBackend) ImportJSON(path string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var done string
+	err = tx.QueryRow(`SELECT value FROM herald_meta WHERE key = 'json_imported'`).Scan(&done)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	rules, err := readRulesFile(path)
+	if err != nil {
+		return fmt.Errorf("import %s: %w", path, err)
+	}
+	for i := range rules {
+		if err := putRule(tx, &rules[i], false); err != nil {
+			return fmt.Errorf("import rule %s: %w", rules[i].ID, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO herald_meta (key, value) VALUES ('json_imported', ?)`, path); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ImportHistory copies the action log and transcripts from
+// herald-actions.json and herald-transcripts.json in dir into the database,
+// once, like ImportJSON. Files that can't be read are left in place and the
+// import is retried on the next start.
+func (b *SQLiteBackend) ImportHistory(dir string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var done string
+	err = tx.QueryRow(`SELECT value FROM herald_meta WHERE key = 'history_imported'`).Scan(&done)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var entries []LogEntry
+	path := filepath.Join(dir, "herald-actions.json")
+	if err := readJSONFile(path, &entries); err != nil {
+		return fmt.Errorf("import %s: %w", path, err)
+	}
+	for i := range entries {
+		if _, err := insertLogEntry(tx, &entries[i], nil); err != nil {
+			return err
+		}
+	}
+	var transcripts []Transcript
+	path = filepath.Join(dir, "herald-transcripts.json")
+	if err := readJSONFile(path, &transcripts); err != nil {
+		return fmt.Errorf("import %s: %w", path, err)
+	}
+	for i := range transcripts {
+		if err := insertTranscript(tx, &transcripts[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO herald_meta (key, value) VALUES ('history_imported', ?)`, dir); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ActionLog returns the action log kept in the database.
+func (b *SQLiteBackend) ActionLog() *ActionLog {
+	return &ActionLog{db: b.db}
+}
+
+// Transcripts returns the transcript store kept in the database.
+func (b *SQLiteBackend) Transcripts() *TranscriptStore {
+	return &TranscriptStore{db: b.db}
+}
+
+func (b *SQLiteBackend) List() ([]Rule, error) {
+	rows, err := b.db.Query(`SELECT data FROM herald_rules ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var r Rule
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (b *SQLiteBackend) Get(id string) (*Rule, error) {
+	return getRule(b.db, id)
+}
+
+func (b *SQLiteBackend) Delete(id string) error {
+	_, err := b.db.Exec(`DELETE FROM herald_rules WHERE id = ?`, id)
+	return err
+}
+
+// Apply runs in one transaction, with the reads of the CreatedAt it keeps.
+func (b *SQLiteBackend) Apply(put []*Rule, del []string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range put {
+		existing, err := getRule(tx, r.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.CreatedAt = existing.CreatedAt
+		}
+		if err := putRule(tx, r, true); err != nil {
+			return fmt.Errorf("save rule %s: %w", r.ID, err)
+		}
+	}
+	for _, id := range del {
+		if _, err := tx.Exec(`DELETE FROM herald_rules WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("delete rule %s: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *SQLiteBackend) Close() error {
+	return b.db.Close()
+}
+
+func getRule(db interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, id string) (*Rule, error) {
+	var data string
+	err := db.QueryRow(`SELECT data FROM herald_rules WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r Rule
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// putRule writes r. Existing rows are replaced if replace is set and left
+// alone otherwise.
+func putRule(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, r *Rule, replace bool) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	conflict := "DO NOTHING"
+	if replace {
+		conflict = "DO UPDATE SET data = excluded.data"
+	}
+	_, err = db.Exec(`INSERT INTO herald_rules (id, data, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(id) `+conflict,
+		r.ID, string(data), r.CreatedAt.UTC().Format(sqliteTime))
+	return err
+}
@@ -0,0 +1,132 @@
+package herald
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testBackends(t *testing.T) map[string]Backend {
+	dir := t.TempDir()
+	db, err := OpenSQLiteBackend(filepath.Join(dir, "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Backend{
+		"json":   NewJSONBackend(filepath.Join(dir, "rules.json")),
+		"sqlite": db,
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, b := range testBackends(t) {
+		s := NewStore(b)
+		r := &Rule{Name: "docs", Scope: ScopePersonal, AuthorLogin: "alice",
+			Conditions: []Condition{{Type: CondFilePath, Value: "*.md"}}}
+		if err := s.Save(r); err != nil {
+			t.Fatalf("%s: save: %v", name, err)
+		}
+		if r.ID == "" {
+			t.Fatalf("%s: no ID assigned", name)
+		}
+		created := r.CreatedAt
+
+		r.Name = "docs changes"
+		if err := s.Save(r); err != nil {
+			t.Fatalf("%s: update: %v", name, err)
+		}
+		got, err := s.Get(r.ID)
+		if err != nil || got == nil {
+			t.Fatalf("%s: get: %v, %v", name, got, err)
+		}
+		if got.Name != "docs changes" || !got.CreatedAt.Equal(created) || got.Scope != ScopePersonal {
+			t.Errorf("%s: got %+v", name, got)
+		}
+
+		if err := s.Save(&Rule{Name: "second"}); err != nil {
+			t.Fatal(err)
+		}
+		if rules, _ := s.List(); len(rules) != 2 || rules[0].ID != r.ID {
+			t.Errorf("%s: list = %+v", name, rules)
+		}
+		if err := s.Delete(r.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Get(r.ID); got != nil {
+			t.Errorf("%s: rule survived delete", name)
+		}
+	}
+}
+
+func TestStoreApply(t *testing.T) {
+	for name, b := range testBackends(t) {
+		s := NewStore(b)
+		old := &Rule{Name: "old"}
+		kept := &Rule{Name: "kept"}
+		if err := s.Apply([]*Rule{old, kept}, nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		created := kept.CreatedAt
+
+		kept.Name = "renamed"
+		if err := s.Apply([]*Rule{kept, {Name: "new"}}, []string{old.ID}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		rules, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules) != 2 || rules[0].Name != "renamed" || !rules[0].CreatedAt.Equal(created) || rules[1].Name != "new" {
+			t.Errorf("%s: rules = %+v", name, rules)
+		}
+	}
+}
+
+func TestJSONBackendWritesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(NewJSONBackend(filepath.Join(dir, "rules.json")))
+	for i := 0; i < 3; i++ {
+		if err := s.Save(&Rule{Name: "r"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only rules.json, found %d files", len(entries))
+	}
+}
+
+func TestSQLiteImportsJSONOnce(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "herald-rules.json")
+	data, _ := json.Marshal([]Rule{{ID: "r1", Name: "legacy"}, {ID: "r2", Name: "other"}})
+	if err := os.WriteFile(jsonPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := OpenSQLiteBackend(filepath.Join(dir, "herald.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.ImportJSON(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := b.List()
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("after import: %v, %v", rules, err)
+	}
+
+	// Deleted rules must not come back on the next start.
+	if err := b.Delete("r1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ImportJSON(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := b.List(); len(rules) != 1 || rules[0].ID != "r2" {
+		t.Errorf("second import changed rules: %+v", rules)
+	}
+}
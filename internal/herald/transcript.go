@@ -0,0 +1,150 @@
+package herald
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Transcript records one firing of a rule on a PR: why it matched and what
+// it did.
+type Transcript struct {
+	ID         string            `json:"id"`
+	RuleID     string            `json:"rule_id"`
+	RuleName   string            `json:"rule_name"`
+	Repetition RepetitionPolicy  `json:"repetition"`
+	Repo       string            `json:"repo"` // "owner/repo"
+	Number     int               `json:"number"`
+	HeadSHA    string            `json:"head_sha"`
+	Conditions []ConditionResult `json:"conditions"`
+	Actions    []LogEntry        `json:"actions"`
+	Errors     []string          `json:"errors,omitempty"`
+	At         time.Time         `json:"at"`
+}
+
+// ok reports whether every action in the transcript went through.
+func (t *Transcript) ok() bool {
+	if len(t.Errors) > 0 {
+		return false
+	}
+	for _, a := range t.Actions {
+		if a.Status == StatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// TranscriptFilter selects transcripts. Zero fields match everything.
+type TranscriptFilter struct {
+	RuleID string
+	Repo   string
+	Number int
+}
+
+// TranscriptStore persists rule transcripts in the herald_transcripts
+// table.
+type TranscriptStore struct {
+	db *sql.DB
+}
+
+// EffectiveRepetition returns the rule's repetition policy, defaulting to
+// first.
+func (r *Rule) EffectiveRepetition() RepetitionPolicy {
+	if r.Repetition == "" {
+		return RepeatFirst
+	}
+	return r.Repetition
+}
+
+// List returns matching transcripts, newest first.
+func (s *TranscriptStore) List(f TranscriptFilter) ([]Transcript, error) {
+	query := `SELECT data FROM herald_transcripts WHERE 1 = 1`
+	var args []any
+	if f.RuleID != "" {
+		query += ` AND rule_id = ?`
+		args = append(args, f.RuleID)
+	}
+	if f.Repo != "" {
+		query += ` AND repo = ?`
+		args = append(args, f.Repo)
+	}
+	if f.Number != 0 {
+		query += ` AND number = ?`
+		args = append(args, f.Number)
+	}
+	rows, err := s.db.Query(query+` ORDER BY at DESC, rowid DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Transcript
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var t Transcript
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Fired reports whether the rule has already fired successfully on the PR
+// under its repetition policy: ever for "first", at the current head SHA for
+// "every". Firings with failed actions don't count, so they are retried.
+func (s *TranscriptStore) Fired(r *Rule, pr *PRContext) (bool, error) {
+	ts, err := s.List(TranscriptFilter{RuleID: r.ID, Repo: pr.FullRepo(), Number: pr.Number})
+	if err != nil {
+		return false, err
+	}
+	for _, t := range ts {
+		if !t.ok() {
+			continue
+		}
+		if r.EffectiveRepetition() == RepeatFirst || t.HeadSHA == pr.HeadSHA {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Append adds transcripts, assigning IDs where missing.
+func (s *TranscriptStore) Append(ts ...Transcript) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, t := range ts {
+		if err := insertTranscript(tx, &t); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertTranscript inserts t, assigning an ID if it has none. A transcript
+// whose ID is taken is left alone.
+func insertTranscript(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, t *Transcript) error {
+	if t.ID == "" {
+		t.ID = randomHex(8)
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR IGNORE INTO herald_transcripts (id, rule_id, repo, number, data, at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		t.ID, t.RuleID, t.Repo, t.Number, string(data), t.At.UTC().Format(sqliteTime))
+	return err
+}
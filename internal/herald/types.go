@@ -8,11 +8,35 @@ import (
 type ConditionType string
 
 const (
-	CondFilePath   ConditionType = "file_path"   // glob match on changed file paths
-	CondAuthor     ConditionType = "author"       // PR author login matches
-	CondTitle      ConditionType = "title"        // PR title contains substring
-	CondLabel      ConditionType = "label"        // PR has label
-	CondBaseBranch ConditionType = "base_branch"  // PR base branch matches
+	CondFilePath     ConditionType = "file_path"     // changed file paths (default: glob)
+	CondAuthor       ConditionType = "author"        // PR author login (default: is)
+	CondTitle        ConditionType = "title"         // PR title (default: contains)
+	CondLabel        ConditionType = "label"         // PR labels (default: is)
+	CondBaseBranch   ConditionType = "base_branch"   // PR base branch (default: is)
+	CondBody         ConditionType = "body"          // PR description (default: contains)
+	CondHeadBranch   ConditionType = "head_branch"   // PR head branch (default: is)
+	CondDiffContent  ConditionType = "diff_content"  // any added or removed line (default: contains)
+	CondDiffAdded    ConditionType = "diff_added"    // added lines only (default: contains)
+	CondDiffRemoved  ConditionType = "diff_removed"  // removed lines only (default: contains)
+	CondLinesChanged ConditionType = "lines_changed" // additions+deletions (default: greater-than)
+	CondDraft        ConditionType = "draft"         // "true" or "false" (default: is)
+	CondRepository   ConditionType = "repository"    // "owner/repo" (default: is)
+	CondAuthorTeam   ConditionType = "author_team"   // author is a member of "org/team" (default: is)
+)
+
+// Operator controls how a condition's value is compared. An empty operator
+// means the condition type's default.
+type Operator string
+
+const (
+	OpIs             Operator = "is"
+	OpIsNot          Operator = "is-not"
+	OpContains       Operator = "contains"
+	OpDoesNotContain Operator = "does-not-contain"
+	OpMatchesRegex   Operator = "matches-regex"
+	OpGlob           Operator = "glob"
+	OpGreaterThan    Operator = "greater-than" // lines_changed only
+	OpLessThan       Operator = "less-than"    // lines_changed only
 )
 
 // ActionType identifies what an action does.
@@ -22,12 +46,19 @@ const (
 	ActionAddReviewer ActionType = "add_reviewer" // request review from user
 	ActionAddLabel    ActionType = "add_label"    // add label to PR
 	ActionPostComment ActionType = "post_comment" // post a comment on PR
+
+	ActionRequestTeamReview ActionType = "request_team_review" // request review from "org/team"
+	ActionAddAssignee       ActionType = "add_assignee"        // assign user to PR
+	ActionRemoveLabel       ActionType = "remove_label"        // remove label from PR
+	ActionSetDraft          ActionType = "set_draft"           // "true" converts to draft, "false" marks ready
+	ActionBlockingReviewer  ActionType = "blocking_reviewer"   // failing commit status until user approves
 )
 
 // Condition is a single predicate in a rule.
 type Condition struct {
-	Type  ConditionType `json:"type"`
-	Value string        `json:"value"`
+	Type     ConditionType `json:"type"`
+	Operator Operator      `json:"operator,omitempty"`
+	Value    string        `json:"value"`
 }
 
 // Action is a single effect triggered by a rule.
@@ -36,30 +67,103 @@ type Action struct {
 	Value string     `json:"value"`
 }
 
+// RuleScope controls who can see and edit a rule and where it applies.
+type RuleScope string
+
+const (
+	ScopePersonal   RuleScope = "personal"   // visible to and editable by its author only
+	ScopeRepository RuleScope = "repository" // bound to one repo; editable by its author or repo admins
+	ScopeGlobal     RuleScope = "global"     // visible to everyone, editable by its author
+)
+
+// RuleSource identifies where a rule is defined.
+type RuleSource string
+
+const (
+	SourceServer   RuleSource = ""          // the server-side rule store
+	SourceRepoFile RuleSource = "repo_file" // .ghabricator/herald.yml on the PR's base branch
+)
+
+// RepetitionPolicy controls whether a rule fires again on a PR it has
+// already fired on.
+type RepetitionPolicy string
+
+const (
+	RepeatFirst RepetitionPolicy = "first" // only the first time the rule matches a PR
+	RepeatEvery RepetitionPolicy = "every" // every time the rule matches a new head SHA
+)
+
 // Rule is a Herald automation rule.
 type Rule struct {
-	ID          string      `json:"id"`
-	Name        string      `json:"name"`
-	AuthorLogin string      `json:"author_login"`
-	Conditions  []Condition `json:"conditions"`
-	Actions     []Action    `json:"actions"`
-	MustMatchAll bool       `json:"must_match_all"` // true=AND, false=OR
-	Disabled    bool        `json:"disabled"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	AuthorLogin  string           `json:"author_login"`
+	Scope        RuleScope        `json:"scope,omitempty"`        // empty means global (rules predating scopes)
+	Repository   string           `json:"repository,omitempty"`   // "owner/repo"; required for repository scope
+	Repositories []string         `json:"repositories,omitempty"` // optional filter: "owner/repo" or globs like "acme/*"
+	Source       RuleSource       `json:"source,omitempty"`       // where the rule comes from; empty means the server store
+	Conditions   []Condition      `json:"conditions"`
+	Actions      []Action         `json:"actions"`
+	MustMatchAll bool             `json:"must_match_all"`       // true=AND, false=OR
+	Repetition   RepetitionPolicy `json:"repetition,omitempty"` // empty means first
+	Disabled     bool             `json:"disabled"`
+	CreatedAt    time.Time        `json:"created_at,omitzero"`
+	UpdatedAt    time.Time        `json:"updated_at,omitzero"`
 }
 
 // RuleMatch records that a rule fired and which actions it produced.
 type RuleMatch struct {
 	Rule    *Rule
 	Actions []Action
+	Held    bool // matched, but not run by this caller; see HoldPersonal
+}
+
+// ConditionResult explains the outcome of a single condition.
+type ConditionResult struct {
+	Condition Condition `json:"condition"` // normalized: aliases resolved, operator filled in
+	Matched   bool      `json:"matched"`
+	Reason    string    `json:"reason"` // e.g. `file "docs/a.md" matches glob "*.md"`
+}
+
+// RuleTrace is the full evaluation of one rule, as produced by Trace.
+type RuleTrace struct {
+	Rule       *Rule
+	InScope    bool // false if the rule's scope or repository filter excludes the PR
+	Matched    bool
+	Conditions []ConditionResult
 }
 
 // PRContext contains the PR metadata needed for rule evaluation.
 type PRContext struct {
-	Author       string
-	Title        string
-	Labels       []string
-	BaseBranch   string
-	ChangedFiles []string
+	Owner         string
+	Repo          string
+	Number        int
+	Author        string
+	Title         string
+	Body          string
+	Draft         bool
+	Labels        []string
+	Reviewers     []string // logins with a pending review request
+	TeamReviewers []string // "org/team" slugs with a pending review request
+	Assignees     []string
+	Approvers     []string // logins whose latest review approves; needed for blocking reviewers
+	BaseBranch    string
+	BaseSHA       string // base branch tip; selects the repository's rule file
+	HeadBranch    string
+	HeadSHA       string
+	ChangedFiles  []string
+	AddedLines    []string
+	RemovedLines  []string
+	LinesAdded    int
+	LinesRemoved  int
+
+	// TeamMember reports whether the author belongs to the "org/team" team.
+	// Called lazily, only for rules with author_team conditions; nil means
+	// membership is unknown and such conditions never match.
+	TeamMember func(team string) bool
+}
+
+// FullRepo returns "owner/repo" for the PR's repository.
+func (c *PRContext) FullRepo() string {
+	return c.Owner + "/" + c.Repo
 }
@@ -0,0 +1,132 @@
+package herald
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// stringOperators are the operators valid for text and list conditions.
+var stringOperators = []Operator{OpIs, OpIsNot, OpContains, OpDoesNotContain, OpMatchesRegex, OpGlob}
+
+// conditionOperators lists the operators each non-text condition type accepts.
+var conditionOperators = map[ConditionType][]Operator{
+	CondLinesChanged: {OpGreaterThan, OpLessThan, OpIs, OpIsNot},
+	CondDraft:        {OpIs, OpIsNot},
+	CondAuthorTeam:   {OpIs, OpIsNot},
+}
+
+// knownActions is the set of valid action types.
+var knownActions = map[ActionType]bool{
+	ActionAddReviewer:       true,
+	ActionAddLabel:          true,
+	ActionPostComment:       true,
+	ActionRequestTeamReview: true,
+	ActionAddAssignee:       true,
+	ActionRemoveLabel:       true,
+	ActionSetDraft:          true,
+	ActionBlockingReviewer:  true,
+}
+
+// Validate checks a rule before it is stored: scope, repository and
+// repetition fields, condition types, operators and values (including
+// regexes and globs), and action types and values. All problems are
+// reported, joined into one error.
+func (r *Rule) Validate() error {
+	var errs []error
+	switch r.Repetition {
+	case "", RepeatFirst, RepeatEvery:
+	default:
+		errs = append(errs, fmt.Errorf("unknown repetition policy %q", r.Repetition))
+	}
+	switch r.EffectiveScope() {
+	case ScopePersonal, ScopeGlobal:
+	case ScopeRepository:
+		if !validRepo(r.Repository) {
+			errs = append(errs, fmt.Errorf("repository-scoped rules need a repository as owner/repo, got %q", r.Repository))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown scope %q", r.Scope))
+	}
+	for _, p := range r.Repositories {
+		if _, err := path.Match(p, ""); err != nil || !strings.Contains(p, "/") {
+			errs = append(errs, fmt.Errorf("invalid repository filter %q (want owner/repo or a glob like owner/*)", p))
+		}
+	}
+	for i, c := range r.Conditions {
+		if err := validateCondition(c); err != nil {
+			errs = append(errs, fmt.Errorf("condition %d: %w", i+1, err))
+		}
+	}
+	for i, a := range r.Actions {
+		if err := validateAction(a); err != nil {
+			errs = append(errs, fmt.Errorf("action %d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateCondition(c Condition) error {
+	n := normalizeCondition(c)
+	if _, ok := defaultOperators[n.Type]; !ok {
+		return fmt.Errorf("unknown condition type %q", c.Type)
+	}
+	ops, ok := conditionOperators[n.Type]
+	if !ok {
+		ops = stringOperators
+	}
+	if !operatorIn(n.Operator, ops) {
+		return fmt.Errorf("operator %q not supported for %s", n.Operator, n.Type)
+	}
+	switch n.Type {
+	case CondLinesChanged:
+		if _, err := strconv.Atoi(strings.TrimSpace(n.Value)); err != nil {
+			return fmt.Errorf("invalid line count %q", n.Value)
+		}
+	case CondDraft:
+		if _, err := strconv.ParseBool(strings.TrimSpace(n.Value)); err != nil {
+			return fmt.Errorf("invalid draft value %q (want true or false)", n.Value)
+		}
+	case CondAuthorTeam:
+		if !validRepo(n.Value) {
+			return fmt.Errorf("invalid team %q (want org/team)", n.Value)
+		}
+	default:
+		if _, _, err := matcher(n.Operator, n.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAction(a Action) error {
+	if !knownActions[a.Type] {
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+	v := strings.TrimSpace(a.Value)
+	if v == "" {
+		return fmt.Errorf("%s: empty value", a.Type)
+	}
+	switch a.Type {
+	case ActionSetDraft:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%s: want true or false, got %q", a.Type, a.Value)
+		}
+	case ActionRequestTeamReview:
+		if !validRepo(v) {
+			return fmt.Errorf("%s: want org/team, got %q", a.Type, a.Value)
+		}
+	}
+	return nil
+}
+
+func operatorIn(op Operator, ops []Operator) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
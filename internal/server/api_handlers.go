@@ -10,6 +10,7 @@ import (
 
 	"github.com/nikhilr/ghabricator/internal/auth"
 	"github.com/nikhilr/ghabricator/internal/diff"
+	"github.com/nikhilr/ghabricator/internal/drafts"
 	ghapi "github.com/nikhilr/ghabricator/internal/github"
 	"github.com/nikhilr/ghabricator/internal/herald"
 
@@ -27,6 +28,7 @@ func (s *Server) handleAPIInline(w http.ResponseWriter, r *http.Request) {
 
 	client := auth.GitHubClientFromContext(r.Context())
 	ctx := r.Context()
+	sess := auth.SessionFromContext(ctx)
 
 	switch req.Operation {
 	case "new":
@@ -34,87 +36,67 @@ func (s *Server) handleAPIInline(w http.ResponseWriter, r *http.Request) {
 		if req.Side == "RIGHT" || req.Side == "right" {
 			side = "RIGHT"
 		}
+		// A range starts on the same side unless told otherwise; one that
+		// doesn't start above Line is a single-line comment.
+		startLine, startSide := req.StartLine, side
+		if req.StartSide == "LEFT" || req.StartSide == "RIGHT" {
+			startSide = req.StartSide
+		}
+		if startLine <= 0 || startLine >= req.Line {
+			startLine, startSide = 0, ""
+		}
 
-		id := nextDraftID()
-		draftMu.Lock()
-		draftStore[id] = &inlineDraft{
-			Owner:     req.Owner,
-			Repo:      req.Repo,
-			Number:    req.Number,
+		draft, err := s.drafts.Add(drafts.Draft{
+			Key:       drafts.Key{Login: sess.Login, Owner: req.Owner, Repo: req.Repo, Number: req.Number},
 			Path:      req.Path,
 			Line:      req.Line,
 			Side:      side,
+			StartLine: startLine,
+			StartSide: startSide,
 			InReplyTo: req.InReplyTo,
+		})
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		draftMu.Unlock()
 
 		jsonOK(w, map[string]any{
-			"ok": true,
-			"comment": APIInlineComment{
-				ID:   id,
-				Path: req.Path,
-				Line: req.Line,
-				Side: side,
-			},
+			"ok":      true,
+			"comment": draftToAPI(draft, sess),
 		})
 
 	case "save":
-		commentID := req.CommentID
-		body := req.Body
-
-		draftMu.Lock()
-		draft, ok := draftStore[commentID]
-		if ok {
-			delete(draftStore, commentID)
-		}
-		draftMu.Unlock()
-
-		if ok {
-			var comment *ghapi.ReviewComment
-			var err error
-			if draft.InReplyTo > 0 {
-				comment, err = ghapi.CreateReplyComment(ctx, client,
-					draft.Owner, draft.Repo, draft.Number,
-					body, draft.InReplyTo)
-			} else {
-				comment, err = ghapi.CreateReviewComment(ctx, client,
-					draft.Owner, draft.Repo, draft.Number,
-					body, draft.Path, draft.Line, draft.Side)
-			}
-			if err != nil {
-				jsonError(w, err.Error(), http.StatusBadGateway)
-				return
-			}
-			jsonOK(w, map[string]any{
-				"ok": true,
-				"comment": APIInlineComment{
-					ID:     comment.ID,
-					Author: APIUser{Login: comment.Author.Login, AvatarURL: comment.Author.AvatarURL},
-					Body:   comment.Body,
-					Path:   comment.Path,
-					Line:   comment.Line,
-					Side:   comment.Side,
-				},
-			})
-		} else {
-			comment, err := ghapi.UpdateReviewComment(ctx, client,
-				req.Owner, req.Repo, commentID, body)
-			if err != nil {
-				jsonError(w, err.Error(), http.StatusBadGateway)
-				return
-			}
+		// Drafts stay server-side until the review is submitted; saving a
+		// published comment edits it on GitHub.
+		draft, err := s.drafts.SetBody(sess.Login, req.CommentID, req.Body)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if draft != nil {
 			jsonOK(w, map[string]any{
-				"ok": true,
-				"comment": APIInlineComment{
-					ID:     comment.ID,
-					Author: APIUser{Login: comment.Author.Login, AvatarURL: comment.Author.AvatarURL},
-					Body:   comment.Body,
-					Path:   comment.Path,
-					Line:   comment.Line,
-					Side:   comment.Side,
-				},
+				"ok":      true,
+				"comment": draftToAPI(*draft, sess),
 			})
+			return
 		}
+		comment, err := ghapi.UpdateReviewComment(ctx, client,
+			req.Owner, req.Repo, req.CommentID, req.Body)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		jsonOK(w, map[string]any{
+			"ok": true,
+			"comment": APIInlineComment{
+				ID:     comment.ID,
+				Author: APIUser{Login: comment.Author.Login, AvatarURL: comment.Author.AvatarURL},
+				Body:   comment.Body,
+				Path:   comment.Path,
+				Line:   comment.Line,
+				Side:   comment.Side,
+			},
+		})
 
 	case "edit":
 		comment, err := ghapi.FetchReviewComment(ctx, client, req.Owner, req.Repo, req.CommentID)
@@ -135,20 +117,19 @@ func (s *Server) handleAPIInline(w http.ResponseWriter, r *http.Request) {
 		})
 
 	case "cancel":
-		draftMu.Lock()
-		delete(draftStore, req.CommentID)
-		draftMu.Unlock()
+		if _, err := s.drafts.Delete(sess.Login, req.CommentID); err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		jsonOK(w, map[string]bool{"ok": true})
 
 	case "delete":
-		draftMu.Lock()
-		_, isDraft := draftStore[req.CommentID]
-		if isDraft {
-			delete(draftStore, req.CommentID)
+		deleted, err := s.drafts.Delete(sess.Login, req.CommentID)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		draftMu.Unlock()
-
-		if !isDraft {
+		if !deleted {
 			if err := ghapi.DeleteReviewComment(ctx, client, req.Owner, req.Repo, req.CommentID); err != nil {
 				jsonError(w, err.Error(), http.StatusBadGateway)
 				return
@@ -157,7 +138,22 @@ func (s *Server) handleAPIInline(w http.ResponseWriter, r *http.Request) {
 		jsonOK(w, map[string]bool{"ok": true})
 
 	case "done":
-		jsonOK(w, map[string]any{"ok": true, "isChecked": false})
+		// "Done" toggles whether the comment's thread is resolved.
+		threads, err := ghapi.FetchReviewThreads(ctx, client, req.Owner, req.Repo, req.Number)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		thread, ok := threadOf(threads, req.CommentID)
+		if !ok {
+			jsonError(w, "comment is not in a review thread", http.StatusNotFound)
+			return
+		}
+		if err := ghapi.SetThreadResolved(ctx, client, thread.ID, !thread.IsResolved); err != nil {
+			jsonError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		jsonOK(w, map[string]any{"ok": true, "isChecked": !thread.IsResolved, "threadID": thread.ID})
 
 	default:
 		jsonError(w, "unknown operation: "+req.Operation, http.StatusBadRequest)
@@ -185,22 +181,79 @@ func (s *Server) handleAPIReview(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := auth.GitHubClientFromContext(r.Context())
+	ctx := r.Context()
+	sess := auth.SessionFromContext(ctx)
+
+	// The user's saved inline drafts on this PR are published with the
+	// review, so the author gets one notification. GitHub's review API can't
+	// carry replies to existing threads; those are posted right after it.
+	// Drafts still without a body stay behind.
+	saved, err := s.drafts.List(drafts.Key{Login: sess.Login, Owner: req.Owner, Repo: req.Repo, Number: req.Number})
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var pending []drafts.Draft
+	var comments []ghapi.InlineCommentRequest
+	var replies []drafts.Draft
+	for _, d := range saved {
+		if d.Body == "" {
+			continue
+		}
+		pending = append(pending, d)
+		if d.InReplyTo > 0 {
+			replies = append(replies, d)
+			continue
+		}
+		comments = append(comments, ghapi.InlineCommentRequest{
+			Body:      d.Body,
+			Path:      d.Path,
+			Line:      d.Line,
+			Side:      d.Side,
+			StartLine: d.StartLine,
+			StartSide: d.StartSide,
+		})
+	}
 
 	// Plain comments go as issue comments so they get reaction support.
 	// Only use the review API for approve/request_changes or when there are inline drafts.
-	if req.Action == "COMMENT" && req.Body != "" {
-		if err := ghapi.CreateIssueComment(r.Context(), client, req.Owner, req.Repo, req.Number, req.Body); err != nil {
+	if req.Action == "COMMENT" && req.Body != "" && len(comments) == 0 {
+		if err := ghapi.CreateIssueComment(ctx, client, req.Owner, req.Repo, req.Number, req.Body); err != nil {
 			jsonError(w, fmt.Sprintf("create comment: %v", err), http.StatusBadGateway)
 			return
 		}
-	} else {
-		_, err := ghapi.SubmitReview(r.Context(), client, req.Owner, req.Repo, req.Number, req.Action, req.Body, nil)
+	} else if req.Action != "COMMENT" || req.Body != "" || len(comments) > 0 {
+		_, err := ghapi.SubmitReview(ctx, client, req.Owner, req.Repo, req.Number, req.Action, req.Body, comments)
 		if err != nil {
 			jsonError(w, fmt.Sprintf("submit review: %v", err), http.StatusBadGateway)
 			return
 		}
 	}
-	jsonOK(w, map[string]bool{"ok": true})
+	// The review is out, so from here on each draft is reported on its own:
+	// published once it is posted and removed from the saved drafts, failed
+	// otherwise. A reply that couldn't be posted is sent with the next review.
+	resp := APIReviewResponse{OK: true, Published: []int64{}, Failed: []APIReviewFailure{}}
+	publish := func(d drafts.Draft) {
+		if _, err := s.drafts.Delete(sess.Login, d.ID); err != nil {
+			log.Printf("review: remove draft %d: %v", d.ID, err)
+			resp.Failed = append(resp.Failed, APIReviewFailure{DraftID: d.ID, Error: fmt.Sprintf("published, but the draft could not be removed: %v", err)})
+			return
+		}
+		resp.Published = append(resp.Published, d.ID)
+	}
+	for _, d := range pending {
+		if d.InReplyTo == 0 {
+			publish(d)
+		}
+	}
+	for _, d := range replies {
+		if _, err := ghapi.CreateReplyComment(ctx, client, d.Owner, d.Repo, d.Number, d.Body, d.InReplyTo); err != nil {
+			resp.Failed = append(resp.Failed, APIReviewFailure{DraftID: d.ID, Error: fmt.Sprintf("post reply: %v", err)})
+			continue
+		}
+		publish(d)
+	}
+	jsonOK(w, resp)
 }
 
 func (s *Server) handleAPIMerge(w http.ResponseWriter, r *http.Request) {
@@ -476,7 +529,7 @@ func (s *Server) handleAPIRepoFile(w http.ResponseWriter, r *http.Request) {
 	ext := strings.ToLower(filepath.Ext(file.Name))
 	switch ext {
 	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".ico", ".bmp":
-		apiFile.RawURL = fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", owner, repo, ref, path)
+		apiFile.RawURL = rawURL(owner, repo, ref, path)
 	default:
 		lines := strings.Split(file.Content, "\n")
 		apiFile.Lines = diff.HighlightLines(file.Name, lines)
@@ -642,25 +695,30 @@ func (s *Server) handleAPIPasteCreate(w http.ResponseWriter, r *http.Request) {
 // --- Task 10: Herald API ---
 
 func (s *Server) handleAPIHeraldList(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
 	rules, err := s.herald.List()
 	if err != nil {
 		jsonError(w, fmt.Sprintf("load rules: %v", err), http.StatusInternalServerError)
 		return
 	}
-	if rules == nil {
-		rules = []herald.Rule{}
+	visible := []herald.Rule{}
+	for _, rule := range rules {
+		if rule.VisibleTo(sess.Login) {
+			visible = append(visible, rule)
+		}
 	}
-	jsonOK(w, rules)
+	jsonOK(w, visible)
 }
 
 func (s *Server) handleAPIHeraldGet(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
 	id := r.PathValue("id")
 	rule, err := s.herald.Get(id)
 	if err != nil {
 		jsonError(w, fmt.Sprintf("load rule: %v", err), http.StatusInternalServerError)
 		return
 	}
-	if rule == nil {
+	if rule == nil || !rule.VisibleTo(sess.Login) {
 		jsonError(w, "rule not found", http.StatusNotFound)
 		return
 	}
@@ -680,8 +738,28 @@ func (s *Server) handleAPIHeraldSave(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "rule name is required", http.StatusBadRequest)
 		return
 	}
+	if err := rule.Validate(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	rule.AuthorLogin = sess.Login
+	var existing *herald.Rule
+	if rule.ID != "" {
+		var err error
+		if existing, err = s.herald.Get(rule.ID); err != nil {
+			jsonError(w, fmt.Sprintf("load rule: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if existing != nil && !existing.VisibleTo(sess.Login) {
+		jsonError(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	authz := s.newHeraldAuthz(r)
+	if err := authz.checkWrite(existing, &rule); err != nil {
+		jsonError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err := s.herald.Save(&rule); err != nil {
 		jsonError(w, fmt.Sprintf("save rule: %v", err), http.StatusInternalServerError)
@@ -691,7 +769,21 @@ func (s *Server) handleAPIHeraldSave(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAPIHeraldDelete(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
 	id := r.PathValue("id")
+	rule, err := s.herald.Get(id)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("load rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if rule == nil || !rule.VisibleTo(sess.Login) {
+		jsonError(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	if !s.newHeraldAuthz(r).canEdit(rule) {
+		jsonError(w, "only the rule's author or a repository admin can delete this rule", http.StatusForbidden)
+		return
+	}
 	if err := s.herald.Delete(id); err != nil {
 		jsonError(w, fmt.Sprintf("delete rule: %v", err), http.StatusInternalServerError)
 		return
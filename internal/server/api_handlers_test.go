@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/drafts"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	"golang.org/x/oauth2"
+)
+
+func TestReviewReportsFailedReplies(t *testing.T) {
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/widgets/pulls/42/reviews":
+			w.Write([]byte(`{"id": 1, "state": "COMMENTED"}`))
+		case "/repos/acme/widgets/pulls/42/comments":
+			http.Error(w, `{"message": "parent comment not found"}`, http.StatusUnprocessableEntity)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer fake.Close()
+
+	store, err := drafts.Open(filepath.Join(t.TempDir(), "drafts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	key := drafts.Key{Login: "alice", Owner: "acme", Repo: "widgets", Number: 42}
+	inline, err := store.Add(drafts.Draft{Key: key, Path: "README.md", Line: 3, Side: "RIGHT", Body: "typo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := store.Add(drafts.Draft{Key: key, Path: "README.md", Line: 5, Side: "RIGHT", InReplyTo: 7, Body: "agreed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{drafts: store}
+	body, _ := json.Marshal(APIReviewRequest{Owner: "acme", Repo: "widgets", Number: 42, Action: "COMMENT"})
+	r := httptest.NewRequest(http.MethodPost, "/api/v2/review", bytes.NewReader(body))
+	sess := &auth.Session{Login: "alice", Token: &oauth2.Token{AccessToken: "token"}}
+	r = r.WithContext(auth.NewContext(r.Context(), sess, newTestClient(fake.URL)))
+	rec := httptest.NewRecorder()
+	s.handleAPIReview(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp APIReviewResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Published) != 1 || resp.Published[0] != inline.ID {
+		t.Errorf("published = %v, want [%d]", resp.Published, inline.ID)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].DraftID != reply.ID {
+		t.Errorf("failed = %+v, want draft %d", resp.Failed, reply.ID)
+	}
+	left, err := store.List(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].ID != reply.ID {
+		t.Errorf("saved drafts = %+v, want only the failed reply", left)
+	}
+}
+
+func TestThreadOf(t *testing.T) {
+	threads := []ghapi.ReviewThread{
+		{ID: "T1", CommentIDs: []int64{1, 2}},
+		{ID: "T2", CommentIDs: []int64{3}},
+	}
+	if th, ok := threadOf(threads, 2); !ok || th.ID != "T1" {
+		t.Errorf("threadOf(2) = %q, %v; want T1", th.ID, ok)
+	}
+	if th, ok := threadOf(threads, 4); ok {
+		t.Errorf("threadOf(4) = %q, want none", th.ID)
+	}
+}
+
+func TestInlineDoneTogglesResolution(t *testing.T) {
+	for _, tt := range []struct {
+		resolved bool
+		mutation string
+	}{
+		{false, "resolveReviewThread"},
+		{true, "unresolveReviewThread"},
+	} {
+		var called string
+		fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Query string `json:"query"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if strings.HasPrefix(req.Query, "mutation") {
+				called, _, _ = strings.Cut(strings.TrimPrefix(req.Query, "mutation($id: ID!) { "), "(")
+				w.Write([]byte(`{"data": {}}`))
+				return
+			}
+			resolved, _ := json.Marshal(tt.resolved)
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"reviewThreads": {"nodes": [
+				{"id": "T1", "isResolved": ` + string(resolved) + `, "comments": {"nodes": [{"databaseId": 5}]}}]}}}}}`))
+		}))
+
+		body, _ := json.Marshal(APIInlineRequest{Operation: "done", Owner: "acme", Repo: "widgets", Number: 42, CommentID: 5})
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/inline", bytes.NewReader(body))
+		sess := &auth.Session{Login: "alice", Token: &oauth2.Token{AccessToken: "token"}}
+		r = r.WithContext(auth.NewContext(r.Context(), sess, newTestClient(fake.URL)))
+		rec := httptest.NewRecorder()
+		(&Server{}).handleAPIInline(rec, r)
+		fake.Close()
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if called != tt.mutation {
+			t.Errorf("resolved=%v: called %q, want %q", tt.resolved, called, tt.mutation)
+		}
+		var resp struct {
+			IsChecked bool `json:"isChecked"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.IsChecked == tt.resolved {
+			t.Errorf("resolved=%v: response %s", tt.resolved, rec.Body)
+		}
+	}
+}
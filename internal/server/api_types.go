@@ -1,6 +1,10 @@
 package server
 
-import "time"
+import (
+	"time"
+
+	"github.com/nikhilr/ghabricator/internal/herald"
+)
 
 // --- Dashboard API types ---
 
@@ -36,12 +40,16 @@ type APILabel struct {
 type APIPRDetailResponse struct {
 	PR               APIPRDetail                    `json:"pr"`
 	Changesets       []APIChangeset                 `json:"changesets"`
+	Layout           string                         `json:"layout"`
 	CommentsByPath   map[string][]APIReviewComment  `json:"commentsByPath"`
+	Threads          []APIReviewThread              `json:"threads"`
 	Reviews          []APIReview                    `json:"reviews"`
 	IssueComments    []APIIssueComment              `json:"issueComments"`
 	CheckRuns        []APICheckRun                  `json:"checkRuns"`
 	Timeline         []APITimelineEvent             `json:"timeline"`
 	HeraldMatches    []APIHeraldMatch               `json:"heraldMatches,omitempty"`
+	HeraldLog        []APIHeraldLogEntry            `json:"heraldLog,omitempty"`
+	HeraldBlockers   []APIHeraldBlocker             `json:"heraldBlockers,omitempty"`
 	Commits          []APICommit                    `json:"commits"`
 	ViewerPermission string                         `json:"viewerPermission"`
 }
@@ -80,40 +88,166 @@ type APIRef struct {
 }
 
 type APIChangeset struct {
-	ID           int          `json:"id"`
-	OldName      string       `json:"oldName"`
-	NewName      string       `json:"newName"`
-	DisplayPath  string       `json:"displayPath"`
-	LinesAdded   int          `json:"linesAdded"`
-	LinesRemoved int          `json:"linesRemoved"`
-	IsNew        bool         `json:"isNew"`
-	IsDeleted    bool         `json:"isDeleted"`
-	IsRenamed    bool         `json:"isRenamed"`
-	IsBinary     bool         `json:"isBinary"`
-	Rows         []APIDiffRow `json:"rows"`
+	ID           int             `json:"id"`
+	OldName      string          `json:"oldName"`
+	NewName      string          `json:"newName"`
+	DisplayPath  string          `json:"displayPath"`
+	LinesAdded   int             `json:"linesAdded"`
+	LinesRemoved int             `json:"linesRemoved"`
+	IsNew        bool            `json:"isNew"`
+	IsDeleted    bool            `json:"isDeleted"`
+	IsRenamed    bool            `json:"isRenamed"`
+	IsCopied     bool            `json:"isCopied"` // oldName is the copy source
+	IsBinary     bool            `json:"isBinary"`
+	Similarity   int             `json:"similarity,omitempty"` // percent, for renames and copies
+	OldMode      string          `json:"oldMode,omitempty"`    // git file mode, e.g. "100755"
+	NewMode      string          `json:"newMode,omitempty"`
+	Kind         string          `json:"kind,omitempty"`           // "generated", "vendored", "lockfile" or "binary"
+	Hunks        []APIHunk       `json:"hunks"`                    // hunk ranges and header context
+	Symbols      []APISymbol     `json:"changedSymbols,omitempty"` // declarations touched by the diff
+	Rows         []APIDiffRow    `json:"rows,omitempty"`           // layout=sidebyside
+	UnifiedRows  []APIUnifiedRow `json:"unifiedRows,omitempty"`    // layout=unified
+	Binary       *APIBinaryDiff  `json:"binary,omitempty"`         // binary files and images
+	Deferred     string          `json:"deferred,omitempty"`       // why rows were left out: "too_large", "budget" or the Kind
+	RenderURI    string          `json:"renderURI,omitempty"`      // loads a deferred changeset
+}
+
+// APIHunk is a hunk's line ranges and the function context shown in its
+// header.
+type APIHunk struct {
+	OldStart int    `json:"oldStart"`
+	OldCount int    `json:"oldCount"`
+	NewStart int    `json:"newStart"`
+	NewCount int    `json:"newCount"`
+	Section  string `json:"section,omitempty"`
+}
+
+// APISymbol is a function, type or class touched by a changeset.
+type APISymbol struct {
+	Kind    string `json:"kind"`    // "func", "method", "type", "class", ...
+	Name    string `json:"name"`    // e.g. "Server.handleAPIPR"
+	Label   string `json:"label"`   // e.g. "func (s *Server) handleAPIPR"
+	Change  string `json:"change"`  // "added", "removed" or "modified"
+	OldLine int    `json:"oldLine"` // declaration line, 0 if added
+	NewLine int    `json:"newLine"` // declaration line, 0 if removed
+}
+
+// APIBinaryDiff describes both sides of a binary or image changeset. A side
+// is nil if the file doesn't exist there.
+type APIBinaryDiff struct {
+	Image bool     `json:"image"`
+	Old   *APIBlob `json:"old,omitempty"`
+	New   *APIBlob `json:"new,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// APIBlob is one side of a binary diff. SHA256 and image dimensions are
+// only filled in for files up to maxBinaryBytes.
+type APIBlob struct {
+	Path    string `json:"path"`
+	Commit  string `json:"commit"`
+	URL     string `json:"url"` // raw bytes, via /api/repo/{owner}/{repo}/raw
+	Size    int    `json:"size"`
+	BlobSHA string `json:"blobSha"`
+	SHA256  string `json:"sha256,omitempty"`
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
 }
 
 type APIDiffRow struct {
-	OldNum     int    `json:"oldNum"`
-	NewNum     int    `json:"newNum"`
-	OldClass   string `json:"oldClass"`
-	NewClass   string `json:"newClass"`
-	OldContent string `json:"oldContent"`
-	NewContent string `json:"newContent"`
-	IsContext  bool   `json:"isContext"`
+	OldNum     int      `json:"oldNum"`
+	NewNum     int      `json:"newNum"`
+	OldClass   string   `json:"oldClass"`
+	NewClass   string   `json:"newClass"`
+	OldContent string   `json:"oldContent"`
+	NewContent string   `json:"newContent"`
+	IsContext  bool     `json:"isContext"`
+	OldMove    *APIMove `json:"oldMove,omitempty"`
+	NewMove    *APIMove `json:"newMove,omitempty"`
+}
+
+// APIContextResponse holds expanded context rows and the commit they were
+// read from.
+type APIContextResponse struct {
+	Commit string       `json:"commit"`
+	Path   string       `json:"path"`
+	Rows   []APIDiffRow `json:"rows"`
+}
+
+// APIMove links a moved line to its counterpart (?moves=true).
+type APIMove struct {
+	Dir       string `json:"dir"` // "to" on removed lines, "from" on added lines
+	Changeset int    `json:"changeset"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+}
+
+// APIUnifiedRow is one line of a unified (one-up) diff.
+type APIUnifiedRow struct {
+	Type    string   `json:"type"` // "context", "added" or "removed"
+	OldNum  int      `json:"oldNum"`
+	NewNum  int      `json:"newNum"`
+	Class   string   `json:"class"`
+	Content string   `json:"content"`
+	Move    *APIMove `json:"move,omitempty"`
 }
 
 type APIReviewComment struct {
-	ID        int64              `json:"id"`
-	Author    APIUser            `json:"author"`
-	Body      string             `json:"body"`
-	BodyRaw   string             `json:"bodyRaw,omitempty"`
-	Path      string             `json:"path"`
-	Line      int                `json:"line"`
-	Side      string             `json:"side"`
-	CreatedAt time.Time          `json:"createdAt"`
-	InReplyTo int64              `json:"inReplyTo,omitempty"`
-	Reactions []APIReaction `json:"reactions,omitempty"`
+	ID         int64          `json:"id"`
+	Author     APIUser        `json:"author"`
+	Body       string         `json:"body"`
+	BodyRaw    string         `json:"bodyRaw,omitempty"`
+	Path       string         `json:"path"`
+	Line       int            `json:"line"`
+	Side       string         `json:"side"`
+	StartLine  int            `json:"startLine,omitempty"` // first line of a multi-line comment
+	StartSide  string         `json:"startSide,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	InReplyTo  int64          `json:"inReplyTo,omitempty"`
+	Reactions  []APIReaction  `json:"reactions,omitempty"`
+	Suggestion *APISuggestion `json:"suggestion,omitempty"`
+
+	// An outdated comment is ported to the current diff (Ported, with Line
+	// and StartLine moved) or, if it can't be placed, is a ghost shown with
+	// the end of the diff hunk it was made on.
+	Ported       bool            `json:"ported,omitempty"`
+	Ghost        bool            `json:"ghost,omitempty"`
+	OriginalLine int             `json:"originalLine,omitempty"`
+	GhostContext []APIUnifiedRow `json:"ghostContext,omitempty"`
+}
+
+// APIReviewThread groups inline comments of CommentsByPath into a thread
+// that can be resolved. Line and StartLine are 0 once the thread is
+// outdated; the Original fields keep its position in the diff it was
+// started on.
+type APIReviewThread struct {
+	ID                string  `json:"id"`
+	Path              string  `json:"path"`
+	Side              string  `json:"side"` // LEFT or RIGHT
+	Line              int     `json:"line"`
+	StartLine         int     `json:"startLine,omitempty"`
+	OriginalLine      int     `json:"originalLine"`
+	OriginalStartLine int     `json:"originalStartLine,omitempty"`
+	IsResolved        bool    `json:"isResolved"`
+	IsOutdated        bool    `json:"isOutdated"`
+	ResolvedBy        string  `json:"resolvedBy,omitempty"`
+	CommentIDs        []int64 `json:"commentIds"` // oldest first
+}
+
+// APIThreadRequest resolves or unresolves a review thread.
+type APIThreadRequest struct {
+	Owner     string `json:"owner"`
+	Repo      string `json:"repo"`
+	ThreadID  string `json:"threadID"`
+	Operation string `json:"operation"` // resolve or unresolve
+}
+
+// APISuggestion is a ```suggestion block of a review comment, shown as a
+// diff of the commented lines. Body then holds the rest of the comment.
+type APISuggestion struct {
+	Text       string          `json:"text"`
+	Rows       []APIUnifiedRow `json:"rows,omitempty"` // empty if the original lines are unknown
+	Applicable bool            `json:"applicable"`     // on the new side and not outdated
 }
 
 type APIReaction struct {
@@ -163,6 +297,7 @@ type APITimelineEvent struct {
 type APIHeraldMatch struct {
 	RuleID   string            `json:"ruleId"`
 	RuleName string            `json:"ruleName"`
+	Source   string            `json:"source,omitempty"` // "repo_file" for .ghabricator/herald.yml rules
 	Actions  []APIHeraldAction `json:"actions"`
 }
 
@@ -171,6 +306,79 @@ type APIHeraldAction struct {
 	Value string `json:"value"`
 }
 
+type APIHeraldLogEntry struct {
+	RuleID   string          `json:"ruleId"`
+	RuleName string          `json:"ruleName"`
+	Action   APIHeraldAction `json:"action"`
+	Status   string          `json:"status"` // applied, skipped, failed
+	Error    string          `json:"error,omitempty"`
+	At       time.Time       `json:"at"`
+}
+
+// APIHeraldBlocker is a blocking reviewer required by a matched rule.
+// Unapproved blockers hold a failing commit status on the head commit.
+type APIHeraldBlocker struct {
+	Reviewer      string `json:"reviewer"`
+	RuleID        string `json:"ruleId"`
+	RuleName      string `json:"ruleName"`
+	Approved      bool   `json:"approved"`
+	StatusContext string `json:"statusContext"`
+}
+
+// --- Herald test console types ---
+
+type APIHeraldTestRequest struct {
+	Rule   *herald.Rule `json:"rule,omitempty"`   // unsaved rule definition
+	RuleID string       `json:"ruleId,omitempty"` // or a saved rule
+	Owner  string       `json:"owner"`
+	Repo   string       `json:"repo"`
+	Number int          `json:"number"`
+}
+
+type APIHeraldTestResponse struct {
+	InScope    bool                       `json:"inScope"` // rule scope / repository filter include the PR
+	Matched    bool                       `json:"matched"`
+	Disabled   bool                       `json:"disabled"`
+	Conditions []APIHeraldConditionResult `json:"conditions"`
+	Actions    []APIHeraldAction          `json:"actions"` // would run; never executed
+}
+
+type APIHeraldConditionResult struct {
+	Type     string `json:"type"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason"`
+}
+
+type APIHeraldImportResponse struct {
+	Mode    string                `json:"mode"`
+	DryRun  bool                  `json:"dryRun"`
+	Changes []APIHeraldRuleChange `json:"changes"`
+	Errors  []string              `json:"errors,omitempty"` // validation or permission problems; nothing was written
+}
+
+type APIHeraldRuleChange struct {
+	Kind   string   `json:"kind"` // create, update, delete, unchanged
+	RuleID string   `json:"ruleId"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"` // changed fields, for updates
+}
+
+type APIHeraldTranscript struct {
+	ID         string                     `json:"id"`
+	RuleID     string                     `json:"ruleId"`
+	RuleName   string                     `json:"ruleName"`
+	Repetition string                     `json:"repetition"`
+	Repo       string                     `json:"repo"`
+	Number     int                        `json:"number"`
+	HeadSHA    string                     `json:"headSha"`
+	Conditions []APIHeraldConditionResult `json:"conditions"`
+	Actions    []APIHeraldLogEntry        `json:"actions"`
+	Errors     []string                   `json:"errors,omitempty"`
+	At         time.Time                  `json:"at"`
+}
+
 // --- Inline Comment API types ---
 
 type APIInlineRequest struct {
@@ -181,6 +389,8 @@ type APIInlineRequest struct {
 	Path      string `json:"path"`
 	Line      int    `json:"line"`
 	Side      string `json:"side"` // LEFT or RIGHT
+	StartLine int    `json:"startLine,omitempty"` // first line of a multi-line comment
+	StartSide string `json:"startSide,omitempty"`
 	Body      string `json:"body"`
 	CommentID int64  `json:"commentID"`
 	InReplyTo int64  `json:"inReplyTo,omitempty"`
@@ -193,6 +403,10 @@ type APIInlineComment struct {
 	Path      string  `json:"path"`
 	Line      int     `json:"line"`
 	Side      string  `json:"side"`
+	StartLine int     `json:"startLine,omitempty"`
+	StartSide string  `json:"startSide,omitempty"`
+	InReplyTo int64   `json:"inReplyTo,omitempty"`
+	Draft     bool    `json:"draft,omitempty"` // not yet published; sent with the next review
 }
 
 // --- Review/Merge/Close API types ---
@@ -205,6 +419,19 @@ type APIReviewRequest struct {
 	Body     string `json:"body"`
 }
 
+// APIReviewResponse reports which of the user's saved drafts went out with
+// a review. Failed drafts stay saved.
+type APIReviewResponse struct {
+	OK        bool               `json:"ok"`
+	Published []int64            `json:"published"` // draft IDs
+	Failed    []APIReviewFailure `json:"failed"`
+}
+
+type APIReviewFailure struct {
+	DraftID int64  `json:"draftID"`
+	Error   string `json:"error"`
+}
+
 type APIMergeRequest struct {
 	Owner       string `json:"owner"`
 	Repo        string `json:"repo"`
@@ -229,6 +456,16 @@ type APIReactionRequest struct {
 	CommentType string `json:"commentType"` // "issue" or "review"
 }
 
+// APIApplySuggestionRequest commits a review comment's suggestion to the
+// PR's head branch.
+type APIApplySuggestionRequest struct {
+	Owner     string `json:"owner"`
+	Repo      string `json:"repo"`
+	Number    int    `json:"number"`
+	CommentID int64  `json:"commentID"`
+	Message   string `json:"message,omitempty"` // commit message; a default names the comment's author
+}
+
 // --- Repos API types ---
 
 type APIRepoSummary struct {
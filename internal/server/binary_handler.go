@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+const (
+	// maxBinaryBytes is the largest file fetched to hash or measure.
+	maxBinaryBytes = 10 << 20
+	// maxRawBytes is the largest file the raw endpoint serves.
+	maxRawBytes = 25 << 20
+	// maxEagerBinaries is how many binary changesets a diff response
+	// fetches; the rest are deferred to the changeset endpoint.
+	maxEagerBinaries = 20
+	// fileFetchers bounds concurrent file fetches for one response.
+	fileFetchers = 4
+)
+
+// fullSHA matches a full commit SHA, whose content never changes.
+var fullSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// rawURL returns the URL serving path at ref through handleAPIRepoRaw.
+func rawURL(owner, repo, ref, p string) string {
+	return fmt.Sprintf("/api/repo/%s/%s/raw?%s", url.PathEscape(owner), url.PathEscape(repo),
+		url.Values{"ref": {ref}, "path": {p}}.Encode())
+}
+
+// handleAPIRepoRaw serves a file's bytes with a content type from its
+// extension, so images in private repositories can be shown.
+// GET /api/repo/{owner}/{repo}/raw?ref=R&path=P
+func (s *Server) handleAPIRepoRaw(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	ref := r.URL.Query().Get("ref")
+	p := r.URL.Query().Get("path")
+	if ref == "" || p == "" {
+		jsonError(w, "ref and path are required", http.StatusBadRequest)
+		return
+	}
+	client := auth.GitHubClientFromContext(r.Context())
+
+	blob, err := ghapi.FetchFileBlob(r.Context(), client, owner, repo, ref, p, maxRawBytes)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("file not found: %v", err), http.StatusNotFound)
+		return
+	}
+	if blob.Data == nil {
+		jsonError(w, fmt.Sprintf("file is larger than %d bytes", maxRawBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(p))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Served from our origin: never let an SVG (or anything else) run script.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if fullSHA.MatchString(ref) {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	}
+	w.Write(blob.Data)
+}
+
+// isBinaryChangeset reports whether a changeset gets a binary diff: git
+// couldn't diff it as text, or it is an image (SVGs diff as text but are
+// also previewed).
+func isBinaryChangeset(cs diff.Changeset) bool {
+	return cs.IsBinary || diff.IsImage(cs.DisplayPath())
+}
+
+// attachBinaryDiffs fills Binary on the API changesets (parallel to
+// changesets) that are binary. The old side is read at the merge base of
+// base and head, the new side at head. Past maxEager, binary changesets are
+// deferred instead; renderURI gives their on-demand URL.
+func (s *Server) attachBinaryDiffs(ctx context.Context, client *gh.Client, owner, repo, base, head string,
+	changesets []diff.Changeset, out []APIChangeset, maxEager int, renderURI func(id int) string) {
+	var todo []int
+	for i, cs := range changesets {
+		if !isBinaryChangeset(cs) || out[i].Deferred != "" {
+			continue
+		}
+		if len(todo) >= maxEager {
+			out[i].Deferred = string(diff.KindBinary)
+			out[i].RenderURI = renderURI(cs.ID)
+			continue
+		}
+		todo = append(todo, i)
+	}
+	if len(todo) == 0 {
+		return
+	}
+
+	mergeBase, err := s.sources.mergeBase(ctx, client, owner, repo, base, head)
+	if err != nil {
+		for _, i := range todo {
+			out[i].Binary = &APIBinaryDiff{Image: diff.IsImage(changesets[i].DisplayPath()), Error: err.Error()}
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fileFetchers)
+	for _, i := range todo {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			out[i].Binary = fetchBinaryDiff(ctx, client, owner, repo, mergeBase, head, changesets[i])
+		}()
+	}
+	wg.Wait()
+}
+
+// fetchBinaryDiff fetches both sides of a binary changeset. Fetch errors are
+// reported in the result rather than failing the response.
+func fetchBinaryDiff(ctx context.Context, client *gh.Client, owner, repo, oldRef, newRef string, cs diff.Changeset) *APIBinaryDiff {
+	bd := &APIBinaryDiff{Image: diff.IsImage(cs.DisplayPath())}
+	var err error
+	if !cs.IsNew {
+		bd.Old, err = fetchAPIBlob(ctx, client, owner, repo, oldRef, cs.OldName, bd.Image)
+	}
+	if err == nil && !cs.IsDeleted {
+		bd.New, err = fetchAPIBlob(ctx, client, owner, repo, newRef, cs.NewName, bd.Image)
+	}
+	if err != nil {
+		bd.Error = err.Error()
+	}
+	return bd
+}
+
+func fetchAPIBlob(ctx context.Context, client *gh.Client, owner, repo, ref, p string, image bool) (*APIBlob, error) {
+	blob, err := ghapi.FetchFileBlob(ctx, client, owner, repo, ref, p, maxBinaryBytes)
+	if err != nil {
+		return nil, err
+	}
+	b := &APIBlob{
+		Path:    p,
+		Commit:  ref,
+		URL:     rawURL(owner, repo, ref, p),
+		Size:    blob.Size,
+		BlobSHA: blob.SHA,
+	}
+	if blob.Data != nil {
+		sum := sha256.Sum256(blob.Data)
+		b.SHA256 = hex.EncodeToString(sum[:])
+		if image {
+			b.Width, b.Height, _ = diff.ImageSize(p, blob.Data)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// Diff layouts accepted by ?layout= on the PR and compare endpoints.
+const (
+	layoutSideBySide = "sidebyside"
+	layoutUnified    = "unified"
+)
+
+// parseLayout validates the ?layout= query value. Empty means side-by-side.
+func parseLayout(v string) (string, error) {
+	switch v {
+	case "", layoutSideBySide:
+		return layoutSideBySide, nil
+	case layoutUnified:
+		return layoutUnified, nil
+	}
+	return "", fmt.Errorf("invalid layout %q (want unified or sidebyside)", v)
+}
+
+// parseDiffOptions reads ?whitespace=ignore|show and ?moves=true|false.
+func parseDiffOptions(q url.Values) (diff.Options, error) {
+	var opts diff.Options
+	switch q.Get("whitespace") {
+	case "", "show":
+	case "ignore":
+		opts.IgnoreWhitespace = true
+	default:
+		return opts, fmt.Errorf("invalid whitespace %q (want ignore or show)", q.Get("whitespace"))
+	}
+	if v := q.Get("moves"); v != "" {
+		moves, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid moves %q (want true or false)", v)
+		}
+		opts.DetectMoves = moves
+	}
+	return opts, nil
+}
+
+// toAPIMove converts a diff move link; nil stays nil.
+func toAPIMove(m *diff.Move) *APIMove {
+	if m == nil {
+		return nil
+	}
+	return &APIMove{Dir: m.Dir, Changeset: m.Changeset, Path: m.Path, Line: m.Line}
+}
+
+// attributesCache holds the root .gitattributes of each repository per
+// base SHA. The zero value is ready to use.
+type attributesCache struct {
+	cache shaCache[*diff.GitAttributes] // nil if there is no file
+}
+
+// load returns the attributes at baseSHA. Errors are logged and yield no
+// attributes, leaving classification to the heuristics.
+func (c *attributesCache) load(ctx context.Context, client *gh.Client, owner, repo, baseSHA string) *diff.GitAttributes {
+	if baseSHA == "" {
+		return nil
+	}
+	key := shaKey(owner, repo, baseSHA, ".gitattributes")
+	if attrs, ok := c.cache.get(key); ok {
+		return attrs
+	}
+	content, found, err := fetchOptionalFile(ctx, client, owner, repo, baseSHA, ".gitattributes")
+	if err != nil {
+		log.Printf("gitattributes: %s/%s: %v", owner, repo, err)
+		return nil
+	}
+	var attrs *diff.GitAttributes
+	if found {
+		attrs = diff.ParseGitAttributes(content)
+	}
+	c.cache.put(key, attrs)
+	return attrs
+}
+
+// renderQueryKeys are the query parameters a deferred changeset's RenderURI
+// carries over from the original request.
+var renderQueryKeys = []string{"layout", "whitespace", "moves", "base", "head"}
+
+// changesetRenderURI returns the endpoint that renders one changeset of a PR
+// with the same options as the request q.
+func changesetRenderURI(owner, repo, number string, id int, q url.Values) string {
+	uri := fmt.Sprintf("/api/pr/%s/%s/%s/changeset/%d", url.PathEscape(owner), url.PathEscape(repo), number, id)
+	keep := url.Values{}
+	for _, k := range renderQueryKeys {
+		if v := q.Get(k); v != "" {
+			keep.Set(k, v)
+		}
+	}
+	if len(keep) > 0 {
+		uri += "?" + keep.Encode()
+	}
+	return uri
+}
+
+// renderChangesets builds the changesets of a diff response between base
+// and head: the full files are loaded for highlighting and outlines, then
+// rows, binary diffs and outlines are filled in.
+func (s *Server) renderChangesets(ctx context.Context, client *gh.Client, owner, repo, base, head string,
+	changesets []diff.Changeset, layout string, renderURI func(id int) string) []APIChangeset {
+	plan := diff.DefaultLimits.Plan(changesets)
+	sources := s.loadSources(ctx, client, owner, repo, base, head, changesets, plan)
+	out := buildAPIChangesets(changesets, plan, sources, layout, renderURI)
+	s.attachBinaryDiffs(ctx, client, owner, repo, base, head, changesets, out, maxEagerBinaries, renderURI)
+	attachOutlines(changesets, sources, out)
+	return out
+}
+
+// buildAPIChangesets converts changesets for a diff response, highlighting
+// against sources (parallel to changesets, or nil). Changesets plan defers
+// (diff.DefaultLimits.Plan: files over the limits, and generated, vendored
+// and lock files) carry metadata and a RenderURI, and no rows, so a large PR
+// is not highlighted in full up front.
+func buildAPIChangesets(changesets []diff.Changeset, plan []string, sources []diff.FileSources, layout string, renderURI func(id int) string) []APIChangeset {
+	out := make([]APIChangeset, 0, len(changesets))
+	for i, cs := range changesets {
+		if plan[i] == "" {
+			var src diff.FileSources
+			if sources != nil {
+				src = sources[i]
+			}
+			out = append(out, toAPIChangeset(cs, src, layout))
+			continue
+		}
+		ac := toAPIChangesetMeta(cs)
+		ac.Deferred = plan[i]
+		ac.RenderURI = renderURI(cs.ID)
+		out = append(out, ac)
+	}
+	return out
+}
+
+// toAPIChangesetMeta converts a changeset's metadata, without rows.
+func toAPIChangesetMeta(cs diff.Changeset) APIChangeset {
+	return APIChangeset{
+		ID:           cs.ID,
+		OldName:      cs.OldName,
+		NewName:      cs.NewName,
+		DisplayPath:  cs.DisplayPath(),
+		LinesAdded:   cs.LinesAdded,
+		LinesRemoved: cs.LinesRemoved,
+		IsNew:        cs.IsNew,
+		IsDeleted:    cs.IsDeleted,
+		IsRenamed:    cs.IsRenamed,
+		IsCopied:     cs.IsCopied,
+		IsBinary:     cs.IsBinary,
+		Similarity:   cs.Similarity,
+		OldMode:      cs.OldMode,
+		NewMode:      cs.NewMode,
+		Kind:         string(cs.Kind),
+		Hunks:        toAPIHunks(cs.Hunks),
+	}
+}
+
+// toAPIHunks converts hunk ranges and git's header context; attachOutlines
+// fills in missing context.
+func toAPIHunks(hunks []diff.Hunk) []APIHunk {
+	out := make([]APIHunk, len(hunks))
+	for i, h := range hunks {
+		out[i] = APIHunk{
+			OldStart: h.OldStart,
+			OldCount: h.OldCount,
+			NewStart: h.NewStart,
+			NewCount: h.NewCount,
+			Section:  h.Section,
+		}
+	}
+	return out
+}
+
+// toAPIChangeset converts a parsed changeset, filling Rows or UnifiedRows
+// depending on layout.
+func toAPIChangeset(cs diff.Changeset, src diff.FileSources, layout string) APIChangeset {
+	ac := toAPIChangesetMeta(cs)
+	if layout == layoutUnified {
+		ac.UnifiedRows = toAPIUnifiedRows(diff.BuildUnifiedRows(cs, src))
+		return ac
+	}
+
+	rows := diff.BuildDiffRows(cs, src)
+	ac.Rows = make([]APIDiffRow, 0, len(rows))
+	for _, row := range rows {
+		ac.Rows = append(ac.Rows, APIDiffRow{
+			OldNum:     row.OldNum,
+			NewNum:     row.NewNum,
+			OldClass:   row.OldClass,
+			NewClass:   row.NewClass,
+			OldContent: string(row.OldContent),
+			NewContent: string(row.NewContent),
+			IsContext:  row.IsContext,
+			OldMove:    toAPIMove(row.OldMove),
+			NewMove:    toAPIMove(row.NewMove),
+		})
+	}
+	return ac
+}
+
+func toAPIUnifiedRows(rows []diff.UnifiedRow) []APIUnifiedRow {
+	out := make([]APIUnifiedRow, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, APIUnifiedRow{
+			Type:    row.Type.String(),
+			OldNum:  row.OldNum,
+			NewNum:  row.NewNum,
+			Class:   row.Class,
+			Content: string(row.Content),
+			Move:    toAPIMove(row.Move),
+		})
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+)
+
+// handleAPIChangeset renders a single changeset of a PR on demand. It is the
+// RenderURI of changesets deferred by buildAPIChangesets. With ?base= and
+// ?head= it renders from the compare diff instead, as /compare does. The
+// layout, whitespace and moves options match the PR endpoint.
+func (s *Server) handleAPIChangeset(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		jsonError(w, "invalid PR number", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		jsonError(w, "invalid changeset id", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	layout, err := parseLayout(q.Get("layout"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	diffOpts, err := parseDiffOptions(q)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base, head := q.Get("base"), q.Get("head")
+	if (base == "") != (head == "") {
+		jsonError(w, "base and head must be given together", http.StatusBadRequest)
+		return
+	}
+
+	client := auth.GitHubClientFromContext(r.Context())
+	ctx := r.Context()
+
+	var rawDiff string
+	if base != "" {
+		rawDiff, err = ghapi.FetchCompare(ctx, client, owner, repo, base, head)
+	} else {
+		var pr *ghapi.PullRequest
+		pr, err = ghapi.FetchPR(ctx, client, owner, repo, number)
+		if err == nil {
+			base, head = pr.Base.SHA, pr.Head.SHA
+			rawDiff, err = ghapi.FetchDiff(ctx, client, owner, repo, number)
+		}
+	}
+	if err != nil {
+		jsonError(w, fmt.Sprintf("could not load diff: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	changesets, err := diff.ParseDiff(rawDiff)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("could not parse diff: %v", err), http.StatusInternalServerError)
+		return
+	}
+	diff.Classify(changesets, s.attrs.load(ctx, client, owner, repo, base))
+	// Moves are detected across the whole diff before picking the file.
+	for _, cs := range diff.Apply(changesets, diffOpts) {
+		if cs.ID == id {
+			one := []diff.Changeset{cs}
+			sources := s.loadSources(ctx, client, owner, repo, base, head, one, nil)
+			out := []APIChangeset{toAPIChangeset(cs, sources[0], layout)}
+			s.attachBinaryDiffs(ctx, client, owner, repo, base, head, one, out, 1, nil)
+			attachOutlines(one, sources, out)
+			jsonOK(w, out[0])
+			return
+		}
+	}
+	jsonError(w, "changeset not found", http.StatusNotFound)
+}
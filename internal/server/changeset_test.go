@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+)
+
+func TestChangesetRenderURI(t *testing.T) {
+	q := url.Values{"layout": {"unified"}, "moves": {"true"}, "unrelated": {"x"}}
+	got := changesetRenderURI("octo", "hello", "7", 3, q)
+	want := "/api/pr/octo/hello/7/changeset/3?layout=unified&moves=true"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := changesetRenderURI("octo", "hello", "7", 3, nil); got != "/api/pr/octo/hello/7/changeset/3" {
+		t.Errorf("no options: got %q", got)
+	}
+}
+
+func TestBuildAPIChangesetsDefersLargeFiles(t *testing.T) {
+	big := make([]diff.Line, diff.DefaultLimits.MaxFileLines+1)
+	for i := range big {
+		big[i] = diff.Line{Type: diff.Added, NewNum: i + 1, Content: "x"}
+	}
+	changesets := []diff.Changeset{
+		{ID: 1, NewName: "small.txt", Hunks: []diff.Hunk{{Lines: []diff.Line{{Type: diff.Added, NewNum: 1, Content: "hi"}}}}},
+		{ID: 2, NewName: "big.txt", Hunks: []diff.Hunk{{Lines: big}}},
+	}
+	got := buildAPIChangesets(changesets, diff.DefaultLimits.Plan(changesets), nil, layoutSideBySide, func(id int) string {
+		return changesetRenderURI("o", "r", "1", id, nil)
+	})
+
+	if got[0].Deferred != "" || len(got[0].Rows) != 1 {
+		t.Errorf("small file should render: %+v", got[0])
+	}
+	if got[1].Deferred != diff.DeferTooLarge || got[1].RenderURI != "/api/pr/o/r/1/changeset/2" {
+		t.Errorf("big file should be deferred: deferred=%q uri=%q", got[1].Deferred, got[1].RenderURI)
+	}
+	if len(got[1].Rows) != 0 {
+		t.Errorf("deferred rows = %v, want empty", got[1].Rows)
+	}
+}
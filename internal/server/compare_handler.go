@@ -20,6 +20,17 @@ func (s *Server) handleAPICompare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	layout, err := parseLayout(r.URL.Query().Get("layout"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	diffOpts, err := parseDiffOptions(r.URL.Query())
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	client := auth.GitHubClientFromContext(r.Context())
 	ctx := r.Context()
 
@@ -34,38 +45,15 @@ func (s *Server) handleAPICompare(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, fmt.Sprintf("could not parse diff: %v", err), http.StatusInternalServerError)
 		return
 	}
+	diff.Classify(changesets, s.attrs.load(ctx, client, owner, repo, base))
 
-	apiChangesets := make([]APIChangeset, 0, len(changesets))
-	for _, cs := range changesets {
-		rows := diff.BuildDiffRows(cs)
-		apiRows := make([]APIDiffRow, 0, len(rows))
-		for _, row := range rows {
-			apiRows = append(apiRows, APIDiffRow{
-				OldNum:     row.OldNum,
-				NewNum:     row.NewNum,
-				OldClass:   row.OldClass,
-				NewClass:   row.NewClass,
-				OldContent: string(row.OldContent),
-				NewContent: string(row.NewContent),
-				IsContext:  row.IsContext,
-			})
-		}
-		apiChangesets = append(apiChangesets, APIChangeset{
-			ID:           cs.ID,
-			OldName:      cs.OldName,
-			NewName:      cs.NewName,
-			DisplayPath:  cs.DisplayPath(),
-			LinesAdded:   cs.LinesAdded,
-			LinesRemoved: cs.LinesRemoved,
-			IsNew:        cs.IsNew,
-			IsDeleted:    cs.IsDeleted,
-			IsRenamed:    cs.IsRenamed,
-			IsBinary:     cs.IsBinary,
-			Rows:         apiRows,
-		})
+	renderURI := func(id int) string {
+		return changesetRenderURI(owner, repo, r.PathValue("number"), id, r.URL.Query())
 	}
+	apiChangesets := s.renderChangesets(ctx, client, owner, repo, base, head, diff.Apply(changesets, diffOpts), layout, renderURI)
 
 	jsonOK(w, map[string]any{
 		"changesets": apiChangesets,
+		"layout":     layout,
 	})
 }
@@ -1,7 +1,7 @@
 package server
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -10,39 +10,115 @@ import (
 	ghapi "github.com/nikhilr/ghabricator/internal/github"
 )
 
-// handleContext serves expanded diff context lines via AJAX.
-// GET /api/context?owner=X&repo=X&ref=X&path=X&start=N&end=N&cs=N
-func (s *Server) handleContext(w http.ResponseWriter, r *http.Request) {
-	client := auth.GitHubClientFromContext(r.Context())
+// maxContextLines caps one context expansion.
+const maxContextLines = 1000
 
-	owner := r.URL.Query().Get("owner")
-	repo := r.URL.Query().Get("repo")
-	ref := r.URL.Query().Get("ref")
-	path := r.URL.Query().Get("path")
-	startStr := r.URL.Query().Get("start")
-	endStr := r.URL.Query().Get("end")
-	csStr := r.URL.Query().Get("cs")
+// handleAPIContext serves expanded diff context rows.
+// GET /api/pr/{owner}/{repo}/{number}/context?path=P&side=new|old&start=N&end=N
+//
+// path is the changeset's display path. The new side is read at the head
+// commit and the old side at the merge base, the commits the PR diff
+// compares; with ?base= and ?head= the compare diff's commits are used
+// instead. Rows carry both line numbers, like context rows in the diff.
+func (s *Server) handleAPIContext(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		jsonError(w, "invalid PR number", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	path := q.Get("path")
+	start, startErr := strconv.Atoi(q.Get("start"))
+	end, endErr := strconv.Atoi(q.Get("end"))
+	if path == "" || startErr != nil || endErr != nil || start < 1 || end < start {
+		jsonError(w, "path, start and end (1 <= start <= end) are required", http.StatusBadRequest)
+		return
+	}
+	end = min(end, start+maxContextLines-1)
+	var oldSide bool
+	switch q.Get("side") {
+	case "", "new":
+	case "old":
+		oldSide = true
+	default:
+		jsonError(w, "side must be old or new", http.StatusBadRequest)
+		return
+	}
+	base, head := q.Get("base"), q.Get("head")
+	if (base == "") != (head == "") {
+		jsonError(w, "base and head must be given together", http.StatusBadRequest)
+		return
+	}
 
-	start, _ := strconv.Atoi(startStr)
-	end, _ := strconv.Atoi(endStr)
-	csID, _ := strconv.Atoi(csStr)
+	client := auth.GitHubClientFromContext(r.Context())
+	ctx := r.Context()
 
-	if owner == "" || repo == "" || path == "" || start == 0 || end == 0 {
-		http.Error(w, "missing params", http.StatusBadRequest)
+	var rawDiff string
+	if base != "" {
+		rawDiff, err = ghapi.FetchCompare(ctx, client, owner, repo, base, head)
+	} else {
+		var pr *ghapi.PullRequest
+		pr, err = ghapi.FetchPR(ctx, client, owner, repo, number)
+		if err == nil {
+			base, head = pr.Base.SHA, pr.Head.SHA
+			rawDiff, err = ghapi.FetchDiff(ctx, client, owner, repo, number)
+		}
+	}
+	if err != nil {
+		jsonError(w, fmt.Sprintf("could not load diff: %v", err), http.StatusBadGateway)
 		return
 	}
-	if ref == "" {
-		ref = "HEAD"
+	changesets, err := diff.ParseDiff(rawDiff)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("could not parse diff: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var cs *diff.Changeset
+	for i := range changesets {
+		if changesets[i].DisplayPath() == path {
+			cs = &changesets[i]
+			break
+		}
+	}
+	if cs == nil {
+		jsonError(w, "file not in diff", http.StatusNotFound)
+		return
+	}
+	if (oldSide && cs.IsNew) || (!oldSide && cs.IsDeleted) {
+		jsonError(w, "file does not exist on that side", http.StatusBadRequest)
+		return
 	}
 
-	file, err := ghapi.FetchFileContent(r.Context(), client, owner, repo, ref, path)
+	commit, filePath := head, cs.NewName
+	if oldSide {
+		filePath = cs.OldName
+		if commit, err = s.sources.mergeBase(ctx, client, owner, repo, base, head); err != nil {
+			jsonError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	content, err := s.sources.file(ctx, client, owner, repo, commit, filePath)
 	if err != nil {
-		http.Error(w, "failed to fetch file", http.StatusInternalServerError)
+		jsonError(w, fmt.Sprintf("could not fetch file: %v", err), http.StatusBadGateway)
 		return
 	}
 
-	html := diff.RenderContextRows(path, file.Content, start, end, csID)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"html": html})
+	rows, err := diff.ContextRows(*cs, oldSide, content, start, end)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	apiRows := make([]APIDiffRow, 0, len(rows))
+	for _, row := range rows {
+		apiRows = append(apiRows, APIDiffRow{
+			OldNum:     row.OldNum,
+			NewNum:     row.NewNum,
+			OldContent: string(row.OldContent),
+			NewContent: string(row.NewContent),
+			IsContext:  true,
+		})
+	}
+	jsonOK(w, APIContextResponse{Commit: commit, Path: filePath, Rows: apiRows})
 }
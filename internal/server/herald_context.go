@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+	"github.com/nikhilr/ghabricator/internal/herald"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// heraldContextFromPR builds a PRContext from PR metadata. Diff-derived
+// fields are filled in separately by fillHeraldDiff.
+func heraldContextFromPR(owner, repo string, pr *ghapi.PullRequest) *herald.PRContext {
+	prCtx := &herald.PRContext{
+		Owner:      owner,
+		Repo:       repo,
+		Number:     pr.Number,
+		Author:     pr.Author.Login,
+		Title:      pr.Title,
+		Body:       pr.Body,
+		Draft:      pr.Draft,
+		BaseBranch: pr.Base.Ref,
+		BaseSHA:    pr.Base.SHA,
+		HeadBranch: pr.Head.Ref,
+		HeadSHA:    pr.Head.SHA,
+	}
+	for _, l := range pr.Labels {
+		prCtx.Labels = append(prCtx.Labels, l.Name)
+	}
+	for _, u := range pr.Reviewers {
+		prCtx.Reviewers = append(prCtx.Reviewers, u.Login)
+	}
+	prCtx.TeamReviewers = pr.TeamReviewers
+	for _, u := range pr.Assignees {
+		prCtx.Assignees = append(prCtx.Assignees, u.Login)
+	}
+	return prCtx
+}
+
+// approversFromReviews returns the logins whose latest approving or
+// change-requesting review is an approval. Comments don't change a
+// reviewer's verdict; dismissals clear it.
+func approversFromReviews(reviews []ghapi.Review) []string {
+	verdict := make(map[string]string)
+	var order []string
+	for _, r := range reviews {
+		switch r.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			if _, ok := verdict[r.Author.Login]; !ok {
+				order = append(order, r.Author.Login)
+			}
+			verdict[r.Author.Login] = r.State
+		}
+	}
+	var out []string
+	for _, login := range order {
+		if verdict[login] == "APPROVED" {
+			out = append(out, login)
+		}
+	}
+	return out
+}
+
+// canPush reports whether a viewerPermission lets the viewer change a PR's
+// reviewers, labels and statuses, as Herald actions do.
+func canPush(permission string) bool {
+	switch permission {
+	case "ADMIN", "MAINTAIN", "WRITE":
+		return true
+	}
+	return false
+}
+
+// fillHeraldDiff copies changed paths and added/removed lines from the parsed
+// diff into the Herald context.
+func fillHeraldDiff(prCtx *herald.PRContext, changesets []diff.Changeset) {
+	for _, cs := range changesets {
+		prCtx.ChangedFiles = append(prCtx.ChangedFiles, cs.DisplayPath())
+		prCtx.LinesAdded += cs.LinesAdded
+		prCtx.LinesRemoved += cs.LinesRemoved
+		for _, h := range cs.Hunks {
+			for _, l := range h.Lines {
+				switch l.Type {
+				case diff.Added:
+					prCtx.AddedLines = append(prCtx.AddedLines, l.Content)
+				case diff.Removed:
+					prCtx.RemovedLines = append(prCtx.RemovedLines, l.Content)
+				}
+			}
+		}
+	}
+}
+
+// teamMemberFunc returns a memoized PRContext.TeamMember for login. Lookup
+// failures are logged and treated as "not a member".
+func teamMemberFunc(ctx context.Context, client *gh.Client, login string) func(string) bool {
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]bool)
+	)
+	return func(team string) bool {
+		team = strings.ToLower(strings.TrimSpace(team))
+		mu.Lock()
+		defer mu.Unlock()
+		if member, ok := cache[team]; ok {
+			return member
+		}
+		org, slug, ok := strings.Cut(team, "/")
+		if !ok || org == "" || slug == "" {
+			cache[team] = false
+			return false
+		}
+		member, err := ghapi.IsTeamMember(ctx, client, org, slug, login)
+		if err != nil {
+			log.Printf("herald: %v", err)
+		}
+		cache[team] = member
+		return member
+	}
+}
+
+// repoRuleCache holds the parsed .ghabricator/herald.yml of each repository
+// per base SHA. The zero value is ready to use.
+type repoRuleCache struct {
+	cache shaCache[[]herald.Rule] // nil if there is no file
+}
+
+// load returns the repository's rules at baseSHA, fetching and parsing the
+// file on a cache miss. Fetch errors other than a missing file aren't
+// cached, so they are retried on the next call.
+func (c *repoRuleCache) load(ctx context.Context, client *gh.Client, owner, repo, baseSHA string) []herald.Rule {
+	if baseSHA == "" {
+		return nil
+	}
+	key := shaKey(owner, repo, baseSHA, herald.RepoRulesPath)
+	if rules, ok := c.cache.get(key); ok {
+		return rules
+	}
+
+	content, found, err := fetchOptionalFile(ctx, client, owner, repo, baseSHA, herald.RepoRulesPath)
+	if err != nil {
+		log.Printf("herald: %s/%s: %v", owner, repo, err)
+		return nil
+	}
+	var rules []herald.Rule
+	if found {
+		var errs []error
+		rules, errs = herald.ParseRepoRules(owner+"/"+repo, []byte(content))
+		for _, e := range errs {
+			log.Printf("herald: %s/%s@%.7s: %v", owner, repo, baseSHA, e)
+		}
+	}
+	c.cache.put(key, rules)
+	return rules
+}
+
+// heraldRules returns the server rules followed by the PR repository's own
+// rules from its base branch. Evaluate orders them by precedence.
+func (s *Server) heraldRules(ctx context.Context, client *gh.Client, prCtx *herald.PRContext) ([]herald.Rule, error) {
+	rules, err := s.herald.List()
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, s.repoRules.load(ctx, client, prCtx.Owner, prCtx.Repo, prCtx.BaseSHA)...), nil
+}
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+	"github.com/nikhilr/ghabricator/internal/herald"
+)
+
+// handleAPIHeraldTest dry-runs a rule against a PR and explains each
+// condition. Either a saved rule (ruleId) or an unsaved definition (rule) may
+// be given. Actions are reported, never executed.
+// POST /api/herald/test
+func (s *Server) handleAPIHeraldTest(w http.ResponseWriter, r *http.Request) {
+	var req APIHeraldTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Owner == "" || req.Repo == "" || req.Number == 0 {
+		jsonError(w, "missing owner/repo/number", http.StatusBadRequest)
+		return
+	}
+
+	rule := req.Rule
+	if rule == nil {
+		if req.RuleID == "" {
+			jsonError(w, "rule or ruleId is required", http.StatusBadRequest)
+			return
+		}
+		saved, err := s.herald.Get(req.RuleID)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("load rule: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if saved == nil || !saved.VisibleTo(auth.SessionFromContext(r.Context()).Login) {
+			jsonError(w, "rule not found", http.StatusNotFound)
+			return
+		}
+		rule = saved
+	}
+
+	sess := auth.SessionFromContext(r.Context())
+	client := auth.GitHubClientFromContext(r.Context())
+	ctx := r.Context()
+
+	var (
+		gqlResult       *ghapi.PRDetailGraphQL
+		rawDiff         string
+		gqlErr, diffErr error
+	)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		gqlResult, gqlErr = ghapi.FetchPRDetailGraphQL(ctx, sess.Token.AccessToken, req.Owner, req.Repo, req.Number)
+	}()
+	go func() {
+		defer wg.Done()
+		rawDiff, diffErr = ghapi.FetchDiff(ctx, client, req.Owner, req.Repo, req.Number)
+	}()
+	wg.Wait()
+
+	if gqlErr != nil {
+		jsonError(w, fmt.Sprintf("could not load PR: %v", gqlErr), http.StatusBadGateway)
+		return
+	}
+	if diffErr != nil {
+		jsonError(w, fmt.Sprintf("could not load diff: %v", diffErr), http.StatusBadGateway)
+		return
+	}
+	changesets, err := diff.ParseDiff(rawDiff)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("could not parse diff: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	prCtx := heraldContextFromPR(req.Owner, req.Repo, gqlResult.PR)
+	prCtx.TeamMember = teamMemberFunc(ctx, client, prCtx.Author)
+	fillHeraldDiff(prCtx, changesets)
+
+	trace := herald.Trace(rule, prCtx)
+	resp := APIHeraldTestResponse{
+		InScope:    trace.InScope,
+		Matched:    trace.Matched,
+		Disabled:   rule.Disabled,
+		Conditions: toAPIConditionResults(trace.Conditions),
+		Actions:    []APIHeraldAction{},
+	}
+	if trace.Matched {
+		for _, a := range rule.Actions {
+			resp.Actions = append(resp.Actions, APIHeraldAction{Type: string(a.Type), Value: a.Value})
+		}
+	}
+	jsonOK(w, resp)
+}
+
+// handleAPIHeraldTranscripts lists rule firings, newest first. Filters:
+// rule (rule ID), repo ("owner/repo") and number. Transcripts of other
+// users' personal rules are hidden.
+// GET /api/herald/transcripts
+func (s *Server) handleAPIHeraldTranscripts(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
+	q := r.URL.Query()
+	filter := herald.TranscriptFilter{RuleID: q.Get("rule"), Repo: q.Get("repo")}
+	if n := q.Get("number"); n != "" {
+		num, err := strconv.Atoi(n)
+		if err != nil {
+			jsonError(w, "invalid number", http.StatusBadRequest)
+			return
+		}
+		filter.Number = num
+	}
+
+	hidden, err := s.hiddenHeraldRules(sess.Login)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("load rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ts, err := s.heraldExec.Transcripts().List(filter)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("load transcripts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]APIHeraldTranscript, 0, len(ts))
+	for _, t := range ts {
+		if hidden[t.RuleID] {
+			continue
+		}
+		at := APIHeraldTranscript{
+			ID:         t.ID,
+			RuleID:     t.RuleID,
+			RuleName:   t.RuleName,
+			Repetition: string(t.Repetition),
+			Repo:       t.Repo,
+			Number:     t.Number,
+			HeadSHA:    t.HeadSHA,
+			Conditions: toAPIConditionResults(t.Conditions),
+			Actions:    make([]APIHeraldLogEntry, 0, len(t.Actions)),
+			Errors:     t.Errors,
+			At:         t.At,
+		}
+		for _, e := range t.Actions {
+			at.Actions = append(at.Actions, toAPIHeraldLogEntry(e))
+		}
+		resp = append(resp, at)
+	}
+	jsonOK(w, resp)
+}
+
+func toAPIConditionResults(results []herald.ConditionResult) []APIHeraldConditionResult {
+	out := make([]APIHeraldConditionResult, 0, len(results))
+	for _, c := range results {
+		out = append(out, APIHeraldConditionResult{
+			Type:     string(c.Condition.Type),
+			Operator: string(c.Condition.Operator),
+			Value:    c.Condition.Value,
+			Matched:  c.Matched,
+			Reason:   c.Reason,
+		})
+	}
+	return out
+}
+
+func toAPIHeraldLogEntry(e herald.LogEntry) APIHeraldLogEntry {
+	return APIHeraldLogEntry{
+		RuleID:   e.RuleID,
+		RuleName: e.RuleName,
+		Action:   APIHeraldAction{Type: string(e.Action.Type), Value: e.Action.Value},
+		Status:   string(e.Status),
+		Error:    e.Error,
+		At:       e.At,
+	}
+}
+
+// hiddenHeraldRules returns the IDs of the stored rules login may not see,
+// whose names and firings are left out of responses.
+func (s *Server) hiddenHeraldRules(login string) (map[string]bool, error) {
+	rules, err := s.herald.List()
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[string]bool)
+	for _, rule := range rules {
+		if !rule.VisibleTo(login) {
+			hidden[rule.ID] = true
+		}
+	}
+	return hidden, nil
+}
+
+// heraldAuthz answers rule permission questions for one request, looking up
+// each repository's viewerPermission at most once.
+type heraldAuthz struct {
+	r     *http.Request
+	login string
+	perms map[string]string // lowercased "owner/repo" -> permission
+	admin bool              // may create and edit global rules
+}
+
+func (s *Server) newHeraldAuthz(r *http.Request) *heraldAuthz {
+	return &heraldAuthz{
+		r:     r,
+		login: auth.SessionFromContext(r.Context()).Login,
+		perms: make(map[string]string),
+		admin: s.isHeraldAdmin(auth.SessionFromContext(r.Context()).Login),
+	}
+}
+
+// permission returns the user's viewerPermission on an "owner/repo", or ""
+// if it can't be determined.
+func (a *heraldAuthz) permission(fullRepo string) string {
+	key := strings.ToLower(fullRepo)
+	if perm, ok := a.perms[key]; ok {
+		return perm
+	}
+	owner, repo, _ := strings.Cut(fullRepo, "/")
+	sess := auth.SessionFromContext(a.r.Context())
+	perm, err := ghapi.FetchViewerPermission(a.r.Context(), sess.Token.AccessToken, owner, repo)
+	if err != nil {
+		log.Printf("herald: permission on %s: %v", fullRepo, err)
+	}
+	a.perms[key] = perm
+	return perm
+}
+
+// canEdit reports whether the user may modify or delete rule. The repository
+// permission is only looked up for repository-scoped rules the user doesn't
+// own.
+func (a *heraldAuthz) canEdit(rule *herald.Rule) bool {
+	if rule.EditableBy(a.login, "") {
+		return true
+	}
+	if rule.EffectiveScope() != herald.ScopeRepository {
+		return false
+	}
+	return rule.EditableBy(a.login, a.permission(rule.Repository))
+}
+
+// checkWrite checks that the user may save rule over existing (nil for a new
+// rule), and sets rule.AuthorLogin: editing doesn't transfer ownership.
+func (a *heraldAuthz) checkWrite(existing, rule *herald.Rule) error {
+	if existing != nil {
+		if !a.canEdit(existing) {
+			return fmt.Errorf("only the author of %q or a repository admin can edit it", existing.Name)
+		}
+		rule.AuthorLogin = existing.AuthorLogin
+	} else {
+		rule.AuthorLogin = a.login
+	}
+
+	// Rules saved before scopes existed count as global, but their authors
+	// keep editing them as long as they stay that way.
+	legacy := existing != nil && existing.Scope == "" && rule.EffectiveScope() == herald.ScopeGlobal &&
+		strings.EqualFold(existing.AuthorLogin, a.login)
+	if legacy {
+		rule.Scope = ""
+	}
+
+	// Global rules run on every PR the server sees.
+	if rule.EffectiveScope() == herald.ScopeGlobal && !a.admin && !legacy {
+		return fmt.Errorf("only Herald admins can create or edit global rules")
+	}
+
+	// Binding a rule to a repository (or moving it to another one) requires
+	// admin rights there, since it then runs on every PR in that repository.
+	if rule.EffectiveScope() == herald.ScopeRepository &&
+		(existing == nil || existing.EffectiveScope() != herald.ScopeRepository || !strings.EqualFold(existing.Repository, rule.Repository)) {
+		if a.permission(rule.Repository) != "ADMIN" {
+			return fmt.Errorf("repository-scoped rules require admin access to %s", rule.Repository)
+		}
+	}
+	return nil
+}
+
+// handleAPIHeraldExport downloads the rules visible to the user as a bundle.
+// format is yaml (default) or json; scope and repo narrow the set.
+// GET /api/herald/export
+func (s *Server) handleAPIHeraldExport(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "yaml"
+	}
+
+	rules, err := s.herald.List()
+	if err != nil {
+		jsonError(w, fmt.Sprintf("load rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var selected []herald.Rule
+	for _, rule := range rules {
+		if !rule.VisibleTo(sess.Login) {
+			continue
+		}
+		if scope := q.Get("scope"); scope != "" && string(rule.EffectiveScope()) != scope {
+			continue
+		}
+		if repo := q.Get("repo"); repo != "" && !rule.AppliesTo(repo) {
+			continue
+		}
+		selected = append(selected, rule)
+	}
+
+	data, err := herald.MarshalBundle(selected, format)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := "application/yaml"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="herald-rules.`+format+`"`)
+	w.Write(data)
+}
+
+// handleAPIHeraldImport applies a YAML or JSON bundle (the request body).
+// mode is merge (default) or replace; replace deletes rules the user can
+// edit that are missing from the bundle. dryRun=true only reports the plan.
+// Nothing is written unless every rule validates and is permitted, and the
+// changes are applied all at once.
+// POST /api/herald/import
+func (s *Server) handleAPIHeraldImport(w http.ResponseWriter, r *http.Request) {
+	sess := auth.SessionFromContext(r.Context())
+	q := r.URL.Query()
+	mode := herald.ImportMode(q.Get("mode"))
+	if mode == "" {
+		mode = herald.ImportMerge
+	}
+	if mode != herald.ImportMerge && mode != herald.ImportReplace {
+		jsonError(w, "mode must be merge or replace", http.StatusBadRequest)
+		return
+	}
+	dryRun := q.Get("dryRun") == "true"
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 5<<20))
+	if err != nil {
+		jsonError(w, "read body", http.StatusBadRequest)
+		return
+	}
+	bundle, err := herald.ParseBundle(data)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := APIHeraldImportResponse{Mode: string(mode), DryRun: dryRun, Changes: []APIHeraldRuleChange{}}
+	for _, e := range bundle.Validate() {
+		resp.Errors = append(resp.Errors, e.Error())
+	}
+	if len(resp.Errors) > 0 {
+		jsonStatus(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	rules, err := s.herald.List()
+	if err != nil {
+		jsonError(w, fmt.Sprintf("load rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Rules the user can't see don't take part in the plan; bundle rules
+	// that collide with one get a new ID, so the import doesn't reveal it.
+	var existing []herald.Rule
+	taken := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.VisibleTo(sess.Login) {
+			existing = append(existing, rule)
+		} else {
+			taken[rule.ID] = true
+		}
+	}
+	herald.ReassignIDs(bundle.Rules, taken, strings.ToLower(sess.Login))
+
+	authz := s.newHeraldAuthz(r)
+	plan := herald.PlanImport(existing, bundle.Rules, mode, authz.canEdit)
+	for i := range plan {
+		c := &plan[i]
+		var err error
+		switch c.Kind {
+		case herald.ChangeCreate, herald.ChangeUpdate:
+			err = authz.checkWrite(c.Existing, &c.Rule)
+		}
+		if err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("%s: %v", c.Rule.Name, err))
+		}
+		resp.Changes = append(resp.Changes, APIHeraldRuleChange{
+			Kind:   string(c.Kind),
+			RuleID: c.Rule.ID,
+			Name:   c.Rule.Name,
+			Fields: c.Fields,
+		})
+	}
+	if len(resp.Errors) > 0 {
+		jsonStatus(w, http.StatusForbidden, resp)
+		return
+	}
+	if dryRun {
+		jsonOK(w, resp)
+		return
+	}
+
+	var (
+		put []*herald.Rule
+		del []string
+	)
+	for i := range plan {
+		c := &plan[i]
+		switch c.Kind {
+		case herald.ChangeCreate, herald.ChangeUpdate:
+			put = append(put, &c.Rule)
+		case herald.ChangeDelete:
+			del = append(del, c.Rule.ID)
+		}
+	}
+	if err := s.herald.Apply(put, del); err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+		jsonStatus(w, http.StatusInternalServerError, resp)
+		return
+	}
+	jsonOK(w, resp)
+}
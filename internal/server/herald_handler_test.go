@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/herald"
+
+	gh "github.com/google/go-github/v68/github"
+	"golang.org/x/oauth2"
+)
+
+// rewriteTransport sends every request to target, so code with hard-coded
+// GitHub URLs (the GraphQL endpoint) talks to a fake server.
+type rewriteTransport struct{ target *url.URL }
+
+func (rt rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// newHeraldTestServer returns a Server with a Herald store in a temp HOME
+// and a GitHub client, both talking to a fake GitHub that serves
+// PR acme/widgets#42 with the recorded webhook diff.
+func newHeraldTestServer(t *testing.T) (*Server, *gh.Client) {
+	t.Setenv("HOME", t.TempDir())
+
+	rawDiff := loadFixture(t, "pull_request.diff")
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graphql":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {
+				"number": 42, "title": "Update the docs", "state": "OPEN",
+				"author": {"login": "octocat"},
+				"headRef": {"name": "docs", "target": {"oid": "6dcb09b5b57875f334f61aebed695e2e4193db5e"}, "repository": {"nameWithOwner": "acme/widgets"}},
+				"baseRef": {"name": "main", "target": {"oid": "9049f1265b7d61be4a8904a9a27120d2064dab3b"}, "repository": {"nameWithOwner": "acme/widgets"}}
+			}}}}`))
+		case "/repos/acme/widgets/pulls/42":
+			w.Write(rawDiff)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(fake.Close)
+
+	target, _ := url.Parse(fake.URL)
+	saved := http.DefaultClient.Transport
+	http.DefaultClient.Transport = rewriteTransport{target: target}
+	t.Cleanup(func() { http.DefaultClient.Transport = saved })
+
+	store, err := herald.OpenStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &Server{herald: store}, newTestClient(fake.URL)
+}
+
+func postHeraldTest(s *Server, client *gh.Client, login string, req APIHeraldTestRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/herald/test", bytes.NewReader(body))
+	sess := &auth.Session{Login: login, Token: &oauth2.Token{AccessToken: "token"}}
+	r = r.WithContext(auth.NewContext(r.Context(), sess, client))
+	rec := httptest.NewRecorder()
+	s.handleAPIHeraldTest(rec, r)
+	return rec
+}
+
+func TestHeraldTestTracesRule(t *testing.T) {
+	s, client := newHeraldTestServer(t)
+	rule := &herald.Rule{
+		Name: "docs",
+		Conditions: []herald.Condition{
+			{Type: herald.CondFilePath, Value: "docs/*.md"},
+			{Type: herald.CondAuthor, Value: "hubot"},
+		},
+		Actions: []herald.Action{{Type: herald.ActionAddLabel, Value: "documentation"}},
+	}
+
+	rec := postHeraldTest(s, client, "alice", APIHeraldTestRequest{Rule: rule, Owner: "acme", Repo: "widgets", Number: 42})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp APIHeraldTestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.InScope || !resp.Matched {
+		t.Errorf("inScope=%v matched=%v, want both", resp.InScope, resp.Matched)
+	}
+	if len(resp.Conditions) != 2 || !resp.Conditions[0].Matched || resp.Conditions[1].Matched {
+		t.Errorf("conditions = %+v, want file path matched and author not", resp.Conditions)
+	}
+	if len(resp.Actions) != 1 || resp.Actions[0].Value != "documentation" {
+		t.Errorf("actions = %+v", resp.Actions)
+	}
+}
+
+func TestHeraldTestRejectsBadRequests(t *testing.T) {
+	s, client := newHeraldTestServer(t)
+	private := &herald.Rule{
+		Name:        "mine",
+		AuthorLogin: "bob",
+		Scope:       herald.ScopePersonal,
+		Conditions:  []herald.Condition{{Type: herald.CondFilePath, Value: "*"}},
+		Actions:     []herald.Action{{Type: herald.ActionAddLabel, Value: "x"}},
+	}
+	if err := s.herald.Save(private); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  APIHeraldTestRequest
+		want int
+	}{
+		{"no PR", APIHeraldTestRequest{RuleID: private.ID, Owner: "acme", Repo: "widgets"}, http.StatusBadRequest},
+		{"no rule", APIHeraldTestRequest{Owner: "acme", Repo: "widgets", Number: 42}, http.StatusBadRequest},
+		{"someone else's personal rule", APIHeraldTestRequest{RuleID: private.ID, Owner: "acme", Repo: "widgets", Number: 42}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postHeraldTest(s, client, "alice", tt.req); rec.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGlobalRulesRequireAdmin(t *testing.T) {
+	s := &Server{heraldAdmins: parseLogins("Root, ops")}
+	for _, tt := range []struct {
+		login string
+		scope herald.RuleScope
+		ok    bool
+	}{
+		{"alice", herald.ScopePersonal, true},
+		{"alice", herald.ScopeGlobal, false},
+		{"alice", "", false}, // legacy rules are global
+		{"root", herald.ScopeGlobal, true},
+	} {
+		a := &heraldAuthz{login: tt.login, perms: map[string]string{}, admin: s.isHeraldAdmin(tt.login)}
+		err := a.checkWrite(nil, &herald.Rule{Name: "r", Scope: tt.scope})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s saving a %q rule: err = %v, want ok=%v", tt.login, tt.scope, err, tt.ok)
+		}
+	}
+
+	// Authors keep editing the rules they saved before scopes existed, as
+	// long as they stay global; nobody else gains access to them.
+	legacy := &herald.Rule{Name: "old", AuthorLogin: "alice"}
+	for _, tt := range []struct {
+		login string
+		scope herald.RuleScope
+		ok    bool
+	}{
+		{"alice", "", true},
+		{"alice", herald.ScopeGlobal, true},
+		{"alice", herald.ScopePersonal, true},
+		{"bob", "", false},
+	} {
+		a := &heraldAuthz{login: tt.login, perms: map[string]string{}, admin: s.isHeraldAdmin(tt.login)}
+		rule := &herald.Rule{Name: "old", Scope: tt.scope}
+		err := a.checkWrite(legacy, rule)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s editing a legacy rule as %q: err = %v, want ok=%v", tt.login, tt.scope, err, tt.ok)
+		}
+		if err == nil && tt.scope != herald.ScopePersonal && rule.Scope != "" {
+			t.Errorf("%s editing a legacy rule made it %q; want it to stay legacy", tt.login, rule.Scope)
+		}
+	}
+}
+
+func TestHeraldImportAroundHiddenRules(t *testing.T) {
+	s, client := newHeraldTestServer(t)
+	private := &herald.Rule{
+		ID:          "docs",
+		Name:        "bob's docs",
+		AuthorLogin: "bob",
+		Scope:       herald.ScopePersonal,
+		Conditions:  []herald.Condition{{Type: herald.CondFilePath, Value: "*"}},
+		Actions:     []herald.Action{{Type: herald.ActionAddLabel, Value: "x"}},
+	}
+	if err := s.herald.Save(private); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := `{"version": 1, "rules": [{"id": "docs", "name": "docs", "scope": "personal",
+		"conditions": [{"type": "file_path", "value": "docs/*"}],
+		"actions": [{"type": "add_label", "value": "documentation"}]}]}`
+	importAs := func() APIHeraldImportResponse {
+		r := httptest.NewRequest(http.MethodPost, "/api/herald/import?mode=replace", strings.NewReader(bundle))
+		sess := &auth.Session{Login: "alice", Token: &oauth2.Token{AccessToken: "token"}}
+		r = r.WithContext(auth.NewContext(r.Context(), sess, client))
+		rec := httptest.NewRecorder()
+		s.handleAPIHeraldImport(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp APIHeraldImportResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := importAs()
+	if len(resp.Changes) != 1 || resp.Changes[0].Kind != "create" || resp.Changes[0].RuleID == "docs" {
+		t.Fatalf("changes = %+v, want a create under a new ID", resp.Changes)
+	}
+	if got, _ := s.herald.Get("docs"); got == nil || got.Name != "bob's docs" {
+		t.Errorf("hidden rule = %+v, want it untouched", got)
+	}
+	// Importing again updates the same copy instead of adding another.
+	if again := importAs(); len(again.Changes) != 1 || again.Changes[0].RuleID != resp.Changes[0].RuleID || again.Changes[0].Kind != "unchanged" {
+		t.Errorf("re-import changes = %+v", again.Changes)
+	}
+	if rules, _ := s.herald.List(); len(rules) != 2 {
+		t.Errorf("got %d rules, want 2", len(rules))
+	}
+}
@@ -1,27 +1,116 @@
 package server
 
 import (
-	"sync"
-	"sync/atomic"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/drafts"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
 )
 
-// Draft inline comment stored in memory between op=new and op=save.
-type inlineDraft struct {
-	Owner     string
-	Repo      string
-	Number    int
-	Path      string
-	Line      int
-	Side      string // LEFT or RIGHT
-	InReplyTo int64  // if replying to an existing comment
+// handleAPIDrafts lists the session user's unpublished inline comments on
+// a PR, so the diff can restore them after a reload.
+// GET /api/pr/{owner}/{repo}/{number}/drafts
+func (s *Server) handleAPIDrafts(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		jsonError(w, "invalid PR number", http.StatusBadRequest)
+		return
+	}
+	sess := auth.SessionFromContext(r.Context())
+	list, err := s.drafts.List(drafts.Key{
+		Login:  sess.Login,
+		Owner:  r.PathValue("owner"),
+		Repo:   r.PathValue("repo"),
+		Number: number,
+	})
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]APIInlineComment, len(list))
+	for i, d := range list {
+		out[i] = draftToAPI(d, sess)
+	}
+	jsonOK(w, map[string]any{"drafts": out})
 }
 
-var (
-	draftMu    sync.Mutex
-	draftSeq   atomic.Int64
-	draftStore = make(map[int64]*inlineDraft)
-)
+// handleAPIThread resolves or unresolves a review thread.
+// POST /api/v2/thread
+func (s *Server) handleAPIThread(w http.ResponseWriter, r *http.Request) {
+	var req APIThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.ThreadID == "" {
+		jsonError(w, "missing threadID", http.StatusBadRequest)
+		return
+	}
+	var resolved bool
+	switch req.Operation {
+	case "resolve":
+		resolved = true
+	case "unresolve":
+	default:
+		jsonError(w, "unknown operation: "+req.Operation, http.StatusBadRequest)
+		return
+	}
+
+	client := auth.GitHubClientFromContext(r.Context())
+	if err := ghapi.SetThreadResolved(r.Context(), client, req.ThreadID, resolved); err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	jsonOK(w, map[string]any{"ok": true, "isResolved": resolved})
+}
+
+// threadOf returns the thread holding the comment id.
+func threadOf(threads []ghapi.ReviewThread, id int64) (ghapi.ReviewThread, bool) {
+	for _, t := range threads {
+		if slices.Contains(t.CommentIDs, id) {
+			return t, true
+		}
+	}
+	return ghapi.ReviewThread{}, false
+}
+
+func toAPIThreads(threads []ghapi.ReviewThread) []APIReviewThread {
+	out := make([]APIReviewThread, 0, len(threads))
+	for _, t := range threads {
+		out = append(out, APIReviewThread{
+			ID:                t.ID,
+			Path:              t.Path,
+			Side:              t.DiffSide,
+			Line:              t.Line,
+			StartLine:         t.StartLine,
+			OriginalLine:      t.OriginalLine,
+			OriginalStartLine: t.OriginalStartLine,
+			IsResolved:        t.IsResolved,
+			IsOutdated:        t.IsOutdated,
+			ResolvedBy:        t.ResolvedBy,
+			CommentIDs:        t.CommentIDs,
+		})
+	}
+	return out
+}
 
-func nextDraftID() int64 {
-	return draftSeq.Add(1)
+// draftToAPI converts a draft for the inline API; the author is the
+// session user.
+func draftToAPI(d drafts.Draft, sess *auth.Session) APIInlineComment {
+	return APIInlineComment{
+		ID:        d.ID,
+		Author:    APIUser{Login: sess.Login, AvatarURL: sess.AvatarURL},
+		Body:      d.Body,
+		Path:      d.Path,
+		Line:      d.Line,
+		Side:      d.Side,
+		StartLine: d.StartLine,
+		StartSide: d.StartSide,
+		InReplyTo: d.InReplyTo,
+		Draft:     true,
+	}
 }
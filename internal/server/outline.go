@@ -0,0 +1,46 @@
+package server
+
+import (
+	"github.com/nikhilr/ghabricator/internal/diff"
+)
+
+// attachOutlines fills ChangedSymbols and empty hunk sections on the API
+// changesets (parallel to changesets) whose files were loaded into sources.
+// The others keep git's hunk context only.
+func attachOutlines(changesets []diff.Changeset, sources []diff.FileSources, out []APIChangeset) {
+	for i, cs := range changesets {
+		src := sources[i]
+		if (!cs.IsNew && !src.HasOld) || (!cs.IsDeleted && !src.HasNew) {
+			continue
+		}
+		var oldSyms, newSyms diff.Symbols
+		if src.HasOld {
+			oldSyms = diff.ParseSymbols(cs.OldName, src.Old)
+		}
+		if src.HasNew {
+			newSyms = diff.ParseSymbols(cs.NewName, src.New)
+		}
+		out[i].Symbols = toAPISymbols(diff.ChangedSymbols(cs, oldSyms, newSyms))
+		for j, h := range cs.Hunks {
+			out[i].Hunks[j].Section = diff.HunkSection(cs, h, oldSyms, newSyms)
+		}
+	}
+}
+
+func toAPISymbols(syms []diff.ChangedSymbol) []APISymbol {
+	if len(syms) == 0 {
+		return nil
+	}
+	out := make([]APISymbol, len(syms))
+	for i, sym := range syms {
+		out[i] = APISymbol{
+			Kind:    sym.Kind,
+			Name:    sym.Name,
+			Label:   sym.Label,
+			Change:  sym.Change,
+			OldLine: sym.OldLine,
+			NewLine: sym.NewLine,
+		}
+	}
+	return out
+}
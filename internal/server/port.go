@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+const (
+	// maxPortedFiles is how many interdiffs one PR response computes to port
+	// outdated comments. Each costs two file fetches; comments on the rest
+	// become ghosts.
+	maxPortedFiles = 20
+	// ghostSnippetLines is how much of its diff hunk a ghost comment shows.
+	ghostSnippetLines = 4
+)
+
+// portKey identifies the interdiff of one file between two commits.
+type portKey struct {
+	from, to, oldPath, newPath string
+}
+
+// portComments places outdated comments, which GitHub no longer positions
+// on the PR diff after a push, on current (the changesets as shown): each
+// thread is ported through the interdiff of its file from the version it was
+// made on to the one current shows on its side. Replies follow the thread's
+// first comment. The result has an entry for each outdated comment; those
+// that can't be placed are ghosts.
+//
+// RIGHT comments were made on OriginalCommitID, the head then. LEFT
+// comments were made on its merge base with base, which moves if the PR is
+// rebased.
+func (s *Server) portComments(ctx context.Context, client *gh.Client, owner, repo, base, head string,
+	current []diff.Changeset, comments []ghapi.ReviewComment) map[int64]diff.Port {
+	var roots []ghapi.ReviewComment
+	for _, c := range comments {
+		if c.InReplyTo == 0 && c.Line == 0 {
+			roots = append(roots, c)
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	// The changeset each thread is on, and the interdiff it goes through.
+	onto := make([]*diff.Changeset, len(roots))
+	keys := make([]portKey, len(roots))
+	interdiffs := make(map[portKey]*diff.Changeset)
+	var todo []portKey
+	var headBase string
+	var headBaseErr error
+	for i, c := range roots {
+		cs := changesetForPath(current, c.Path)
+		if cs == nil || c.OriginalLine == 0 || c.OriginalCommitID == "" {
+			continue
+		}
+		if c.Side == "LEFT" && cs.IsNew || c.Side != "LEFT" && cs.IsDeleted {
+			continue
+		}
+		k := portKey{from: c.OriginalCommitID, to: head, oldPath: c.Path, newPath: cs.NewName}
+		if c.Side == "LEFT" {
+			if headBase == "" && headBaseErr == nil {
+				headBase, headBaseErr = s.sources.mergeBase(ctx, client, owner, repo, base, head)
+				if headBaseErr != nil {
+					log.Printf("port comments: %s/%s: %v", owner, repo, headBaseErr)
+				}
+			}
+			if headBaseErr != nil {
+				continue
+			}
+			mb, err := s.sources.mergeBase(ctx, client, owner, repo, base, c.OriginalCommitID)
+			if err != nil {
+				log.Printf("port comments: %s/%s: %v", owner, repo, err)
+				continue
+			}
+			k = portKey{from: mb, to: headBase, oldPath: cs.OldName, newPath: cs.OldName}
+		}
+		if _, ok := interdiffs[k]; !ok {
+			if len(todo) >= maxPortedFiles {
+				continue
+			}
+			interdiffs[k] = nil
+			todo = append(todo, k)
+		}
+		onto[i], keys[i] = cs, k
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fileFetchers)
+	for _, k := range todo {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			oldSrc, err := s.sources.file(ctx, client, owner, repo, k.from, k.oldPath)
+			if err != nil {
+				log.Printf("port comments: %s/%s: %v", owner, repo, err)
+				return
+			}
+			newSrc, err := s.sources.file(ctx, client, owner, repo, k.to, k.newPath)
+			if err != nil {
+				log.Printf("port comments: %s/%s: %v", owner, repo, err)
+				return
+			}
+			cs := diff.TextChangeset(k.oldPath, k.newPath, oldSrc, newSrc)
+			mu.Lock()
+			interdiffs[k] = &cs
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	ports := make(map[int64]diff.Port)
+	for i, c := range roots {
+		p := diff.Port{Ghost: true}
+		if onto[i] != nil && interdiffs[keys[i]] != nil {
+			p = diff.PortComment(*interdiffs[keys[i]], *onto[i], c.Side, c.OriginalStartLine, c.OriginalLine)
+		}
+		ports[c.ID] = p
+	}
+	for _, c := range comments {
+		if p, ok := ports[c.InReplyTo]; ok && c.InReplyTo != 0 {
+			ports[c.ID] = p
+		}
+	}
+	return ports
+}
+
+// changesetForPath returns the changeset of changesets showing path, the
+// file name review comments use: the new name, or the old one of a deleted
+// file.
+func changesetForPath(changesets []diff.Changeset, path string) *diff.Changeset {
+	for i, cs := range changesets {
+		if cs.NewName == path || cs.IsDeleted && cs.OldName == path {
+			return &changesets[i]
+		}
+	}
+	return nil
+}
+
+// ghostContext renders the end of a ghost comment's diff hunk, the code it
+// was made on.
+func ghostContext(c ghapi.ReviewComment) []APIUnifiedRow {
+	cs, ok := diff.HunkSnippet(c.Path, c.DiffHunk, ghostSnippetLines)
+	if !ok {
+		return nil
+	}
+	return toAPIUnifiedRows(diff.BuildUnifiedRows(cs, diff.FileSources{}))
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
@@ -146,12 +147,23 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	layout, err := parseLayout(r.URL.Query().Get("layout"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	diffOpts, err := parseDiffOptions(r.URL.Query())
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	sess := auth.SessionFromContext(r.Context())
 	client := auth.GitHubClientFromContext(r.Context())
 	token := sess.Token.AccessToken
 	ctx := r.Context()
 
-	// Parallel fetch: 1 GraphQL (PR + reviews + comments + commits) + 2 REST (diff + review comments).
+	// Parallel fetch: 1 GraphQL (PR + reviews + comments + commits + review threads) + 2 REST (diff + review comments).
 	var (
 		gqlResult *ghapi.PRDetailGraphQL
 		rawDiff   string
@@ -200,6 +212,7 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, fmt.Sprintf("could not parse diff: %v", err), http.StatusInternalServerError)
 		return
 	}
+	diff.Classify(changesets, s.attrs.load(ctx, client, owner, repo, pr.Base.SHA))
 
 	// Index comments by path.
 	commentsByPath := make(map[string][]ghapi.ReviewComment)
@@ -208,35 +221,14 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build changesets with diff rows.
-	apiChangesets := make([]APIChangeset, 0, len(changesets))
-	for _, cs := range changesets {
-		rows := diff.BuildDiffRows(cs)
-		apiRows := make([]APIDiffRow, 0, len(rows))
-		for _, row := range rows {
-			apiRows = append(apiRows, APIDiffRow{
-				OldNum:     row.OldNum,
-				NewNum:     row.NewNum,
-				OldClass:   row.OldClass,
-				NewClass:   row.NewClass,
-				OldContent: string(row.OldContent),
-				NewContent: string(row.NewContent),
-				IsContext:  row.IsContext,
-			})
-		}
-		apiChangesets = append(apiChangesets, APIChangeset{
-			ID:           cs.ID,
-			OldName:      cs.OldName,
-			NewName:      cs.NewName,
-			DisplayPath:  cs.DisplayPath(),
-			LinesAdded:   cs.LinesAdded,
-			LinesRemoved: cs.LinesRemoved,
-			IsNew:        cs.IsNew,
-			IsDeleted:    cs.IsDeleted,
-			IsRenamed:    cs.IsRenamed,
-			IsBinary:     cs.IsBinary,
-			Rows:         apiRows,
-		})
+	renderURI := func(id int) string {
+		return changesetRenderURI(owner, repo, numberStr, id, r.URL.Query())
 	}
+	applied := diff.Apply(changesets, diffOpts)
+	apiChangesets := s.renderChangesets(ctx, client, owner, repo, pr.Base.SHA, pr.Head.SHA, applied, layout, renderURI)
+
+	// Outdated comments are ported onto the current diff.
+	ports := s.portComments(ctx, client, owner, repo, pr.Base.SHA, pr.Head.SHA, applied, comments)
 
 	// Build API comments by path.
 	apiCommentsByPath := make(map[string][]APIReviewComment, len(commentsByPath))
@@ -251,9 +243,34 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 				Path:      c.Path,
 				Line:      c.Line,
 				Side:      c.Side,
+				StartLine: c.StartLine,
+				StartSide: c.StartSide,
 				CreatedAt: c.CreatedAt,
 				InReplyTo: c.InReplyTo,
 			}
+			if sg := suggestionFor(c); sg != nil {
+				// The suggestion renders as a diff; the body keeps the prose.
+				_, rest, _ := diff.ParseSuggestion(c.Body)
+				ac.Body = remarkup.Render(rest)
+				ac.Suggestion = sg
+			}
+			if p, ok := ports[c.ID]; ok {
+				ac.OriginalLine = c.OriginalLine
+				if p.Ghost {
+					ac.Ghost = true
+					if c.InReplyTo == 0 {
+						ac.GhostContext = ghostContext(c)
+					}
+				} else {
+					ac.Ported = true
+					ac.Line, ac.StartLine = p.Line, p.StartLine
+					if p.StartLine == 0 {
+						ac.StartSide = ""
+					} else if ac.StartSide == "" {
+						ac.StartSide = c.Side
+					}
+				}
+			}
 			if c.Reactions != nil {
 				for _, pair := range []struct {
 					emoji string
@@ -354,28 +371,44 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Herald evaluation.
-	var apiHeraldMatches []APIHeraldMatch
-	if rules, heraldErr := s.herald.List(); heraldErr == nil && len(rules) > 0 {
-		var changedFiles []string
-		for _, cs := range changesets {
-			changedFiles = append(changedFiles, cs.DisplayPath())
-		}
-		var labels []string
-		for _, l := range pr.Labels {
-			labels = append(labels, l.Name)
-		}
-		prCtx := &herald.PRContext{
-			Author:       pr.Author.Login,
-			Title:        pr.Title,
-			Labels:       labels,
-			BaseBranch:   pr.Base.Ref,
-			ChangedFiles: changedFiles,
-		}
+	var (
+		apiHeraldMatches  []APIHeraldMatch
+		apiHeraldBlockers []APIHeraldBlocker
+	)
+	prCtx := heraldContextFromPR(owner, repo, pr)
+	if rules, heraldErr := s.heraldRules(ctx, client, prCtx); heraldErr == nil && len(rules) > 0 {
+		// The executor re-traces conditions for its transcripts after the
+		// response is sent, so team lookups must outlive the request.
+		prCtx.TeamMember = teamMemberFunc(context.WithoutCancel(ctx), client, pr.Author.Login)
+		prCtx.Approvers = approversFromReviews(reviews)
+		fillHeraldDiff(prCtx, changesets)
 		matches := herald.Evaluate(rules, prCtx)
+		if pr.State == "open" && canPush(gqlResult.ViewerPermission) {
+			// Apply actions off the request path; the executor skips anything
+			// it has already done for this PR, and clears blocker statuses of
+			// rules that no longer match. The actions run with the viewer's
+			// token, so only viewers who could take them by hand trigger
+			// them; for everyone else the webhook does. Other users'
+			// personal rules act for their author, not for the viewer.
+			s.heraldJobs.Add(1)
+			go func() {
+				defer s.heraldJobs.Done()
+				execCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				s.heraldExec.Execute(execCtx, client, prCtx, herald.HoldPersonal(matches, sess.Login))
+			}()
+		}
+		// Other users' personal rules stay hidden, even when they match.
+		visible := make(map[string]bool)
 		for _, m := range matches {
+			if !m.Rule.VisibleTo(sess.Login) {
+				continue
+			}
+			visible[m.Rule.ID] = true
 			am := APIHeraldMatch{
 				RuleID:   m.Rule.ID,
 				RuleName: m.Rule.Name,
+				Source:   string(m.Rule.Source),
 			}
 			for _, a := range m.Actions {
 				am.Actions = append(am.Actions, APIHeraldAction{
@@ -385,6 +418,30 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 			}
 			apiHeraldMatches = append(apiHeraldMatches, am)
 		}
+		for _, b := range herald.Blockers(matches, prCtx) {
+			ab := APIHeraldBlocker{
+				Reviewer:      b.Reviewer,
+				Approved:      b.Approved,
+				StatusContext: b.StatusContext(),
+			}
+			// The block is public (it is a commit status); the rule may not be.
+			if visible[b.RuleID] {
+				ab.RuleID, ab.RuleName = b.RuleID, b.RuleName
+			}
+			apiHeraldBlockers = append(apiHeraldBlockers, ab)
+		}
+	}
+
+	// Herald action history for this PR.
+	var apiHeraldLog []APIHeraldLogEntry
+	hidden, hiddenErr := s.hiddenHeraldRules(sess.Login)
+	if entries, err := s.heraldExec.Log().ForPR(owner+"/"+repo, number); err == nil && hiddenErr == nil {
+		for _, e := range entries {
+			if hidden[e.RuleID] {
+				continue
+			}
+			apiHeraldLog = append(apiHeraldLog, toAPIHeraldLogEntry(e))
+		}
 	}
 
 	// Build commits.
@@ -429,12 +486,16 @@ func (s *Server) handleAPIPR(w http.ResponseWriter, r *http.Request) {
 			ChangedFiles: pr.ChangedFiles,
 		},
 		Changesets:       apiChangesets,
+		Layout:           layout,
 		CommentsByPath:   apiCommentsByPath,
+		Threads:          toAPIThreads(gqlResult.ReviewThreads),
 		Reviews:          apiReviews,
 		IssueComments:    apiIssueComments,
 		CheckRuns:        apiCheckRuns,
 		Timeline:         apiTimeline,
 		HeraldMatches:    apiHeraldMatches,
+		HeraldLog:        apiHeraldLog,
+		HeraldBlockers:   apiHeraldBlockers,
 		Commits:          apiCommits,
 		ViewerPermission: gqlResult.ViewerPermission,
 	}
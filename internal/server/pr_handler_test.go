@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/herald"
+
+	"golang.org/x/oauth2"
+)
+
+func TestPRViewHoldsOthersPersonalRules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// acme/widgets#42 by octocat, with alice asked to review; the viewer,
+	// bob, has write access.
+	rawDiff := loadFixture(t, "pull_request.diff")
+	var (
+		mu     sync.Mutex
+		writes []string
+	)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/graphql":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": {"repository": {"viewerPermission": "WRITE", "pullRequest": {
+				"number": 42, "title": "Update the docs", "state": "OPEN",
+				"author": {"login": "octocat"},
+				"reviewRequests": {"nodes": [{"requestedReviewer": {"login": "alice"}}]},
+				"headRef": {"name": "docs", "target": {"oid": "6dcb09b5b57875f334f61aebed695e2e4193db5e"}, "repository": {"nameWithOwner": "acme/widgets"}},
+				"baseRef": {"name": "main", "target": {"oid": "9049f1265b7d61be4a8904a9a27120d2064dab3b"}, "repository": {"nameWithOwner": "acme/widgets"}}
+			}}}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/widgets/pulls/42":
+			w.Write(rawDiff)
+		case r.Method == http.MethodGet:
+			http.NotFound(w, r)
+		default:
+			mu.Lock()
+			writes = append(writes, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL)
+	saved := http.DefaultClient.Transport
+	http.DefaultClient.Transport = rewriteTransport{target: target}
+	defer func() { http.DefaultClient.Transport = saved }()
+
+	store, err := herald.OpenStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	heraldExec, err := herald.OpenExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []*herald.Rule{
+		{Name: "alice's", AuthorLogin: "alice", Scope: herald.ScopePersonal,
+			Conditions: []herald.Condition{{Type: herald.CondFilePath, Value: "*"}},
+			Actions:    []herald.Action{{Type: herald.ActionAddLabel, Value: "alice-only"}}},
+		{Name: "everyone's", AuthorLogin: "carol", Scope: herald.ScopeGlobal,
+			Conditions: []herald.Condition{{Type: herald.CondFilePath, Value: "*"}},
+			Actions:    []herald.Action{{Type: herald.ActionAddLabel, Value: "everyone"}}},
+	} {
+		if err := store.Save(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Server{herald: store, heraldExec: heraldExec}
+	r := httptest.NewRequest(http.MethodGet, "/api/pr/acme/widgets/42", nil)
+	r.SetPathValue("owner", "acme")
+	r.SetPathValue("repo", "widgets")
+	r.SetPathValue("number", "42")
+	sess := &auth.Session{Login: "bob", Token: &oauth2.Token{AccessToken: "token"}}
+	r = r.WithContext(auth.NewContext(r.Context(), sess, newTestClient(fake.URL)))
+	rec := httptest.NewRecorder()
+	s.handleAPIPR(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	s.heraldJobs.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`POST /repos/acme/widgets/issues/42/labels ["everyone"]`}
+	if !slices.Equal(writes, want) {
+		t.Errorf("GitHub writes = %v, want %v", writes, want)
+	}
+	if strings.Contains(rec.Body.String(), "alice's") {
+		t.Error("alice's personal rule is shown to bob")
+	}
+}
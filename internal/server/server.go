@@ -3,15 +3,35 @@ package server
 import (
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/drafts"
 	"github.com/nikhilr/ghabricator/internal/herald"
+
+	gh "github.com/google/go-github/v68/github"
 )
 
 type Server struct {
-	mux    *http.ServeMux
-	auth   *auth.AuthHandler
-	herald *herald.Store
+	mux        *http.ServeMux
+	auth       *auth.AuthHandler
+	herald     *herald.Store
+	heraldExec *herald.Executor
+	repoRules  repoRuleCache   // .ghabricator/herald.yml per repo and base SHA
+	attrs      attributesCache // .gitattributes per repo and base SHA
+	sources    sourceCache     // file contents and merge bases by SHA
+	drafts     *drafts.Store   // unpublished inline comments
+
+	// heraldAdmins are the lowercased logins that may create and edit
+	// global Herald rules.
+	heraldAdmins map[string]bool
+
+	// Webhook delivery. webhookClient acts on PRs without a user session.
+	webhookSecret []byte
+	webhookClient *gh.Client
+
+	heraldJobs sync.WaitGroup // Herald runs started by webhooks and page views
 }
 
 func New() (*Server, error) {
@@ -26,15 +46,63 @@ func New() (*Server, error) {
 		return nil, err
 	}
 
+	// Webhook-triggered Herald runs use HERALD_GITHUB_TOKEN if set,
+	// otherwise the token-mode PAT.
+	webhookClient := authHandler.TokenClient()
+	if tok := os.Getenv("HERALD_GITHUB_TOKEN"); tok != "" {
+		webhookClient = auth.StaticClient(tok)
+	}
+
+	// HERALD_STORE selects the rule backend: sqlite (default) or json.
+	heraldStore, err := herald.OpenStore(os.Getenv("HERALD_STORE"))
+	if err != nil {
+		return nil, err
+	}
+
+	heraldExec, err := herald.OpenExecutor()
+	if err != nil {
+		return nil, err
+	}
+
+	draftStore, err := drafts.OpenDefault()
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		mux:    http.NewServeMux(),
-		auth:   authHandler,
-		herald: herald.NewStore(),
+		mux:           http.NewServeMux(),
+		auth:          authHandler,
+		herald:        heraldStore,
+		heraldExec:    heraldExec,
+		drafts:        draftStore,
+		heraldAdmins:  parseLogins(os.Getenv("HERALD_ADMINS")),
+		webhookSecret: []byte(os.Getenv("GITHUB_WEBHOOK_SECRET")),
+		webhookClient: webhookClient,
 	}
 	s.routes()
 	return s, nil
 }
 
+// parseLogins parses a comma-separated list of GitHub logins into a set.
+func parseLogins(list string) map[string]bool {
+	logins := make(map[string]bool)
+	for _, l := range strings.Split(list, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			logins[strings.ToLower(l)] = true
+		}
+	}
+	return logins
+}
+
+// isHeraldAdmin reports whether login may create and edit global Herald
+// rules: it is in HERALD_ADMINS, or owns the token in token mode.
+func (s *Server) isHeraldAdmin(login string) bool {
+	if s.heraldAdmins[strings.ToLower(login)] {
+		return true
+	}
+	return s.auth != nil && s.auth.IsTokenMode() && strings.EqualFold(s.auth.TokenSession().Login, login)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
@@ -57,11 +125,16 @@ func (s *Server) routes() {
 
 	// PR compare (diff between two commits)
 	s.mux.Handle("GET /api/pr/{owner}/{repo}/{number}/compare", s.auth.RequireAuth(http.HandlerFunc(s.handleAPICompare)))
+	s.mux.Handle("GET /api/pr/{owner}/{repo}/{number}/changeset/{id}", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIChangeset)))
+	s.mux.Handle("GET /api/pr/{owner}/{repo}/{number}/context", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIContext)))
+	s.mux.Handle("GET /api/pr/{owner}/{repo}/{number}/drafts", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIDrafts)))
 
 	// Inline comments
 	s.mux.Handle("POST /api/v2/inline", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIInline)))
 
 	// Review / merge / close
+	s.mux.Handle("POST /api/v2/thread", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIThread)))
+	s.mux.Handle("POST /api/v2/apply-suggestion", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIApplySuggestion)))
 	s.mux.Handle("POST /api/v2/review", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIReview)))
 	s.mux.Handle("POST /api/v2/merge", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIMerge)))
 	s.mux.Handle("POST /api/v2/close", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIClose)))
@@ -78,6 +151,7 @@ func (s *Server) routes() {
 	s.mux.Handle("GET /api/repo/{owner}/{repo}/info", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIRepoInfo)))
 	s.mux.Handle("GET /api/repo/{owner}/{repo}/tree", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIRepoTree)))
 	s.mux.Handle("GET /api/repo/{owner}/{repo}/file", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIRepoFile)))
+	s.mux.Handle("GET /api/repo/{owner}/{repo}/raw", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIRepoRaw)))
 	s.mux.Handle("GET /api/repo/{owner}/{repo}/blame", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIRepoBlame)))
 
 	// Paste
@@ -87,10 +161,17 @@ func (s *Server) routes() {
 
 	// Herald
 	s.mux.Handle("GET /api/herald", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldList)))
+	s.mux.Handle("GET /api/herald/export", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldExport)))
+	s.mux.Handle("POST /api/herald/import", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldImport)))
+	s.mux.Handle("GET /api/herald/transcripts", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldTranscripts)))
+	s.mux.Handle("POST /api/herald/test", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldTest)))
 	s.mux.Handle("GET /api/herald/{id}", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldGet)))
 	s.mux.Handle("POST /api/herald", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldSave)))
 	s.mux.Handle("DELETE /api/herald/{id}", s.auth.RequireAuth(http.HandlerFunc(s.handleAPIHeraldDelete)))
 
+	// Webhooks (authenticated by HMAC signature, not session)
+	s.mux.HandleFunc("POST /api/webhooks/github", s.handleWebhookGitHub)
+
 	// Search
 	s.mux.Handle("GET /api/search", s.auth.RequireAuth(http.HandlerFunc(s.handleAPISearch)))
 
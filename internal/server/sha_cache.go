@@ -0,0 +1,117 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// maxSHACacheEntries bounds each shaCache.
+const maxSHACacheEntries = 512
+
+// shaCache holds values derived from repository content at a commit SHA.
+// Content at a SHA never changes, so entries don't expire; the cache is
+// simply reset when full. The zero value is ready to use.
+type shaCache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]V
+}
+
+func (c *shaCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *shaCache[V]) put(key string, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxSHACacheEntries {
+		c.entries = make(map[string]V)
+	}
+	c.entries[key] = v
+}
+
+// maxFileCacheBytes bounds the total size of the contents a fileCache
+// holds.
+const maxFileCacheBytes = 64 << 20
+
+// fileCache holds file contents by commit SHA, like shaCache, but is bounded
+// by their total size: files can be up to maxSourceBytes each, so a count
+// bound would allow far too much. The least recently used files are evicted
+// first. The zero value is ready to use.
+type fileCache struct {
+	limit   int // bytes; maxFileCacheBytes if 0
+	mu      sync.Mutex
+	size    int                      // total bytes of the contents held
+	order   list.List                // of *fileCacheEntry, most recently used first
+	entries map[string]*list.Element // key -> element of order
+}
+
+type fileCacheEntry struct {
+	key, content string
+}
+
+func (c *fileCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*fileCacheEntry).content, true
+}
+
+func (c *fileCache) put(key, content string) {
+	limit := c.limit
+	if limit == 0 {
+		limit = maxFileCacheBytes
+	}
+	if len(content) > limit {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if el, ok := c.entries[key]; ok {
+		c.size -= len(el.Value.(*fileCacheEntry).content)
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&fileCacheEntry{key: key, content: content})
+	c.size += len(content)
+	for c.size > limit {
+		e := c.order.Remove(c.order.Back()).(*fileCacheEntry)
+		delete(c.entries, e.key)
+		c.size -= len(e.content)
+	}
+}
+
+// shaKey returns the cache key for path in owner/repo at sha.
+func shaKey(owner, repo, sha, path string) string {
+	return strings.ToLower(owner+"/"+repo) + "@" + sha + ":" + path
+}
+
+// fetchOptionalFile fetches path at sha. A missing file is not an error:
+// found is false.
+func fetchOptionalFile(ctx context.Context, client *gh.Client, owner, repo, sha, path string) (content string, found bool, err error) {
+	file, err := ghapi.FetchFileContent(ctx, client, owner, repo, sha, path)
+	var ghErr *gh.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return file.Content, true, nil
+}
@@ -0,0 +1,27 @@
+package server
+
+import "testing"
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := fileCache{limit: 10}
+	c.put("a", "aaaa")
+	c.put("b", "bbbb")
+	c.get("a")
+	c.put("c", "cccc") // over the limit: b is the least recently used
+	if _, ok := c.get("b"); ok {
+		t.Error("b not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	if c.size != 8 {
+		t.Errorf("size = %d, want 8", c.size)
+	}
+
+	c.put("big", "0123456789x")
+	if _, ok := c.get("big"); ok || c.size != 8 {
+		t.Errorf("cached a file over the limit; size = %d", c.size)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+const (
+	// maxSourceBytes is the largest file fetched whole for outlines and
+	// highlighting.
+	maxSourceBytes = 1 << 20
+	// maxSourceFiles is how many changesets of a diff response get their
+	// files loaded. Each costs up to two fetches; the rest are highlighted
+	// hunk by hunk and keep git's hunk context.
+	maxSourceFiles = 30
+)
+
+// sourceCache holds file contents and merge bases by commit SHA. Only
+// lookups by full SHA are cached; branch names can move. The zero value is
+// ready to use.
+type sourceCache struct {
+	files      fileCache
+	mergeBases shaCache[string]
+}
+
+// file returns the text of path at ref. Files over maxSourceBytes are an
+// error.
+func (c *sourceCache) file(ctx context.Context, client *gh.Client, owner, repo, ref, path string) (string, error) {
+	key := shaKey(owner, repo, ref, path)
+	if src, ok := c.files.get(key); ok {
+		return src, nil
+	}
+	blob, err := ghapi.FetchFileBlob(ctx, client, owner, repo, ref, path, maxSourceBytes)
+	if err != nil {
+		return "", err
+	}
+	if blob.Data == nil {
+		return "", fmt.Errorf("%s is larger than %d bytes", path, maxSourceBytes)
+	}
+	src := string(blob.Data)
+	if fullSHA.MatchString(ref) {
+		c.files.put(key, src)
+	}
+	return src, nil
+}
+
+// mergeBase returns the merge base of base and head, the old side of a PR
+// or compare diff.
+func (c *sourceCache) mergeBase(ctx context.Context, client *gh.Client, owner, repo, base, head string) (string, error) {
+	key := shaKey(owner, repo, base, head)
+	if sha, ok := c.mergeBases.get(key); ok {
+		return sha, nil
+	}
+	sha, err := ghapi.FetchMergeBase(ctx, client, owner, repo, base, head)
+	if err != nil {
+		return "", err
+	}
+	if fullSHA.MatchString(base) && fullSHA.MatchString(head) {
+		c.mergeBases.put(key, sha)
+	}
+	return sha, nil
+}
+
+// loadSources fetches both versions of the files of changesets rendered as
+// text: those with hunks, not binary, and not deferred by plan (which may be
+// nil). The old side is read at the merge base of base and head and the new
+// side at head. A file that can't be loaded is logged and left out of its
+// FileSources.
+func (s *Server) loadSources(ctx context.Context, client *gh.Client, owner, repo, base, head string,
+	changesets []diff.Changeset, plan []string) []diff.FileSources {
+	sources := make([]diff.FileSources, len(changesets))
+	var todo []int
+	for i, cs := range changesets {
+		if len(todo) >= maxSourceFiles {
+			break
+		}
+		if len(cs.Hunks) == 0 || isBinaryChangeset(cs) || (plan != nil && plan[i] != "") {
+			continue
+		}
+		todo = append(todo, i)
+	}
+	if len(todo) == 0 {
+		return sources
+	}
+
+	mergeBase, err := s.sources.mergeBase(ctx, client, owner, repo, base, head)
+	if err != nil {
+		log.Printf("sources: %s/%s: %v", owner, repo, err)
+		return sources
+	}
+	load := func(ref, path string) (string, bool) {
+		src, err := s.sources.file(ctx, client, owner, repo, ref, path)
+		if err != nil {
+			log.Printf("sources: %s/%s: %v", owner, repo, err)
+			return "", false
+		}
+		return src, true
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fileFetchers)
+	for _, i := range todo {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			cs, src := changesets[i], &sources[i]
+			if !cs.IsNew {
+				src.Old, src.HasOld = load(mergeBase, cs.OldName)
+			}
+			if !cs.IsDeleted {
+				src.New, src.HasNew = load(head, cs.NewName)
+			}
+		}()
+	}
+	wg.Wait()
+	return sources
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+)
+
+// commentRange returns the first line and the number of lines a review
+// comment covers.
+func commentRange(c ghapi.ReviewComment) (start, count int) {
+	if c.StartLine > 0 && c.StartLine < c.Line {
+		return c.StartLine, c.Line - c.StartLine + 1
+	}
+	return c.Line, 1
+}
+
+// mixedSides reports whether a multi-line comment starts on one side of
+// the diff and ends on the other. Its lines aren't a range of one file.
+func mixedSides(c ghapi.ReviewComment) bool {
+	return c.StartLine > 0 && c.StartSide != "" && c.StartSide != c.Side
+}
+
+// suggestionFor returns the suggestion in c's body, or nil if it has none.
+// The original lines come from the comment's diff hunk, so the suggestion
+// renders without fetching the file.
+func suggestionFor(c ghapi.ReviewComment) *APISuggestion {
+	text, _, ok := diff.ParseSuggestion(c.Body)
+	if !ok {
+		return nil
+	}
+	start, count := commentRange(c)
+	sg := &APISuggestion{Text: text, Applicable: c.Side == "RIGHT" && c.Line > 0 && !mixedSides(c)}
+	if original := diff.HunkTail(c.DiffHunk, c.Side, count); original != nil && start > 0 {
+		cs := diff.SuggestionChangeset(c.Path, start, original, text)
+		sg.Rows = toAPIUnifiedRows(diff.BuildUnifiedRows(cs, diff.FileSources{}))
+	}
+	return sg
+}
+
+// handleAPIApplySuggestion commits the suggestion of a review comment to
+// the PR's head branch, replacing the lines the comment covers.
+// POST /api/v2/apply-suggestion
+//
+// The commented lines must still read as they did when the comment was
+// made; otherwise the suggestion is stale and 409 is returned.
+func (s *Server) handleAPIApplySuggestion(w http.ResponseWriter, r *http.Request) {
+	var req APIApplySuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Owner == "" || req.Repo == "" || req.Number == 0 || req.CommentID == 0 {
+		jsonError(w, "missing owner/repo/number/commentID", http.StatusBadRequest)
+		return
+	}
+
+	client := auth.GitHubClientFromContext(r.Context())
+	ctx := r.Context()
+
+	comment, err := ghapi.FetchReviewComment(ctx, client, req.Owner, req.Repo, req.CommentID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if comment.PRNumber != req.Number {
+		jsonError(w, fmt.Sprintf("comment %d is not on #%d", req.CommentID, req.Number), http.StatusBadRequest)
+		return
+	}
+	text, _, ok := diff.ParseSuggestion(comment.Body)
+	if !ok {
+		jsonError(w, "comment has no suggestion", http.StatusBadRequest)
+		return
+	}
+	if comment.Side != "RIGHT" || comment.Line == 0 {
+		jsonError(w, "suggestion is outdated or not on the new side", http.StatusConflict)
+		return
+	}
+	if mixedSides(*comment) {
+		jsonError(w, "suggestion spans both sides of the diff", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := ghapi.FetchPR(ctx, client, req.Owner, req.Repo, req.Number)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	headOwner, headRepo, ok := strings.Cut(pr.Head.Repo, "/")
+	if pr.State != "open" || !ok {
+		jsonError(w, "PR is closed or its head repository is gone", http.StatusConflict)
+		return
+	}
+
+	blob, err := ghapi.FetchFileBlob(ctx, client, headOwner, headRepo, pr.Head.SHA, comment.Path, maxSourceBytes)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if blob.Data == nil {
+		jsonError(w, fmt.Sprintf("%s is larger than %d bytes", comment.Path, maxSourceBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	start, count := commentRange(*comment)
+	end := start + count - 1
+	lines := strings.Split(strings.ReplaceAll(string(blob.Data), "\r\n", "\n"), "\n")
+	original := diff.HunkTail(comment.DiffHunk, comment.Side, count)
+	if original == nil || end > len(lines) || strings.Join(lines[start-1:end], "\n") != strings.Join(original, "\n") {
+		jsonError(w, "the commented lines have changed since the suggestion was made", http.StatusConflict)
+		return
+	}
+	content, err := diff.ApplySuggestion(string(blob.Data), start, end, text)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Apply suggestion from @%s\n\nSuggested in review comment %d on #%d.",
+			comment.Author.Login, comment.ID, req.Number)
+	}
+	sha, err := ghapi.UpdateFile(ctx, client, headOwner, headRepo, pr.Head.Ref, comment.Path, message, []byte(content), blob.SHA)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	jsonOK(w, map[string]any{"ok": true, "commit": sha})
+}
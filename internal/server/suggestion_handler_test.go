@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikhilr/ghabricator/internal/auth"
+
+	"golang.org/x/oauth2"
+)
+
+func TestApplySuggestionRejectsComments(t *testing.T) {
+	const body = "```suggestion\\nfixed\\n```"
+	comments := map[string]string{
+		// On another PR of the same repository.
+		"/repos/acme/widgets/pulls/comments/1": `{"id": 1, "body": "` + body + `", "path": "a.go", "line": 3, "side": "RIGHT",
+			"pull_request_url": "https://api.github.com/repos/acme/widgets/pulls/7"}`,
+		// From a removed line to an added one.
+		"/repos/acme/widgets/pulls/comments/2": `{"id": 2, "body": "` + body + `", "path": "a.go", "line": 3, "side": "RIGHT",
+			"start_line": 2, "start_side": "LEFT", "pull_request_url": "https://api.github.com/repos/acme/widgets/pulls/42"}`,
+	}
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := comments[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(c))
+	}))
+	defer fake.Close()
+	client := newTestClient(fake.URL)
+
+	for id, want := range map[int64]string{1: "not on #42", 2: "spans both sides"} {
+		body, _ := json.Marshal(APIApplySuggestionRequest{Owner: "acme", Repo: "widgets", Number: 42, CommentID: id})
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/apply-suggestion", bytes.NewReader(body))
+		sess := &auth.Session{Login: "alice", Token: &oauth2.Token{AccessToken: "token"}}
+		r = r.WithContext(auth.NewContext(r.Context(), sess, client))
+		rec := httptest.NewRecorder()
+		(&Server{}).handleAPIApplySuggestion(rec, r)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("comment %d: got %d %s, want 400 %q", id, rec.Code, rec.Body, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nikhilr/ghabricator/internal/diff"
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+	"github.com/nikhilr/ghabricator/internal/herald"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+// maxWebhookBody caps the payload size; GitHub itself caps deliveries at 25MB.
+const maxWebhookBody = 25 << 20
+
+// heraldPRActions are the pull_request actions that can change rule outcomes.
+var heraldPRActions = map[string]bool{
+	"opened":                 true,
+	"reopened":               true,
+	"synchronize":            true,
+	"labeled":                true,
+	"unlabeled":              true,
+	"edited":                 true,
+	"ready_for_review":       true,
+	"converted_to_draft":     true,
+	"review_requested":       true, // personal rules also apply to reviewers
+	"review_request_removed": true,
+}
+
+// handleWebhookGitHub receives GitHub webhook deliveries and runs Herald for
+// pull request events. Evaluation happens in the background; GitHub only
+// waits for the 202.
+// POST /api/webhooks/github
+func (s *Server) handleWebhookGitHub(w http.ResponseWriter, r *http.Request) {
+	if len(s.webhookSecret) == 0 {
+		jsonError(w, "webhooks not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		jsonError(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if err := gh.ValidateSignature(r.Header.Get(gh.SHA256SignatureHeader), body, s.webhookSecret); err != nil {
+		jsonError(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	eventType := gh.WebHookType(r)
+	if eventType == "ping" {
+		jsonOK(w, map[string]bool{"ok": true})
+		return
+	}
+	if eventType != "pull_request" && eventType != "pull_request_review" {
+		jsonOK(w, map[string]any{"ok": true, "ignored": eventType})
+		return
+	}
+
+	event, err := gh.ParseWebHook(eventType, body)
+	if err != nil {
+		jsonError(w, "bad payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		pr   *gh.PullRequest
+		repo *gh.Repository
+	)
+	switch e := event.(type) {
+	case *gh.PullRequestEvent:
+		if !heraldPRActions[e.GetAction()] {
+			jsonOK(w, map[string]any{"ok": true, "ignored": eventType + "." + e.GetAction()})
+			return
+		}
+		pr, repo = e.GetPullRequest(), e.GetRepo()
+	case *gh.PullRequestReviewEvent:
+		pr, repo = e.GetPullRequest(), e.GetRepo()
+	}
+	if pr == nil || repo == nil {
+		jsonError(w, "payload missing pull_request or repository", http.StatusBadRequest)
+		return
+	}
+	if pr.GetState() != "open" {
+		jsonOK(w, map[string]any{"ok": true, "ignored": "pull request is " + pr.GetState()})
+		return
+	}
+	if s.webhookClient == nil {
+		jsonError(w, "no GitHub token for Herald (set HERALD_GITHUB_TOKEN)", http.StatusServiceUnavailable)
+		return
+	}
+
+	prCtx := heraldContextFromEvent(repo, pr)
+	s.heraldJobs.Add(1)
+	go func() {
+		defer s.heraldJobs.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		s.runHerald(ctx, s.webhookClient, prCtx)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// heraldContextFromEvent builds a PRContext from webhook payload objects.
+// Diff-derived fields are left empty; runHerald fills them in.
+func heraldContextFromEvent(repo *gh.Repository, pr *gh.PullRequest) *herald.PRContext {
+	prCtx := &herald.PRContext{
+		Owner:      repo.GetOwner().GetLogin(),
+		Repo:       repo.GetName(),
+		Number:     pr.GetNumber(),
+		Author:     pr.GetUser().GetLogin(),
+		Title:      pr.GetTitle(),
+		Body:       pr.GetBody(),
+		Draft:      pr.GetDraft(),
+		BaseBranch: pr.GetBase().GetRef(),
+		BaseSHA:    pr.GetBase().GetSHA(),
+		HeadBranch: pr.GetHead().GetRef(),
+		HeadSHA:    pr.GetHead().GetSHA(),
+	}
+	for _, l := range pr.Labels {
+		prCtx.Labels = append(prCtx.Labels, l.GetName())
+	}
+	for _, u := range pr.RequestedReviewers {
+		prCtx.Reviewers = append(prCtx.Reviewers, u.GetLogin())
+	}
+	for _, t := range pr.RequestedTeams {
+		prCtx.TeamReviewers = append(prCtx.TeamReviewers, prCtx.Owner+"/"+t.GetSlug())
+	}
+	for _, u := range pr.Assignees {
+		prCtx.Assignees = append(prCtx.Assignees, u.GetLogin())
+	}
+	return prCtx
+}
+
+// runHerald fetches the PR diff, evaluates all rules and executes matches.
+func (s *Server) runHerald(ctx context.Context, client *gh.Client, prCtx *herald.PRContext) {
+	rules, err := s.heraldRules(ctx, client, prCtx)
+	if err != nil {
+		log.Printf("herald: load rules: %v", err)
+		return
+	}
+	if len(rules) == 0 {
+		// Still clear blocker statuses left by rules since deleted.
+		s.heraldExec.Execute(ctx, client, prCtx, nil)
+		return
+	}
+
+	rawDiff, err := ghapi.FetchDiff(ctx, client, prCtx.Owner, prCtx.Repo, prCtx.Number)
+	if err != nil {
+		log.Printf("herald: %s#%d: %v", prCtx.FullRepo(), prCtx.Number, err)
+		return
+	}
+	changesets, err := diff.ParseDiff(rawDiff)
+	if err != nil {
+		log.Printf("herald: %s#%d: parse diff: %v", prCtx.FullRepo(), prCtx.Number, err)
+		return
+	}
+	fillHeraldDiff(prCtx, changesets)
+	prCtx.TeamMember = teamMemberFunc(ctx, client, prCtx.Author)
+
+	// Execute runs even without matches, to clear blocker statuses of
+	// rules that no longer match.
+	matches := herald.Evaluate(rules, prCtx)
+	if len(herald.Blockers(matches, prCtx)) > 0 {
+		reviews, err := ghapi.FetchReviews(ctx, client, prCtx.Owner, prCtx.Repo, prCtx.Number)
+		if err != nil {
+			log.Printf("herald: %s#%d: %v", prCtx.FullRepo(), prCtx.Number, err)
+			return
+		}
+		prCtx.Approvers = approversFromReviews(reviews)
+	}
+	s.heraldExec.Execute(ctx, client, prCtx, matches)
+}
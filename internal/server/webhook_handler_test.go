@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	ghapi "github.com/nikhilr/ghabricator/internal/github"
+	"github.com/nikhilr/ghabricator/internal/herald"
+
+	gh "github.com/google/go-github/v68/github"
+)
+
+const testWebhookSecret = "s3cret"
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "webhooks", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func signPayload(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookTestServer returns a Server whose Herald store lives in a temp
+// HOME and whose webhook client talks to a fake GitHub serving the recorded
+// diff and, if set, a repository rule file. The returned func lists the
+// write calls GitHub received.
+func newWebhookTestServer(t *testing.T, repoRules string) (*Server, func() []string) {
+	t.Setenv("HOME", t.TempDir())
+
+	rawDiff := loadFixture(t, "pull_request.diff")
+	var (
+		mu     sync.Mutex
+		writes []string
+	)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			switch r.URL.Path {
+			case "/repos/acme/widgets/pulls/42":
+				w.Write(rawDiff)
+			case "/repos/acme/widgets/contents/.ghabricator/herald.yml":
+				if repoRules == "" || r.URL.Query().Get("ref") != "9049f1265b7d61be4a8904a9a27120d2064dab3b" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]string{
+					"type":     "file",
+					"encoding": "base64",
+					"content":  base64.StdEncoding.EncodeToString([]byte(repoRules)),
+				})
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
+		mu.Lock()
+		writes = append(writes, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/repos/acme/widgets/issues/42/labels" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(fake.Close)
+
+	store, err := herald.OpenStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	heraldExec, err := herald.OpenExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		herald:        store,
+		heraldExec:    heraldExec,
+		webhookSecret: []byte(testWebhookSecret),
+		webhookClient: newTestClient(fake.URL),
+	}
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(writes)
+	}
+}
+
+func newTestClient(baseURL string) *gh.Client {
+	c := gh.NewClient(nil)
+	c.BaseURL, _ = url.Parse(baseURL + "/")
+	return c
+}
+
+func deliver(s *Server, event string, body []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/github", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(gh.EventTypeHeader, event)
+	req.Header.Set(gh.SHA256SignatureHeader, signature)
+	rec := httptest.NewRecorder()
+	s.handleWebhookGitHub(rec, req)
+	return rec
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	s, _ := newWebhookTestServer(t, "")
+	body := loadFixture(t, "pull_request_opened.json")
+
+	rec := deliver(s, "pull_request", body, "sha256=deadbeef")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = deliver(s, "pull_request", body, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for missing signature, got %d", rec.Code)
+	}
+}
+
+func TestWebhookRunsHeraldOnOpened(t *testing.T) {
+	s, writes := newWebhookTestServer(t, "")
+	err := s.herald.Save(&herald.Rule{
+		Name:       "docs",
+		Conditions: []herald.Condition{{Type: herald.CondFilePath, Value: "docs/*.md"}},
+		Actions: []herald.Action{
+			{Type: herald.ActionAddLabel, Value: "documentation"},
+			{Type: herald.ActionAddReviewer, Value: "hubot"}, // already requested
+			{Type: herald.ActionAddReviewer, Value: "alice"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := loadFixture(t, "pull_request_opened.json")
+	rec := deliver(s, "pull_request", body, signPayload(body))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	s.heraldJobs.Wait()
+
+	got := writes()
+	want := []string{
+		"POST /repos/acme/widgets/issues/42/labels",
+		"POST /repos/acme/widgets/pulls/42/requested_reviewers",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("GitHub writes = %v, want %v", got, want)
+	}
+
+	entries, err := s.heraldExec.Log().ForPR("acme/widgets", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 log entries, got %+v", entries)
+	}
+	ts, err := s.heraldExec.Transcripts().List(herald.TranscriptFilter{Repo: "acme/widgets", Number: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 1 || ts[0].HeadSHA != "6dcb09b5b57875f334f61aebed695e2e4193db5e" || len(ts[0].Conditions) != 1 {
+		t.Fatalf("unexpected transcripts: %+v", ts)
+	}
+
+	// A redelivery must not repeat anything.
+	rec = deliver(s, "pull_request", body, signPayload(body))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 on redelivery, got %d", rec.Code)
+	}
+	s.heraldJobs.Wait()
+	if n := len(writes()); n != len(want) {
+		t.Errorf("redelivery made %d new writes", n-len(want))
+	}
+}
+
+func TestWebhookRunsRepositoryRules(t *testing.T) {
+	s, writes := newWebhookTestServer(t, `
+rules:
+  - name: docs label
+    conditions: [{type: file_path, value: "docs/*.md"}]
+    actions: [{type: add_label, value: from-repo}]
+`)
+	body := loadFixture(t, "pull_request_opened.json")
+	if rec := deliver(s, "pull_request", body, signPayload(body)); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	s.heraldJobs.Wait()
+
+	if got := writes(); !slices.Equal(got, []string{"POST /repos/acme/widgets/issues/42/labels"}) {
+		t.Errorf("GitHub writes = %v", got)
+	}
+	entries, _ := s.heraldExec.Log().ForPR("acme/widgets", 42)
+	if len(entries) != 1 || entries[0].Action.Value != "from-repo" || !strings.HasPrefix(entries[0].RuleID, "repo:acme/widgets:") {
+		t.Errorf("log entries = %+v", entries)
+	}
+}
+
+func TestWebhookRunsReviewersPersonalRules(t *testing.T) {
+	s, writes := newWebhookTestServer(t, "")
+	err := s.herald.Save(&herald.Rule{
+		Name:        "my reviews",
+		AuthorLogin: "alice",
+		Scope:       herald.ScopePersonal,
+		Conditions:  []herald.Condition{{Type: herald.CondFilePath, Value: "docs/*.md"}},
+		Actions:     []herald.Action{{Type: herald.ActionAddLabel, Value: "alice-reviewing"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := loadFixture(t, "pull_request_review_requested.json")
+	if rec := deliver(s, "pull_request", body, signPayload(body)); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	s.heraldJobs.Wait()
+
+	if got := writes(); !slices.Equal(got, []string{"POST /repos/acme/widgets/issues/42/labels"}) {
+		t.Errorf("GitHub writes = %v", got)
+	}
+}
+
+func TestWebhookIgnoresClosedPR(t *testing.T) {
+	s, writes := newWebhookTestServer(t, "")
+	body := loadFixture(t, "pull_request_closed.json")
+
+	rec := deliver(s, "pull_request", body, signPayload(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	s.heraldJobs.Wait()
+	if len(writes()) != 0 {
+		t.Errorf("unexpected writes: %v", writes())
+	}
+}
+
+func TestHeraldContextFromReviewEvent(t *testing.T) {
+	body := loadFixture(t, "pull_request_review_submitted.json")
+	event, err := gh.ParseWebHook("pull_request_review", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := event.(*gh.PullRequestReviewEvent)
+	ctx := heraldContextFromEvent(e.GetRepo(), e.GetPullRequest())
+
+	if ctx.FullRepo() != "acme/widgets" || ctx.Number != 42 {
+		t.Errorf("target = %s#%d", ctx.FullRepo(), ctx.Number)
+	}
+	if ctx.Author != "octocat" || ctx.BaseBranch != "main" {
+		t.Errorf("author/base = %q/%q", ctx.Author, ctx.BaseBranch)
+	}
+}
+
+func TestApproversFromReviews(t *testing.T) {
+	review := func(login, state string) ghapi.Review {
+		return ghapi.Review{Author: ghapi.User{Login: login}, State: state}
+	}
+	got := approversFromReviews([]ghapi.Review{
+		review("alice", "APPROVED"),
+		review("alice", "COMMENTED"), // doesn't withdraw the approval
+		review("bob", "APPROVED"),
+		review("bob", "CHANGES_REQUESTED"),
+		review("carol", "APPROVED"),
+		review("carol", "DISMISSED"),
+		review("dave", "COMMENTED"),
+	})
+	if !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("approvers = %v, want [alice]", got)
+	}
+}